@@ -21,6 +21,12 @@ type ConfigItem struct {
 	CreatedTime      string `json:"createdTime"`
 	LastModifiedTime string `json:"lastModifiedTime"`
 	LastUpdateUser   string `json:"lastUpdateUser"`
+	// Sensitive flags the value to be masked in responses, it is kept unchanged if nil when publishing
+	Sensitive *bool `json:"sensitive,omitempty"`
+	// Encrypted stores the value encrypted by the data key of the project, it is kept unchanged if nil when publishing
+	Encrypted *bool `json:"encrypted,omitempty"`
+	// Provenance is the layer of each field in the effective view, base or environment
+	Provenance map[string]string `json:"provenance,omitempty"`
 }
 
 type HistoryVersion struct {
@@ -53,9 +59,13 @@ type ConfigClientIface interface {
 
 var _ ConfigClientIface = &NacosService{}
 var _ ConfigClientIface = &EtcdService{}
+var _ ConfigClientIface = &GitService{}
+var _ ConfigClientIface = &RedisService{}
 
 const salt = "kubegems "
 
+// GenPassword derives the password of the user.
+// Deprecated: anyone knows the username can compute it, use a CredentialStore.
 func GenPassword(uname string) string {
 	str := salt + uname
 	h := md5.New()
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// Credential is the password of a backend account
+type Credential struct {
+	Username string
+	Password string
+	// Applied reports whether the backend account has been set to Password
+	Applied bool
+}
+
+// CredentialStore keeps the passwords of the backend accounts of a cluster.
+// backends set the account to the password once it is not Applied, then call MarkApplied,
+// so existing accounts are rotated to the stored password the first time they are used.
+type CredentialStore interface {
+	// Credential returns the credential of the account, a random password is generated for new accounts
+	Credential(ctx context.Context, username string) (*Credential, error)
+	// MarkApplied records the backend account has been set to password
+	MarkApplied(ctx context.Context, username, password string) error
+}
+
+// DerivedCredentials derives the passwords by GenPassword, it is only for compatibility
+var DerivedCredentials CredentialStore = derivedCredentials{}
+
+type derivedCredentials struct{}
+
+func (derivedCredentials) Credential(ctx context.Context, username string) (*Credential, error) {
+	return &Credential{Username: username, Password: GenPassword(username), Applied: true}, nil
+}
+
+func (derivedCredentials) MarkApplied(ctx context.Context, username, password string) error {
+	return nil
+}
+
+func storeOr(store CredentialStore) CredentialStore {
+	if store == nil {
+		return DerivedCredentials
+	}
+	return store
+}
+
+// RandomPassword returns a password of 32 url safe characters
+func RandomPassword() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// accountsOf returns the accounts of the users with their passwords in store
+func accountsOf(ctx context.Context, store CredentialStore, users ...string) ([]Account, error) {
+	ret := make([]Account, 0, len(users))
+	for _, user := range users {
+		cred, err := store.Credential(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, Account{Username: user, Password: cred.Password})
+	}
+	return ret, nil
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// memCredentials is a CredentialStore in memory
+type memCredentials struct {
+	lock  sync.Mutex
+	creds map[string]*Credential
+}
+
+func (m *memCredentials) Credential(ctx context.Context, username string) (*Credential, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if cred, ok := m.creds[username]; ok {
+		ret := *cred
+		return &ret, nil
+	}
+	password, err := RandomPassword()
+	if err != nil {
+		return nil, err
+	}
+	m.creds[username] = &Credential{Username: username, Password: password}
+	return &Credential{Username: username, Password: password}, nil
+}
+
+func (m *memCredentials) MarkApplied(ctx context.Context, username, password string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if cred, ok := m.creds[username]; ok && cred.Password == password {
+		cred.Applied = true
+	}
+	return nil
+}
+
+func TestNacosService_Credentials(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		updated = map[string]string{}
+		created = map[string]string{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == LOGIN_PATH:
+			w.Write([]byte(`{"accessToken":"token","tokenTtl":18000,"globalAdmin":true}`))
+		case r.URL.Path == USER_PATH && r.Method == http.MethodGet:
+			w.Write([]byte(`{"pagesAvailable":1,"pageItems":[{"username":"kubegems/t1/p1:e1:r"}]}`))
+		case r.URL.Path == USER_PATH && r.Method == http.MethodPut:
+			lock.Lock()
+			updated[r.URL.Query().Get("username")] = r.URL.Query().Get("newPassword")
+			lock.Unlock()
+		case r.URL.Path == USER_PATH && r.Method == http.MethodPost:
+			r.ParseForm()
+			lock.Lock()
+			created[r.PostForm.Get("username")] = r.PostForm.Get("password")
+			lock.Unlock()
+		}
+	}))
+	defer server.Close()
+
+	store := &memCredentials{creds: map[string]*Credential{}}
+	nacos, err := NewNacosService([]string{server.URL}, "nacos", "nacos", nil, WithNacosCredentials(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nacos.Close()
+	rUser, rwUser := "kubegems/t1/p1:e1:r", "kubegems/t1/p1:e1:rw"
+	if err := nacos.applyCredentials(context.Background(), rUser, rwUser); err != nil {
+		t.Fatalf("applyCredentials() error = %v", err)
+	}
+	accounts, err := nacos.Accounts(&ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accounts[0].Password == GenPassword(rUser) || updated[rUser] != accounts[0].Password {
+		t.Errorf("existing user %s should be rotated to the stored password, updated %v", rUser, updated)
+	}
+	if created[rwUser] != accounts[1].Password {
+		t.Errorf("new user %s should be created with the stored password, created %v", rwUser, created)
+	}
+	for _, user := range []string{rUser, rwUser} {
+		if !store.creds[user].Applied {
+			t.Errorf("credential of %s is not marked applied", user)
+		}
+	}
+
+	// applied credentials are not set again
+	updated, created = map[string]string{}, map[string]string{}
+	if err := nacos.applyCredentials(context.Background(), rUser, rwUser); err != nil {
+		t.Fatal(err)
+	}
+	if len(updated)+len(created) != 0 {
+		t.Errorf("applied credentials set again, updated %v, created %v", updated, created)
+	}
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+)
+
+// EncryptedValuePrefix is the prefix of the values encrypted by the data key of the environment.
+// the rest is base64 of the nonce and the AES-GCM sealed value, the item is the additional data.
+const EncryptedValuePrefix = "enc:v1:"
+
+// DataKeySize is the size of the data keys, which are AES-256 keys
+const DataKeySize = 32
+
+// IsEncryptedValue reports whether the value is encrypted by EncryptValue
+func IsEncryptedValue(value string) bool {
+	return strings.HasPrefix(value, EncryptedValuePrefix)
+}
+
+// EncryptValue encrypts the value of item by the data key of its environment
+func EncryptValue(dataKey []byte, item *ConfigItem) (string, error) {
+	aead, err := dataKeyAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(item.Value), encryptedValueAD(item))
+	return EncryptedValuePrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptValue decrypts the value of item, values not encrypted are returned as is
+func DecryptValue(dataKey []byte, item *ConfigItem) (string, error) {
+	if !IsEncryptedValue(item.Value) {
+		return item.Value, nil
+	}
+	aead, err := dataKeyAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(item.Value, EncryptedValuePrefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", InvalidArgumentError("invalid encrypted value of %s", item.Key)
+	}
+	value, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], encryptedValueAD(item))
+	if err != nil {
+		return "", InvalidArgumentError("decrypt value of %s failed, %v", item.Key, err)
+	}
+	return string(value), nil
+}
+
+func dataKeyAEAD(dataKey []byte) (cipher.AEAD, error) {
+	if len(dataKey) != DataKeySize {
+		return nil, InvalidArgumentError("data key must be %d bytes", DataKeySize)
+	}
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptedValueAD binds the encrypted value to the item, so it can not be copied to another key
+func encryptedValueAD(item *ConfigItem) []byte {
+	return []byte(strings.Join([]string{item.Tenant, item.Project, item.Environment, item.Key}, "/"))
+}
+
+// DataKey is the base64 encoded data key of an environment, returned to the applications decrypting the values
+type DataKey struct {
+	Key string `json:"key"`
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEncryptValue(t *testing.T) {
+	dataKey := make([]byte, DataKeySize)
+	item := &ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1", Key: "db.password", Value: "s3cret"}
+	encrypted, err := EncryptValue(dataKey, item)
+	if err != nil || !IsEncryptedValue(encrypted) {
+		t.Fatalf("EncryptValue() = %s, error = %v", encrypted, err)
+	}
+	tests := []struct {
+		name    string
+		dataKey []byte
+		item    ConfigItem
+		want    string
+		wantErr bool
+	}{
+		{name: "encrypted", dataKey: dataKey, item: ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1", Key: "db.password", Value: encrypted}, want: "s3cret"},
+		{name: "plain", dataKey: dataKey, item: ConfigItem{Key: "db.password", Value: "plain"}, want: "plain"},
+		{name: "another key", dataKey: dataKey, item: ConfigItem{Tenant: "t1", Project: "p1", Environment: "e2", Key: "db.password", Value: encrypted}, wantErr: true},
+		{name: "another data key", dataKey: []byte("0123456789abcdef0123456789abcdef"), item: ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1", Key: "db.password", Value: encrypted}, wantErr: true},
+		{name: "tampered", dataKey: dataKey, item: ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1", Key: "db.password", Value: encrypted[:len(encrypted)-4] + "AAA="}, wantErr: true},
+		{name: "invalid data key", dataKey: []byte("short"), item: ConfigItem{Key: "db.password", Value: encrypted}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecryptValue(tt.dataKey, &tt.item)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrInvalidArgument)) {
+				t.Fatalf("DecryptValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("DecryptValue() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
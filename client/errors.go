@@ -0,0 +1,208 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorCode is the stable code of an Error, it is returned to api callers
+type ErrorCode string
+
+const (
+	ErrorCodeNotFound           ErrorCode = "NotFound"
+	ErrorCodeConflict           ErrorCode = "Conflict"
+	ErrorCodeUnauthorized       ErrorCode = "Unauthorized"
+	ErrorCodeBackendUnavailable ErrorCode = "BackendUnavailable"
+	ErrorCodeInvalidArgument    ErrorCode = "InvalidArgument"
+	// ErrorCodeTimeout is the code of requests canceled or timeout before the backend responded
+	ErrorCodeTimeout ErrorCode = "Timeout"
+	// ErrorCodeUnknown is the code of errors which are not an Error
+	ErrorCodeUnknown ErrorCode = "Unknown"
+)
+
+// sentinel errors, check the kind of an error by errors.Is(err, ErrNotFound)
+var (
+	ErrNotFound           = &Error{Code: ErrorCodeNotFound, Message: "not found"}
+	ErrConflict           = &Error{Code: ErrorCodeConflict, Message: "conflict"}
+	ErrUnauthorized       = &Error{Code: ErrorCodeUnauthorized, Message: "unauthorized"}
+	ErrBackendUnavailable = &Error{Code: ErrorCodeBackendUnavailable, Message: "backend unavailable"}
+	ErrInvalidArgument    = &Error{Code: ErrorCodeInvalidArgument, Message: "invalid argument"}
+	ErrTimeout            = &Error{Code: ErrorCodeTimeout, Message: "timeout"}
+)
+
+// Error is the typed error returned by every backend
+type Error struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	cause   error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is reports whether target is an Error of the same code
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+func newError(code ErrorCode, cause error, format string, args ...interface{}) *Error {
+	msg := fmt.Sprintf(format, args...)
+	if cause != nil {
+		msg = msg + ", " + cause.Error()
+	}
+	return &Error{Code: code, Message: msg, cause: cause}
+}
+
+func NotFoundError(format string, args ...interface{}) error {
+	return newError(ErrorCodeNotFound, nil, format, args...)
+}
+
+func ConflictError(format string, args ...interface{}) error {
+	return newError(ErrorCodeConflict, nil, format, args...)
+}
+
+func UnauthorizedError(format string, args ...interface{}) error {
+	return newError(ErrorCodeUnauthorized, nil, format, args...)
+}
+
+func BackendUnavailableError(format string, args ...interface{}) error {
+	return newError(ErrorCodeBackendUnavailable, nil, format, args...)
+}
+
+func InvalidArgumentError(format string, args ...interface{}) error {
+	return newError(ErrorCodeInvalidArgument, nil, format, args...)
+}
+
+func TimeoutError(format string, args ...interface{}) error {
+	return newError(ErrorCodeTimeout, nil, format, args...)
+}
+
+// CodeOf returns the code of err, ErrorCodeUnknown if err is not an Error
+func CodeOf(err error) ErrorCode {
+	e := &Error{}
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ErrorCodeUnknown
+}
+
+// AsError returns err as an Error, errors which are not an Error get ErrorCodeUnknown
+func AsError(err error) *Error {
+	e := &Error{}
+	if errors.As(err, &e) {
+		return e
+	}
+	return &Error{Code: ErrorCodeUnknown, Message: err.Error(), cause: err}
+}
+
+// errorOfStatus converts a failed http response of the backend into an Error
+func errorOfStatus(code int, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	switch {
+	case code == http.StatusNotFound:
+		return newError(ErrorCodeNotFound, nil, "%s, code is %d", msg, code)
+	case code == http.StatusConflict:
+		return newError(ErrorCodeConflict, nil, "%s, code is %d", msg, code)
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return newError(ErrorCodeUnauthorized, nil, "%s, code is %d", msg, code)
+	case code == http.StatusTooManyRequests || code >= http.StatusInternalServerError:
+		return newError(ErrorCodeBackendUnavailable, nil, "%s, code is %d", msg, code)
+	default:
+		return newError(ErrorCodeInvalidArgument, nil, "%s, code is %d", msg, code)
+	}
+}
+
+// ErrorOfStatus converts a failed http response of a backend into an Error, for the applications reading backends directly
+func ErrorOfStatus(code int, format string, args ...interface{}) error {
+	return errorOfStatus(code, "%s", fmt.Sprintf(format, args...))
+}
+
+// ErrorOfBackend classifies the error of reading a backend directly, such as the sdk of applications,
+// the errors which are not classified are BackendUnavailable, as they are mostly of the connections
+func ErrorOfBackend(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if timeout := errorOfContext(ctx, err); timeout != err {
+		return timeout
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	if classified := errorOfRedis(errorOfGRPC(err)); errors.As(classified, &e) {
+		return classified
+	}
+	return newError(ErrorCodeBackendUnavailable, err, "request backend failed")
+}
+
+// errorOfRequest wraps the error of sending a request to the backend, eg: connection refused
+func errorOfRequest(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return newError(ErrorCodeBackendUnavailable, err, "request backend failed")
+}
+
+// errorOfContext returns a Timeout error if ctx is done, otherwise err
+func errorOfContext(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return newError(ErrorCodeTimeout, ctx.Err(), "request backend canceled")
+	}
+	return newError(ErrorCodeTimeout, ctx.Err(), "request backend timeout")
+}
+
+// errorOfGRPC converts the error of a grpc backend such as etcd by its grpc code
+func errorOfGRPC(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return newError(ErrorCodeTimeout, err, "request backend timeout")
+	}
+	var coder interface{ Code() codes.Code }
+	code := codes.Unknown
+	if errors.As(err, &coder) {
+		code = coder.Code()
+	} else if s, ok := status.FromError(err); ok {
+		code = s.Code()
+	}
+	switch code {
+	case codes.NotFound:
+		return newError(ErrorCodeNotFound, err, "request backend failed")
+	case codes.AlreadyExists, codes.Aborted, codes.FailedPrecondition:
+		return newError(ErrorCodeConflict, err, "request backend failed")
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return newError(ErrorCodeUnauthorized, err, "request backend failed")
+	case codes.InvalidArgument, codes.OutOfRange:
+		return newError(ErrorCodeInvalidArgument, err, "request backend failed")
+	case codes.DeadlineExceeded:
+		return newError(ErrorCodeTimeout, err, "request backend timeout")
+	case codes.Unavailable, codes.ResourceExhausted:
+		return newError(ErrorCodeBackendUnavailable, err, "request backend failed")
+	default:
+		return err
+	}
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrors(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCode
+	}{
+		{name: "not found", err: NotFoundError("key %s not found", "a"), want: ErrorCodeNotFound},
+		{name: "wrapped", err: fmt.Errorf("list tenant failed, %w", ConflictError("conflict")), want: ErrorCodeConflict},
+		{name: "untyped", err: fmt.Errorf("unknown"), want: ErrorCodeUnknown},
+		{name: "status 403", err: errorOfStatus(http.StatusForbidden, "login failed"), want: ErrorCodeUnauthorized},
+		{name: "status 502", err: errorOfStatus(http.StatusBadGateway, "list failed"), want: ErrorCodeBackendUnavailable},
+		{name: "status 400", err: errorOfStatus(http.StatusBadRequest, "pub failed"), want: ErrorCodeInvalidArgument},
+		{name: "request", err: errorOfRequest(fmt.Errorf("connection refused")), want: ErrorCodeBackendUnavailable},
+		{name: "etcd permission denied", err: errorOfGRPC(rpctypes.ErrPermissionDenied), want: ErrorCodeUnauthorized},
+		{name: "grpc unavailable", err: errorOfGRPC(status.Error(codes.Unavailable, "down")), want: ErrorCodeBackendUnavailable},
+		{name: "grpc timeout", err: errorOfGRPC(context.DeadlineExceeded), want: ErrorCodeTimeout},
+		{name: "grpc deadline exceeded", err: errorOfGRPC(status.Error(codes.DeadlineExceeded, "slow")), want: ErrorCodeTimeout},
+		{name: "context timeout", err: errorOfRequest(errorOfContext(expired, fmt.Errorf("read body failed"))), want: ErrorCodeTimeout},
+		{name: "redis nil", err: errorOfRedis(redis.Nil), want: ErrorCodeNotFound},
+		{name: "redis noperm", err: errorOfRedis(fmt.Errorf("NOPERM this user has no permissions")), want: ErrorCodeUnauthorized},
+		{name: "git rejected", err: errorOfGit(fmt.Errorf("git push failed"), "! [rejected] main -> main (fetch first)"), want: ErrorCodeConflict},
+	}
+	sentinels := map[ErrorCode]error{
+		ErrorCodeNotFound:           ErrNotFound,
+		ErrorCodeConflict:           ErrConflict,
+		ErrorCodeUnauthorized:       ErrUnauthorized,
+		ErrorCodeBackendUnavailable: ErrBackendUnavailable,
+		ErrorCodeInvalidArgument:    ErrInvalidArgument,
+		ErrorCodeTimeout:            ErrTimeout,
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CodeOf(tt.err); got != tt.want {
+				t.Errorf("CodeOf() = %v, want %v", got, tt.want)
+			}
+			for code, sentinel := range sentinels {
+				if errors.Is(tt.err, sentinel) != (code == tt.want) {
+					t.Errorf("errors.Is(%v, %v) = %v", tt.err, sentinel, code != tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBackendNotFound(t *testing.T) {
+	mr := runTestRedis(t)
+	redisSvc, err := NewRedisService([]string{mr.Addr()}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitSvc, err := NewGitService(t.TempDir(), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, cli := range map[string]ConfigClientIface{"redis": redisSvc, "git": gitSvc} {
+		item := &ConfigItem{Tenant: "t", Project: "p", Environment: "dev", Key: "missing"}
+		if err := cli.Get(context.Background(), item); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s Get() error = %v, want NotFound", name, err)
+		}
+		if err := cli.Get(context.Background(), &ConfigItem{Key: "a"}); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("%s Get() error = %v, want InvalidArgument", name, err)
+		}
+	}
+}
@@ -2,11 +2,15 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
@@ -17,29 +21,75 @@ test Etcd Version: v3.5.2
 type EtcdService struct {
 	cli *clientv3.Client
 
+	lock  sync.Mutex
 	users []string
 	roles []string
+
+	credentials         CredentialStore
+	applicationAccounts ApplicationAccountsFunc
 }
 
 type PreAcionDone string
 
 const preAcionDone PreAcionDone = "pre_action_done"
 
-func NewEtcdService(endpoints []string, username, password string) (*EtcdService, error) {
-	cli, err := clientv3.New(clientv3.Config{
+type EtcdOption func(e *EtcdService, cfg *clientv3.Config) error
+
+// WithEtcdTLS connects etcd with tls, client certificates are used for mTLS
+func WithEtcdTLS(tlsConfig *TLSConfig) EtcdOption {
+	return func(e *EtcdService, cfg *clientv3.Config) error {
+		tlsCfg, err := tlsConfig.Build()
+		if err != nil {
+			return err
+		}
+		cfg.TLS = tlsCfg
+		return nil
+	}
+}
+
+// WithEtcdCredentials sets the store of the passwords of the users created in etcd
+func WithEtcdCredentials(store CredentialStore) EtcdOption {
+	return func(e *EtcdService, cfg *clientv3.Config) error {
+		e.credentials = store
+		return nil
+	}
+}
+
+// WithEtcdApplicationAccounts enables per-application accounts for the projects f returns true
+func WithEtcdApplicationAccounts(f ApplicationAccountsFunc) EtcdOption {
+	return func(e *EtcdService, cfg *clientv3.Config) error {
+		e.applicationAccounts = f
+		return nil
+	}
+}
+
+func NewEtcdService(endpoints []string, username, password string, opts ...EtcdOption) (*EtcdService, error) {
+	cfg := clientv3.Config{
 		Endpoints:   endpoints,
 		Username:    username,
 		Password:    password,
 		DialTimeout: 5 * 1e9,
-	})
-	if err != nil {
-		return nil, err
 	}
-	return &EtcdService{
-		cli:   cli,
+	e := &EtcdService{
 		users: []string{},
 		roles: []string{},
-	}, nil
+	}
+	for _, opt := range opts {
+		if err := opt(e, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	cli, err := clientv3.New(cfg)
+	if err != nil {
+		return nil, errorOfGRPC(err)
+	}
+	e.cli = cli
+	return e, nil
+}
+
+// Close closes the connections to etcd, the service can not be used after closed
+func (e *EtcdService) Close() error {
+	return e.cli.Close()
 }
 
 type Rev struct {
@@ -58,10 +108,13 @@ func (e *EtcdService) get(ctx context.Context, item *ConfigItem, opts ...clientv
 	}
 	resp, err := e.cli.Get(ctx, mapper.Key(), opts...)
 	if err != nil {
-		return nil, err
+		return nil, errorOfGRPC(err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, NotFoundError("key %s not found", mapper.Key())
 	}
-	if len(resp.Kvs) != 1 {
-		return nil, fmt.Errorf("key %s not found or more than one key found", mapper.Key())
+	if len(resp.Kvs) > 1 {
+		return nil, ConflictError("more than one key found for %s", mapper.Key())
 	}
 	kv := resp.Kvs[0]
 	item.Value = string(kv.Value)
@@ -89,11 +142,60 @@ func (e *EtcdService) Pub(ctx context.Context, item *ConfigItem) error {
 	if err != nil {
 		return err
 	}
+	if err := e.applicationAccounts.checkKey(item); err != nil {
+		return err
+	}
 	if err := e.preAction(ctx, mapper); err != nil {
 		return err
 	}
 	_, err = e.cli.Put(ctx, mapper.Key(), item.Value)
-	return err
+	return errorOfGRPC(err)
+}
+
+var _ CASPublisher = &EtcdService{}
+
+// Revision returns the mod revision of the key, 0 if it does not exist
+func (e *EtcdService) Revision(ctx context.Context, item *ConfigItem) (int64, error) {
+	mapper, err := mapperForEtcd(item)
+	if err != nil {
+		return 0, err
+	}
+	if err := e.preAction(ctx, mapper); err != nil {
+		return 0, err
+	}
+	resp, err := e.cli.Get(ctx, mapper.Key(), clientv3.WithKeysOnly())
+	if err != nil {
+		return 0, errorOfGRPC(err)
+	}
+	if len(resp.Kvs) == 0 {
+		return 0, nil
+	}
+	return resp.Kvs[0].ModRevision, nil
+}
+
+// PubCAS puts the key only if its mod revision is still prevRev
+func (e *EtcdService) PubCAS(ctx context.Context, item *ConfigItem, prevRev int64) error {
+	mapper, err := mapperForEtcd(item)
+	if err != nil {
+		return err
+	}
+	if err := e.applicationAccounts.checkKey(item); err != nil {
+		return err
+	}
+	if err := e.preAction(ctx, mapper); err != nil {
+		return err
+	}
+	resp, err := e.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(mapper.Key()), "=", prevRev)).
+		Then(clientv3.OpPut(mapper.Key(), item.Value)).
+		Commit()
+	if err != nil {
+		return errorOfGRPC(err)
+	}
+	if !resp.Succeeded {
+		return ConflictError("key %s was modified after revision %d", mapper.Key(), prevRev)
+	}
+	return nil
 }
 
 func (e *EtcdService) Delete(ctx context.Context, item *ConfigItem) error {
@@ -101,11 +203,14 @@ func (e *EtcdService) Delete(ctx context.Context, item *ConfigItem) error {
 	if err != nil {
 		return err
 	}
+	if err := e.applicationAccounts.checkKey(item); err != nil {
+		return err
+	}
 	if err := e.preAction(ctx, mapper); err != nil {
 		return err
 	}
 	_, err = e.cli.Delete(ctx, mapper.Key())
-	return err
+	return errorOfGRPC(err)
 }
 
 func (e *EtcdService) Listener(ctx context.Context, item *ConfigItem) (map[string]string, error) {
@@ -149,7 +254,7 @@ func (e *EtcdService) List(ctx context.Context, opts *ListOptions) ([]*ConfigIte
 	end := clientv3.GetPrefixRangeEnd(mapper.ListKey())
 	resp, err := e.cli.Get(ctx, mapper.ListKey(), clientv3.WithRange(end))
 	if err != nil {
-		return nil, err
+		return nil, errorOfGRPC(err)
 	}
 	ret := []*ConfigItem{}
 	for _, kv := range resp.Kvs {
@@ -166,9 +271,14 @@ type EtcdMapper struct {
 	item *ConfigItem
 }
 
+// MapperForEtcd returns the etcd key mapper of the item, applications use it to locate their configs
+func MapperForEtcd(item *ConfigItem) (*EtcdMapper, error) {
+	return mapperForEtcd(item)
+}
+
 func mapperForEtcd(item *ConfigItem) (*EtcdMapper, error) {
 	if item.Tenant == "" || item.Project == "" {
-		return nil, fmt.Errorf("tenant and project must be specified")
+		return nil, InvalidArgumentError("tenant and project must be specified")
 	}
 	return &EtcdMapper{
 		item: item,
@@ -191,6 +301,11 @@ func (c *EtcdMapper) NsPrefix() string {
 	return fmt.Sprintf("kubegems/%s/%s/%s", c.item.Tenant, c.item.Project, c.item.Environment)
 }
 
+// ApplicationPrefix is the prefix of the keys of the application, whose names start with the application name and the delimiter
+func (c *EtcdMapper) ApplicationPrefix() string {
+	return c.NsPrefix() + "/" + applicationKeyPrefix(c.item.Application)
+}
+
 func (e *EtcdService) convert(kv *mvccpb.KeyValue) (*ConfigItem, error) {
 	k := string(kv.Key)
 	seps := strings.Split(k, "/")
@@ -210,14 +325,25 @@ func (e *EtcdService) preAction(ctx context.Context, mapper *EtcdMapper) error {
 	if ctx.Value(preAcionDone) != nil {
 		return nil
 	}
+	if e.applicationAccounts.enabled(mapper.item) {
+		// the accounts of the environment are kept for the shared configs
+		if err := e.preAction(ctx, &EtcdMapper{item: environmentItem(mapper.item)}); err != nil {
+			return err
+		}
+	}
 	rUser, rwUser, rRole, rwRole := e.userRolesFor(mapper)
+	key, end := e.permissionRange(mapper)
 	var newRUser, newRWUser, newRRole, newRWRole bool
-	if !contains(e.users, rUser) {
-		e.cli.Auth.UserAdd(ctx, rUser, GenPassword(rUser))
+	if !e.hasUser(rUser) {
+		if err := e.addUser(ctx, rUser); err != nil {
+			return err
+		}
 		newRUser = true
 	}
-	if !contains(e.users, rwUser) {
-		e.cli.Auth.UserAdd(ctx, rwUser, GenPassword(rwUser))
+	if !e.hasUser(rwUser) {
+		if err := e.addUser(ctx, rwUser); err != nil {
+			return err
+		}
 		newRWUser = true
 	}
 	if !contains(e.roles, rRole) {
@@ -230,38 +356,145 @@ func (e *EtcdService) preAction(ctx context.Context, mapper *EtcdMapper) error {
 	}
 
 	if newRUser || newRRole {
-		e.cli.Auth.RoleGrantPermission(ctx, rRole, mapper.NsPrefix(), clientv3.GetPrefixRangeEnd(mapper.Key()), clientv3.PermissionType(clientv3.PermRead))
+		e.cli.Auth.RoleGrantPermission(ctx, rRole, key, end, clientv3.PermissionType(clientv3.PermRead))
 		e.cli.Auth.UserGrantRole(ctx, rUser, rRole)
 	}
 	if newRWUser || newRWRole {
-		e.cli.Auth.RoleGrantPermission(ctx, rwRole, mapper.NsPrefix(), clientv3.GetPrefixRangeEnd(mapper.Key()), clientv3.PermissionType(clientv3.PermReadWrite))
+		e.cli.Auth.RoleGrantPermission(ctx, rwRole, key, end, clientv3.PermissionType(clientv3.PermReadWrite))
 		e.cli.Auth.UserGrantRole(ctx, rwUser, rwRole)
 	}
 	return nil
 }
 
+// addUser adds the user with the stored password, an existing user gets the password rotated if it is not applied yet
+func (e *EtcdService) addUser(ctx context.Context, user string) error {
+	store := storeOr(e.credentials)
+	cred, err := store.Credential(ctx, user)
+	if err != nil {
+		return err
+	}
+	_, err = e.cli.Auth.UserAdd(ctx, user, cred.Password)
+	if cred.Applied {
+		// failed to add an applied user means it exists
+		e.recordUser(user)
+		return nil
+	}
+	if err != nil {
+		if _, err := e.cli.Auth.UserChangePassword(ctx, user, cred.Password); err != nil {
+			return errorOfGRPC(err)
+		}
+	}
+	if err := store.MarkApplied(ctx, user, cred.Password); err != nil {
+		return err
+	}
+	e.recordUser(user)
+	return nil
+}
+
+func (e *EtcdService) hasUser(user string) bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return contains(e.users, user)
+}
+
+// recordUser records the user added, preAction skips adding it again
+func (e *EtcdService) recordUser(user string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if !contains(e.users, user) {
+		e.users = append(e.users, user)
+	}
+}
+
+// RotateAccounts sets new passwords of the r/rw users, shadow users with the old passwords are granted the same roles during grace
+func (e *EtcdService) RotateAccounts(ctx context.Context, item *ConfigItem, grace time.Duration) ([]RotatedAccount, error) {
+	mapper, err := mapperForEtcd(item)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.preAction(ctx, mapper); err != nil {
+		return nil, err
+	}
+	rUser, rwUser, rRole, rwRole := e.userRolesFor(mapper)
+	store := storeOr(e.credentials)
+	removeShadow := func(ctx context.Context, shadow Shadow) error {
+		if _, err := e.cli.Auth.UserDelete(ctx, shadow.Account.Username); err != nil && !errors.Is(err, rpctypes.ErrUserNotFound) {
+			return errorOfGRPC(err)
+		}
+		return nil
+	}
+	sweepShadows(ctx, store, removeShadow)
+	old, rotated, err := rotateCredentials(ctx, store, rUser, rwUser)
+	if err != nil {
+		return nil, err
+	}
+	roles := []string{rRole, rwRole}
+	shadows := []Shadow{}
+	if grace > 0 {
+		expiresAt := time.Now().Add(grace)
+		for i, cred := range rotated {
+			shadows = append(shadows, Shadow{
+				User:      cred.Username,
+				Account:   Account{Username: ShadowUsername(cred.Username), Password: old[i].Password},
+				Role:      roles[i],
+				ExpiresAt: expiresAt,
+			})
+		}
+	}
+	if err := recordShadows(ctx, store, shadows); err != nil {
+		return nil, err
+	}
+	for i, cred := range rotated {
+		if grace > 0 {
+			shadow := shadows[i].Account
+			if _, err := e.cli.Auth.UserAdd(ctx, shadow.Username, shadow.Password); err != nil {
+				if _, err := e.cli.Auth.UserChangePassword(ctx, shadow.Username, shadow.Password); err != nil {
+					return nil, fmt.Errorf("set shadow user of %s failed, %w", cred.Username, errorOfGRPC(err))
+				}
+			}
+			if _, err := e.cli.Auth.UserGrantRole(ctx, shadow.Username, roles[i]); err != nil {
+				return nil, fmt.Errorf("grant role to shadow user of %s failed, %w", cred.Username, errorOfGRPC(err))
+			}
+		}
+		if _, err := e.cli.Auth.UserChangePassword(ctx, cred.Username, cred.Password); err != nil {
+			return nil, fmt.Errorf("rotate password of user %s failed, %w", cred.Username, errorOfGRPC(err))
+		}
+		if err := store.MarkApplied(ctx, cred.Username, cred.Password); err != nil {
+			return nil, err
+		}
+	}
+	if grace > 0 {
+		removeShadowsAfter(grace, store, shadows, removeShadow)
+	}
+	return rotatedAccounts(rotated, shadows, grace), nil
+}
+
 func (e *EtcdService) userRolesFor(mapper *EtcdMapper) (rUser, rwUser, rRole, rwRole string) {
-	rUser = mapper.NsPrefix() + "-r"
-	rwUser = mapper.NsPrefix() + "-rw"
+	scope := mapper.NsPrefix()
+	if e.applicationAccounts.enabled(mapper.item) {
+		scope = mapper.NsPrefix() + "/" + mapper.item.Application
+	}
+	rUser = scope + "-r"
+	rwUser = scope + "-rw"
 	rRole = rUser
 	rwRole = rwUser
 	return
 }
 
+// permissionRange returns the range of the keys granted to the accounts of mapper
+func (e *EtcdService) permissionRange(mapper *EtcdMapper) (key, end string) {
+	if e.applicationAccounts.enabled(mapper.item) {
+		prefix := mapper.ApplicationPrefix()
+		return prefix, clientv3.GetPrefixRangeEnd(prefix)
+	}
+	return mapper.NsPrefix(), clientv3.GetPrefixRangeEnd(mapper.Key())
+}
+
 func (e *EtcdService) Accounts(item *ConfigItem) ([]Account, error) {
 	mapper, err := mapperForEtcd(item)
 	if err != nil {
 		return nil, err
 	}
 	rUser, rwUser, _, _ := e.userRolesFor(mapper)
-	return []Account{
-		{
-			Username: rUser,
-			Password: GenPassword(rUser),
-		},
-		{
-			Username: rwUser,
-			Password: GenPassword(rwUser),
-		},
-	}, nil
+	return accountsOf(context.Background(), storeOr(e.credentials), rUser, rwUser)
 }
@@ -0,0 +1,380 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+	git version requred: 2.x
+	mapping:
+		directory = {gems.tenant}/{gems.project}/{gems.environment}
+		file      = {gems.key}
+		rev       = sequence number of the commit on the branch, starts from 1
+*/
+
+const (
+	DefaultGitBranch = "main"
+	gitAuthorEmail   = "kubegems.io"
+	gitCommitterName = "kubegems"
+)
+
+type GitService struct {
+	dir    string
+	remote string
+	branch string
+
+	lock sync.Mutex
+}
+
+// NewGitService opens the working repository at dir, it will be cloned from remote or initialized if not exists.
+// remote is optional, if set, every commit is pushed to it.
+func NewGitService(dir, remote, branch string) (*GitService, error) {
+	if dir == "" {
+		return nil, InvalidArgumentError("git repository dir must be specified")
+	}
+	if branch == "" {
+		branch = DefaultGitBranch
+	}
+	g := &GitService{
+		dir:    dir,
+		remote: remote,
+		branch: branch,
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		return g, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if _, err := g.git(context.Background(), nil, "init", "-q"); err != nil {
+		return nil, err
+	}
+	if _, err := g.git(context.Background(), nil, "symbolic-ref", "HEAD", "refs/heads/"+branch); err != nil {
+		return nil, err
+	}
+	if remote != "" {
+		if _, err := g.git(context.Background(), nil, "remote", "add", "origin", remote); err != nil {
+			return nil, err
+		}
+		if _, err := g.git(context.Background(), nil, "fetch", "-q", "origin"); err != nil {
+			return nil, err
+		}
+		// remote may be an empty bare repository
+		if _, err := g.git(context.Background(), nil, "rev-parse", "-q", "--verify", "refs/remotes/origin/"+branch); err == nil {
+			if _, err := g.git(context.Background(), nil, "reset", "-q", "--hard", "origin/"+branch); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return g, nil
+}
+
+func (g *GitService) BaseInfo(ctx context.Context, item *ConfigItem) (map[string]string, error) {
+	baseMap := map[string]string{
+		"provider":   "git",
+		"git_branch": g.branch,
+	}
+	if g.remote != "" {
+		baseMap["git_remote"] = g.remote
+	}
+	return baseMap, nil
+}
+
+func (g *GitService) Get(ctx context.Context, item *ConfigItem) error {
+	mapper, err := keyMapperForGit(item)
+	if err != nil {
+		return err
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	commit := "HEAD"
+	if item.Rev != 0 {
+		commits, err := g.commits(ctx)
+		if err != nil {
+			return err
+		}
+		if item.Rev < 0 || item.Rev > int64(len(commits)) {
+			return NotFoundError("rev %d of key %s not found", item.Rev, mapper.Key())
+		}
+		commit = commits[item.Rev-1]
+	}
+	out, err := g.git(ctx, nil, "show", commit+":"+mapper.Key())
+	if err != nil {
+		return NotFoundError("key %s not found at %s", mapper.Key(), commit)
+	}
+	item.Value = out
+	return nil
+}
+
+func (g *GitService) Pub(ctx context.Context, item *ConfigItem) error {
+	mapper, err := keyMapperForGit(item)
+	if err != nil {
+		return err
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	file := filepath.Join(g.dir, filepath.FromSlash(mapper.Key()))
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, []byte(item.Value), 0o644); err != nil {
+		return err
+	}
+	if _, err := g.git(ctx, nil, "add", "--", mapper.Key()); err != nil {
+		return err
+	}
+	return g.commit(ctx, item, "publish "+mapper.Key())
+}
+
+func (g *GitService) Delete(ctx context.Context, item *ConfigItem) error {
+	mapper, err := keyMapperForGit(item)
+	if err != nil {
+		return err
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if _, err := g.git(ctx, nil, "rm", "-q", "--", mapper.Key()); err != nil {
+		return NotFoundError("key %s not found", mapper.Key())
+	}
+	return g.commit(ctx, item, "delete "+mapper.Key())
+}
+
+func (g *GitService) History(ctx context.Context, item *ConfigItem) ([]*HistoryVersion, error) {
+	mapper, err := keyMapperForGit(item)
+	if err != nil {
+		return nil, err
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	commits, err := g.commits(ctx)
+	if err != nil {
+		return nil, err
+	}
+	revs := map[string]int{}
+	for idx, commit := range commits {
+		revs[commit] = idx + 1
+	}
+	out, err := g.git(ctx, nil, "log", "--format=%H %h %cI", "--", mapper.Key())
+	if err != nil {
+		return nil, err
+	}
+	ret := []*HistoryVersion{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		seps := strings.Fields(line)
+		if len(seps) != 3 {
+			continue
+		}
+		ret = append(ret, &HistoryVersion{
+			Rev:            strconv.Itoa(revs[seps[0]]),
+			Version:        seps[1],
+			LastUpdateTime: seps[2],
+		})
+	}
+	return ret, nil
+}
+
+func (g *GitService) List(ctx context.Context, opts *ListOptions) ([]*ConfigItem, error) {
+	mapper, err := mapperForGit(&opts.ConfigItem)
+	if err != nil {
+		return nil, err
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if !g.hasCommits(ctx) {
+		return []*ConfigItem{}, nil
+	}
+	out, err := g.git(ctx, nil, "ls-tree", "-r", "--name-only", "HEAD", "--", mapper.ListKey()+"/")
+	if err != nil {
+		return nil, err
+	}
+	ret := []*ConfigItem{}
+	for _, file := range strings.Split(strings.TrimSpace(out), "\n") {
+		seps := strings.Split(file, "/")
+		if len(seps) != 4 {
+			continue
+		}
+		value, err := g.git(ctx, nil, "show", "HEAD:"+file)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, &ConfigItem{
+			Tenant:      seps[0],
+			Project:     seps[1],
+			Environment: seps[2],
+			Key:         seps[3],
+			Value:       value,
+		})
+	}
+	return ret, nil
+}
+
+func (g *GitService) Accounts(item *ConfigItem) ([]Account, error) {
+	return []Account{}, nil
+}
+
+func (g *GitService) Listener(ctx context.Context, item *ConfigItem) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+func (g *GitService) commit(ctx context.Context, item *ConfigItem, message string) error {
+	if _, err := g.git(ctx, nil, "diff", "--cached", "--quiet"); err == nil {
+		// nothing changed
+		return nil
+	}
+	author := item.LastUpdateUser
+	if author == "" {
+		author = gitCommitterName
+	}
+	env := []string{
+		"GIT_AUTHOR_NAME=" + author,
+		"GIT_AUTHOR_EMAIL=" + author + "@" + gitAuthorEmail,
+	}
+	previous := ""
+	if g.hasCommits(ctx) {
+		out, err := g.git(ctx, nil, "rev-parse", "HEAD")
+		if err != nil {
+			return err
+		}
+		previous = strings.TrimSpace(out)
+	}
+	if _, err := g.git(ctx, env, "commit", "-q", "-m", message); err != nil {
+		return err
+	}
+	if g.remote == "" {
+		return nil
+	}
+	if _, err := g.git(ctx, nil, "push", "-q", "origin", "HEAD:refs/heads/"+g.branch); err != nil {
+		// the commit not pushed is dropped, otherwise the following pushes are rejected as non-fast-forward
+		if resetErr := g.resetToRemote(ctx, previous); resetErr != nil {
+			return fmt.Errorf("%w, and reset to remote failed, %v", err, resetErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// resetToRemote resets the branch to the remote one, or to previous if the remote has no such branch yet.
+// the remote may be unavailable, the branch is reset to the last one fetched then.
+func (g *GitService) resetToRemote(ctx context.Context, previous string) error {
+	_, _ = g.git(ctx, nil, "fetch", "-q", "origin")
+	target := previous
+	if _, err := g.git(ctx, nil, "rev-parse", "-q", "--verify", "refs/remotes/origin/"+g.branch); err == nil {
+		target = "origin/" + g.branch
+	}
+	if target != "" {
+		_, err := g.git(ctx, nil, "reset", "-q", "--hard", target)
+		return err
+	}
+	// nothing was pushed, drop the first commit
+	if _, err := g.git(ctx, nil, "update-ref", "-d", "HEAD"); err != nil {
+		return err
+	}
+	if _, err := g.git(ctx, nil, "read-tree", "--empty"); err != nil {
+		return err
+	}
+	_, err := g.git(ctx, nil, "clean", "-q", "-f", "-d")
+	return err
+}
+
+// commits returns commit hashes of the branch, the oldest first
+func (g *GitService) commits(ctx context.Context) ([]string, error) {
+	if !g.hasCommits(ctx) {
+		return []string{}, nil
+	}
+	out, err := g.git(ctx, nil, "rev-list", "--first-parent", "--reverse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(out), nil
+}
+
+func (g *GitService) hasCommits(ctx context.Context) bool {
+	_, err := g.git(ctx, nil, "rev-parse", "-q", "--verify", "HEAD")
+	return err == nil
+}
+
+func (g *GitService) git(ctx context.Context, env []string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = g.dir
+	cmd.Env = append(os.Environ(),
+		"GIT_COMMITTER_NAME="+gitCommitterName,
+		"GIT_COMMITTER_EMAIL="+gitCommitterName+"@"+gitAuthorEmail,
+		"GIT_TERMINAL_PROMPT=0",
+	)
+	cmd.Env = append(cmd.Env, env...)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return "", errorOfGit(fmt.Errorf("git %s failed, %v, (%s)", args[0], err, strings.TrimSpace(stderr.String())), stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+// errorOfGit classifies the error of git by its stderr, the remote is the backend of git
+func errorOfGit(err error, stderr string) error {
+	contains := func(subs ...string) bool {
+		for _, sub := range subs {
+			if strings.Contains(stderr, sub) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case contains("[rejected]", "non-fast-forward", "fetch first"):
+		return newError(ErrorCodeConflict, err, "remote changed")
+	case contains("Authentication failed", "Permission denied", "could not read Username"):
+		return newError(ErrorCodeUnauthorized, err, "access remote denied")
+	case contains("Could not resolve host", "unable to access", "Connection refused", "Could not read from remote repository"):
+		return newError(ErrorCodeBackendUnavailable, err, "remote unavailable")
+	default:
+		return err
+	}
+}
+
+type GitMapper struct {
+	item *ConfigItem
+}
+
+func mapperForGit(item *ConfigItem) (*GitMapper, error) {
+	if item.Tenant == "" || item.Project == "" {
+		return nil, InvalidArgumentError("tenant and project must be specified")
+	}
+	for _, seg := range []string{item.Tenant, item.Project, item.Environment, item.Key} {
+		if strings.Contains(seg, "/") || seg == "." || seg == ".." {
+			return nil, InvalidArgumentError("invalid path segment %s", seg)
+		}
+	}
+	return &GitMapper{
+		item: item,
+	}, nil
+}
+
+// keyMapperForGit is the mapper of a single key, whose environment and key must be specified
+func keyMapperForGit(item *ConfigItem) (*GitMapper, error) {
+	if item.Environment == "" || item.Key == "" {
+		return nil, InvalidArgumentError("environment and key must be specified")
+	}
+	return mapperForGit(item)
+}
+
+func (c *GitMapper) Key() string {
+	return fmt.Sprintf("%s/%s/%s/%s", c.item.Tenant, c.item.Project, c.item.Environment, c.item.Key)
+}
+
+func (c *GitMapper) ListKey() string {
+	if c.item.Environment == "" {
+		return fmt.Sprintf("%s/%s", c.item.Tenant, c.item.Project)
+	} else {
+		return fmt.Sprintf("%s/%s/%s", c.item.Tenant, c.item.Project, c.item.Environment)
+	}
+}
@@ -0,0 +1,209 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestGitService(t *testing.T) (*GitService, string) {
+	remote := filepath.Join(t.TempDir(), "configs.git")
+	if out, err := exec.Command("git", "init", "-q", "--bare", remote).CombinedOutput(); err != nil {
+		t.Fatalf("init bare repository failed, %v, %s", err, out)
+	}
+	g, err := NewGitService(filepath.Join(t.TempDir(), "work"), remote, "")
+	if err != nil {
+		t.Fatalf("NewGitService() error = %v", err)
+	}
+	return g, remote
+}
+
+func TestNewGitService(t *testing.T) {
+	remote := filepath.Join(t.TempDir(), "configs.git")
+	exec.Command("git", "init", "-q", "--bare", remote).Run()
+	tests := []struct {
+		name    string
+		dir     string
+		remote  string
+		wantErr bool
+	}{
+		{
+			name: "test new gitservice success",
+			dir:  filepath.Join(t.TempDir(), "local"),
+		},
+		{
+			name:   "test new gitservice success with bare remote",
+			dir:    filepath.Join(t.TempDir(), "work"),
+			remote: remote,
+		},
+		{
+			name:    "test new gitservice failed with empty dir",
+			wantErr: true,
+		},
+		{
+			name:    "test new gitservice failed with not exist remote",
+			dir:     filepath.Join(t.TempDir(), "work"),
+			remote:  filepath.Join(t.TempDir(), "not-exist.git"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewGitService(tt.dir, tt.remote, "")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewGitService() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGitService_PubGetDelete(t *testing.T) {
+	g, remote := newTestGitService(t)
+	ctx := context.Background()
+	item := &ConfigItem{Tenant: "ten1", Project: "proj1", Environment: "dev", Key: "config", Value: "v1", LastUpdateUser: "admin"}
+	if err := g.Pub(ctx, item); err != nil {
+		t.Fatalf("GitService.Pub() error = %v", err)
+	}
+	item.Value = "v2"
+	if err := g.Pub(ctx, item); err != nil {
+		t.Fatalf("GitService.Pub() error = %v", err)
+	}
+	// publish the same value again won't create a commit
+	if err := g.Pub(ctx, item); err != nil {
+		t.Fatalf("GitService.Pub() error = %v", err)
+	}
+
+	got := &ConfigItem{Tenant: "ten1", Project: "proj1", Environment: "dev", Key: "config"}
+	if err := g.Get(ctx, got); err != nil || got.Value != "v2" {
+		t.Errorf("GitService.Get() = %s, error = %v", got.Value, err)
+	}
+	got.Rev = 1
+	if err := g.Get(ctx, got); err != nil || got.Value != "v1" {
+		t.Errorf("GitService.Get() with rev = %s, error = %v", got.Value, err)
+	}
+	got.Rev = 10
+	if err := g.Get(ctx, got); err == nil {
+		t.Errorf("GitService.Get() with not exist rev should failed")
+	}
+
+	history, err := g.History(ctx, item)
+	if err != nil {
+		t.Fatalf("GitService.History() error = %v", err)
+	}
+	if len(history) != 2 || history[0].Rev != "2" || history[1].Rev != "1" {
+		t.Errorf("GitService.History() = %v", history)
+	}
+
+	out, err := exec.Command("git", "--git-dir", remote, "log", "--format=%an", DefaultGitBranch).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git log of remote failed, %v, %s", err, out)
+	}
+	if strings.Fields(string(out))[0] != "admin" {
+		t.Errorf("commit author = %s, want admin", out)
+	}
+
+	if err := g.Delete(ctx, item); err != nil {
+		t.Errorf("GitService.Delete() error = %v", err)
+	}
+	if err := g.Delete(ctx, item); err == nil {
+		t.Errorf("GitService.Delete() not exist key should failed")
+	}
+	if err := g.Get(ctx, &ConfigItem{Tenant: "ten1", Project: "proj1", Environment: "dev", Key: "config"}); err == nil {
+		t.Errorf("GitService.Get() deleted key should failed")
+	}
+}
+
+func TestGitService_List(t *testing.T) {
+	g, _ := newTestGitService(t)
+	ctx := context.Background()
+	for _, item := range []*ConfigItem{
+		{Tenant: "ten1", Project: "proj1", Environment: "dev", Key: "a", Value: "a"},
+		{Tenant: "ten1", Project: "proj1", Environment: "dev", Key: "b", Value: "b"},
+		{Tenant: "ten1", Project: "proj1", Environment: "prod", Key: "a", Value: "a"},
+		{Tenant: "ten1", Project: "proj2", Environment: "dev", Key: "a", Value: "a"},
+	} {
+		if err := g.Pub(ctx, item); err != nil {
+			t.Fatalf("GitService.Pub() error = %v", err)
+		}
+	}
+	tests := []struct {
+		name    string
+		opts    *ListOptions
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "test list environment",
+			opts: &ListOptions{ConfigItem: ConfigItem{Tenant: "ten1", Project: "proj1", Environment: "dev"}},
+			want: 2,
+		},
+		{
+			name: "test list project",
+			opts: &ListOptions{ConfigItem: ConfigItem{Tenant: "ten1", Project: "proj1"}},
+			want: 3,
+		},
+		{
+			name:    "test list failed with no tenant",
+			opts:    &ListOptions{ConfigItem: ConfigItem{Project: "proj1"}},
+			wantErr: true,
+		},
+		{
+			name:    "test list failed with invalid environment",
+			opts:    &ListOptions{ConfigItem: ConfigItem{Tenant: "ten1", Project: "proj1", Environment: ".."}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := g.List(ctx, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GitService.List() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != tt.want {
+				t.Errorf("GitService.List() got %d items, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestGitService_PushRejected(t *testing.T) {
+	g, remote := newTestGitService(t)
+	other, err := NewGitService(filepath.Join(t.TempDir(), "other"), remote, "")
+	if err != nil {
+		t.Fatalf("NewGitService() error = %v", err)
+	}
+	ctx := context.Background()
+	item := func(key string) *ConfigItem {
+		return &ConfigItem{Tenant: "ten1", Project: "proj1", Environment: "dev", Key: key, Value: key}
+	}
+	if err := g.Pub(ctx, item("a")); err != nil {
+		t.Fatalf("GitService.Pub() error = %v", err)
+	}
+	// other has not fetched a, its push is rejected
+	if err := other.Pub(ctx, item("b")); !errors.Is(err, ErrConflict) {
+		t.Fatalf("GitService.Pub() on a stale branch error = %v, want Conflict", err)
+	}
+	if err := other.Get(ctx, item("b")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GitService.Get() of the rejected key error = %v, want NotFound", err)
+	}
+	// the rejected commit is dropped, so the next write is pushed on top of the remote
+	if err := other.Pub(ctx, item("b")); err != nil {
+		t.Fatalf("GitService.Pub() after the rejection error = %v", err)
+	}
+	if err := other.Get(ctx, item("a")); err != nil {
+		t.Errorf("GitService.Get() of the remote key error = %v", err)
+	}
+
+	for _, invalid := range []*ConfigItem{
+		{Tenant: "ten1", Project: "proj1", Key: "a"},
+		{Tenant: "ten1", Project: "proj1", Environment: "dev"},
+	} {
+		if err := g.Pub(ctx, invalid); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("GitService.Pub(%v) error = %v, want InvalidArgument", invalid, err)
+		}
+	}
+}
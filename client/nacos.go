@@ -4,12 +4,15 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -42,21 +45,104 @@ const (
 
 type traverseFunc func(page, size int) error
 
-type NacosService struct {
-	client    *http.Client
-	addr      string
-	username  string
-	password  string
+// NacosTimeouts are the timeouts of each kind of nacos operation, zero means no timeout except the request context
+type NacosTimeouts struct {
+	Login time.Duration
+	// Read is the timeout of get, list, history and listener
+	Read time.Duration
+	// Write is the timeout of pub and delete
+	Write time.Duration
+	// Sync is the timeout of ensuring tenant, users, roles and perms exist before each operation
+	Sync time.Duration
+}
+
+var DefaultNacosTimeouts = NacosTimeouts{
+	Login: 5 * time.Second,
+	Read:  10 * time.Second,
+	Write: 10 * time.Second,
+	Sync:  30 * time.Second,
+}
+
+// DefaultNacosHealthCheckInterval is the interval to check the nodes of a nacos cluster with more than one node
+const DefaultNacosHealthCheckInterval = 10 * time.Second
+
+const nacosReadinessPath = "/nacos/v1/console/health/readiness"
+
+type NacosOption func(nacos *NacosService)
+
+func WithNacosTimeouts(timeouts NacosTimeouts) NacosOption {
+	return func(nacos *NacosService) {
+		nacos.timeouts = timeouts
+	}
+}
+
+// WithNacosHealthCheckInterval sets the interval of health checks, zero disables them
+func WithNacosHealthCheckInterval(interval time.Duration) NacosOption {
+	return func(nacos *NacosService) {
+		nacos.healthCheckInterval = interval
+	}
+}
+
+// WithNacosTLS connects nacos with https, client certificates are used for mTLS.
+// the base round tripper must be nil or an *http.Transport to apply the tls.
+func WithNacosTLS(tlsConfig *TLSConfig) NacosOption {
+	return func(nacos *NacosService) {
+		nacos.tlsConfig = tlsConfig
+	}
+}
+
+// WithNacosApplicationAccounts enables per-application accounts for the projects f returns true
+func WithNacosApplicationAccounts(f ApplicationAccountsFunc) NacosOption {
+	return func(nacos *NacosService) {
+		nacos.applicationAccounts = f
+	}
+}
+
+// WithNacosCredentials sets the store of the passwords of the accounts created in nacos
+func WithNacosCredentials(store CredentialStore) NacosOption {
+	return func(nacos *NacosService) {
+		nacos.credentials = store
+	}
+}
+
+// nacosNode is a member of the nacos cluster, each node keeps its own login token
+type nacosNode struct {
+	addr string
+
+	lock      sync.Mutex
 	authInfo  *AuthInfo
 	lastLogin time.Time
-	once      sync.Once
+	// down is set when the node can not be connected, until it passes a health check or serves a request
+	down bool
+}
+
+type nacosNodeKey struct{}
+
+type NacosService struct {
+	client   *http.Client
+	username string
+	password string
+	timeouts NacosTimeouts
+	once     sync.Once
+
+	nodes               []*nacosNode
+	nodesLock           sync.Mutex
+	preferred           int
+	healthCheckInterval time.Duration
+	stop                chan struct{}
+	stopOnce            sync.Once
 
 	baseRoundTripper http.RoundTripper
+	tlsConfig        *TLSConfig
+	credentials      CredentialStore
+	transport        http.RoundTripper // baseRoundTripper with tls applied
 	tenants          []*NacosNamespace
 	users            []*NacosUser
 	perms            []*NacosPerm
 	roles            []*NacosRole
 
+	applicationAccounts ApplicationAccountsFunc
+
 	tenantsLastUpdateTime *time.Time
 	usersLastUpdateTime   *time.Time
 	permsLastUpdateTime   *time.Time
@@ -81,13 +167,23 @@ func (rw roundTripWrapper) RoundTrip(req *http.Request) (*http.Response, error)
 	return rw.innerRoundWrapper.RoundTrip(req)
 }
 
-func NewNacosService(addr, username, password string, baseRoundTripper http.RoundTripper) (*NacosService, error) {
+// NewNacosService creates the service of a nacos cluster, requests are sent to a healthy node of endpoints
+func NewNacosService(endpoints []string, username, password string, baseRoundTripper http.RoundTripper, opts ...NacosOption) (*NacosService, error) {
+	nodes := []*nacosNode{}
+	for _, endpoint := range endpoints {
+		if endpoint = strings.TrimSuffix(strings.TrimSpace(endpoint), "/"); endpoint != "" {
+			nodes = append(nodes, &nacosNode{addr: endpoint})
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, InvalidArgumentError("nacos endpoints must be specified")
+	}
 	lastUpdateTime := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.Local)
 	nacos := &NacosService{
 		client:           &http.Client{},
 		username:         username,
 		password:         password,
-		addr:             addr,
+		nodes:            nodes,
 		once:             sync.Once{},
 		baseRoundTripper: baseRoundTripper,
 		tenants:          []*NacosNamespace{},
@@ -100,44 +196,75 @@ func NewNacosService(addr, username, password string, baseRoundTripper http.Roun
 		permsLastUpdateTime:   &lastUpdateTime,
 		rolesLastUpdateTime:   &lastUpdateTime,
 		syncLock:              sync.Mutex{},
+		timeouts:              DefaultNacosTimeouts,
+		healthCheckInterval:   DefaultNacosHealthCheckInterval,
+		stop:                  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(nacos)
 	}
-	if err := nacos.login(); err != nil {
+	tlsCfg, err := nacos.tlsConfig.Build()
+	if err != nil {
+		return nil, err
+	}
+	if nacos.transport, err = transportWithTLS(baseRoundTripper, tlsCfg); err != nil {
+		return nil, err
+	}
+	// login the first reachable node, the others login when first used
+	if err := nacos.loginAny(context.Background()); err != nil {
 		return nil, err
 	}
 	fn := func(r *http.Request) (*url.URL, error) {
-		if time.Now().Unix()-nacos.lastLogin.Unix() >= nacos.authInfo.TokenTTL {
-			err := nacos.login()
-			if err != nil {
-				return r.URL, err
-			}
+		node, ok := r.Context().Value(nacosNodeKey{}).(*nacosNode)
+		if !ok {
+			return r.URL, nil
+		}
+		token, err := nacos.tokenOf(r.Context(), node)
+		if err != nil {
+			return r.URL, err
 		}
 		q := r.URL.Query()
-		q.Add("accessToken", nacos.authInfo.AccessToken)
+		q.Add("accessToken", token)
 		r.URL.RawQuery = q.Encode()
 		return r.URL, nil
 	}
 	if baseRoundTripper != nil {
 		roundTripper := roundTripWrapper{
 			proxy:             fn,
-			innerRoundWrapper: baseRoundTripper,
+			innerRoundWrapper: nacos.transport,
 		}
 		nacos.client.Transport = roundTripper
+	} else {
+		nacos.client.Transport = nacos.transport
+	}
+	if len(nodes) > 1 && nacos.healthCheckInterval > 0 {
+		go nacos.healthCheck()
 	}
 	return nacos, nil
 }
 
+// Close stops the health checks of the nodes
+func (nacos *NacosService) Close() error {
+	nacos.stopOnce.Do(func() {
+		if nacos.stop != nil {
+			close(nacos.stop)
+		}
+	})
+	return nil
+}
+
 func (nacos *NacosService) getHistory(ctx context.Context, mapper *NacosDataMapper) (string, error) {
-	resp, err := nacos.client.Get(nacos.urlFor(mapper, HISTORY_PATH))
+	resp, err := nacos.do(ctx, http.MethodGet, nacos.urlFor(mapper, HISTORY_PATH), nil)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("get history failed, code is %d", resp.StatusCode)
+		return "", errorOfStatus(resp.StatusCode, "get history failed")
 	}
 	data := &NacosConfigItem{}
 	if err := json.NewDecoder(resp.Body).Decode(data); err != nil {
-		return "", err
+		return "", errorOfContext(ctx, err)
 	}
 	return data.Content, nil
 }
@@ -160,9 +287,11 @@ func (nacos *NacosService) Get(ctx context.Context, item *ConfigItem) error {
 	if err != nil {
 		return err
 	}
-	if err := nacos.preAction(mapper); err != nil {
+	if err := nacos.preAction(ctx, mapper); err != nil {
 		return err
 	}
+	ctx, cancel := withTimeout(ctx, nacos.timeouts.Read)
+	defer cancel()
 	if mapper.Rev() != "" {
 		content, err := nacos.getHistory(ctx, mapper)
 		if err != nil {
@@ -172,13 +301,17 @@ func (nacos *NacosService) Get(ctx context.Context, item *ConfigItem) error {
 		return nil
 
 	}
-	resp, err := nacos.client.Get(nacos.urlFor(mapper, CONFIG_PATH))
+	resp, err := nacos.do(ctx, http.MethodGet, nacos.urlFor(mapper, CONFIG_PATH), nil)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errorOfStatus(resp.StatusCode, "get config %s failed", mapper.DataID())
+	}
 	content, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return errorOfContext(ctx, err)
 	}
 	item.Value = string(content)
 	return nil
@@ -189,10 +322,15 @@ func (nacos *NacosService) Pub(ctx context.Context, item *ConfigItem) error {
 	if err != nil {
 		return err
 	}
-	if err := nacos.preAction(mapper); err != nil {
+	if err := nacos.applicationAccounts.checkKey(item); err != nil {
+		return err
+	}
+	if err := nacos.preAction(ctx, mapper); err != nil {
 		return err
 	}
-	resp, err := nacos.client.PostForm(
+	ctx, cancel := withTimeout(ctx, nacos.timeouts.Write)
+	defer cancel()
+	resp, err := nacos.do(ctx, http.MethodPost,
 		nacos.urlFor(mapper, CONFIG_PATH),
 		url.Values{"content": []string{item.Value}},
 	)
@@ -202,7 +340,7 @@ func (nacos *NacosService) Pub(ctx context.Context, item *ConfigItem) error {
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		content, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("create config failed, code is %d, err is (%s)", resp.StatusCode, content)
+		return errorOfStatus(resp.StatusCode, "create config failed, err is (%s)", content)
 	}
 	return nil
 }
@@ -212,16 +350,21 @@ func (nacos *NacosService) Delete(ctx context.Context, item *ConfigItem) error {
 	if err != nil {
 		return err
 	}
-	if err := nacos.preAction(mapper); err != nil {
+	if err := nacos.applicationAccounts.checkKey(item); err != nil {
 		return err
 	}
-	req, _ := http.NewRequest(http.MethodDelete, nacos.urlFor(mapper, CONFIG_PATH), nil)
-	resp, err := nacos.client.Do(req)
+	if err := nacos.preAction(ctx, mapper); err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx, nacos.timeouts.Write)
+	defer cancel()
+	resp, err := nacos.do(ctx, http.MethodDelete, nacos.urlFor(mapper, CONFIG_PATH), nil)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("delete config failed, code is %d", resp.StatusCode)
+		return errorOfStatus(resp.StatusCode, "delete config failed")
 	}
 	return nil
 }
@@ -236,22 +379,23 @@ func (nacos *NacosService) History(ctx context.Context, item *ConfigItem) ([]*Hi
 	q.Add("group", mapper.Group())
 	q.Add("dataId", mapper.DataID())
 	q.Add("tenant", mapper.TenantID())
-	uri := nacos.addr + HISTORY_PATH + "?" + q.Encode()
-	resp, err := nacos.client.Get(uri)
-
+	uri := HISTORY_PATH + "?" + q.Encode()
+	ctx, cancel := withTimeout(ctx, nacos.timeouts.Read)
+	defer cancel()
+	resp, err := nacos.do(ctx, http.MethodGet, uri, nil)
 	if err != nil {
 		return nil, err
 	}
-
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("get history of config failed, code is %d", resp.StatusCode)
+		return nil, errorOfStatus(resp.StatusCode, "get history of config failed")
 	}
 	versions := &[]*NacosConfigItem{}
 	data := NacosListStruct{
 		PageItems: versions,
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return nil, fmt.Errorf("decode history of config failed, %s", err.Error())
+		return nil, errorOfContext(ctx, fmt.Errorf("decode history of config failed, %s", err.Error()))
 	}
 	ret := make([]*HistoryVersion, len(*versions))
 	for idx, ver := range *versions {
@@ -290,20 +434,21 @@ func (nacos *NacosService) List(ctx context.Context, opts *ListOptions) ([]*Conf
 	if opts.Application != "" {
 		q.Add("appName", opts.Application)
 	}
-	req, _ := http.NewRequest(http.MethodGet, nacos.addr+CONFIG_PATH, nil)
-	req.URL.RawQuery = q.Encode()
-	resp, err := nacos.client.Do(req)
+	ctx, cancel := withTimeout(ctx, nacos.timeouts.Read)
+	defer cancel()
+	resp, err := nacos.do(ctx, http.MethodGet, CONFIG_PATH+"?"+q.Encode(), nil)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("list config failed, code is %d", resp.StatusCode)
+		return nil, errorOfStatus(resp.StatusCode, "list config failed")
 	}
 	respData := NacosListStruct{
 		PageItems: &[]*NacosConfigItem{},
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
-		return nil, err
+		return nil, errorOfContext(ctx, err)
 	}
 	ret := []*ConfigItem{}
 	cmlist := respData.PageItems.(*[]*NacosConfigItem)
@@ -329,16 +474,7 @@ func (nacos *NacosService) Accounts(item *ConfigItem) ([]Account, error) {
 		return nil, err
 	}
 	rUser, rwUser, _, _, _ := nacos.userRolesFor(mapper)
-	return []Account{
-		{
-			Username: rUser,
-			Password: GenPassword(rUser),
-		},
-		{
-			Username: rwUser,
-			Password: GenPassword(rwUser),
-		},
-	}, nil
+	return accountsOf(context.Background(), storeOr(nacos.credentials), rUser, rwUser)
 }
 
 func (nacos *NacosService) Listener(ctx context.Context, item *ConfigItem) (map[string]string, error) {
@@ -346,15 +482,18 @@ func (nacos *NacosService) Listener(ctx context.Context, item *ConfigItem) (map[
 	if err != nil {
 		return nil, err
 	}
-	resp, err := nacos.client.Get(nacos.urlFor(mapper, LISTENER_PATH))
+	ctx, cancel := withTimeout(ctx, nacos.timeouts.Read)
+	defer cancel()
+	resp, err := nacos.do(ctx, http.MethodGet, nacos.urlFor(mapper, LISTENER_PATH), nil)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	respData := &ListenerResp{
 		ListenersGroupkeyStatus: map[string]string{},
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
-		return nil, err
+		return nil, errorOfContext(ctx, err)
 	}
 	return respData.ListenersGroupkeyStatus, nil
 }
@@ -425,7 +564,7 @@ type NacosConfigItem struct {
 	LastModifiedTime string `json:"lastModifiedTime"`
 }
 
-func (nacos *NacosService) preAction(mapper *NacosDataMapper) error {
+func (nacos *NacosService) preAction(ctx context.Context, mapper *NacosDataMapper) error {
 	/*
 		每次操作前, 需要确保外围数据存在
 		1. 是否存在租户, 不存在就创建
@@ -435,11 +574,20 @@ func (nacos *NacosService) preAction(mapper *NacosDataMapper) error {
 
 		五分钟缓存过期
 	*/
+	if nacos.applicationAccounts.enabled(mapper.item) {
+		// the accounts of the environment are kept for the shared configs
+		if err := nacos.preAction(ctx, &NacosDataMapper{item: environmentItem(mapper.item)}); err != nil {
+			return err
+		}
+	}
 	var (
 		existTenant, existRUser, existRWUser, existRRole, existRWRole, existRPerm, existRWPerm bool
 	)
 	rUser, rwUser, rRole, rwRole, resource := nacos.userRolesFor(mapper)
 	tenantName, tenantID := mapper.Tenant(), mapper.TenantID()
+	if err := nacos.applyCredentials(ctx, rUser, rwUser); err != nil {
+		return err
+	}
 	now := time.Now()
 	if now.Sub(*nacos.tenantsLastUpdateTime).Nanoseconds() > TenantCacheTime.Nanoseconds() {
 		existTenant = false
@@ -510,12 +658,14 @@ func (nacos *NacosService) preAction(mapper *NacosDataMapper) error {
 		return nil
 	}
 
+	ctx, cancel := withTimeout(ctx, nacos.timeouts.Sync)
+	defer cancel()
 	nacos.syncLock.Lock()
 	defer nacos.syncLock.Unlock()
 	if !existTenant {
-		tenantList, err := nacos.listTenant()
+		tenantList, err := nacos.listTenant(ctx)
 		if err != nil {
-			return fmt.Errorf("list tenant failed, %s", err)
+			return fmt.Errorf("list tenant failed, %w", err)
 		}
 		for _, ten := range tenantList {
 			if ten.Namespace == tenantID && ten.NamepsaceShowName == tenantName {
@@ -523,12 +673,12 @@ func (nacos *NacosService) preAction(mapper *NacosDataMapper) error {
 				goto TenantCheckDone
 			}
 		}
-		if err := nacos.createTenant(mapper.TenantID(), tenantName); err != nil {
-			return fmt.Errorf("create tenant failed, %s", err)
+		if err := nacos.createTenant(ctx, mapper.TenantID(), tenantName); err != nil {
+			return fmt.Errorf("create tenant failed, %w", err)
 		}
-		newTenantList, err := nacos.listTenant()
+		newTenantList, err := nacos.listTenant(ctx)
 		if err != nil {
-			return fmt.Errorf("list tenant failed, %s", err)
+			return fmt.Errorf("list tenant failed, %w", err)
 		}
 		nacos.tenants = newTenantList
 		nacos.tenantsLastUpdateTime = &now
@@ -537,9 +687,9 @@ TenantCheckDone:
 
 	if !existRUser || !existRWUser {
 		var extr, extrw bool
-		userList, err := nacos.listUsers()
+		userList, err := nacos.listUsers(ctx)
 		if err != nil {
-			return fmt.Errorf("list users failed, %s", err)
+			return fmt.Errorf("list users failed, %w", err)
 		}
 		for _, user := range userList {
 			if user.Username == rUser {
@@ -553,18 +703,18 @@ TenantCheckDone:
 			}
 		}
 		if !extr {
-			if err := nacos.createUser(rUser); err != nil {
-				return fmt.Errorf("create read user failed, %s", err)
+			if err := nacos.createUser(ctx, rUser); err != nil {
+				return fmt.Errorf("create read user failed, %w", err)
 			}
 		}
 		if !extrw {
-			if err := nacos.createUser(rwUser); err != nil {
-				return fmt.Errorf("create operator user failed, %s", err)
+			if err := nacos.createUser(ctx, rwUser); err != nil {
+				return fmt.Errorf("create operator user failed, %w", err)
 			}
 		}
-		newUserList, err := nacos.listUsers()
+		newUserList, err := nacos.listUsers(ctx)
 		if err != nil {
-			return fmt.Errorf("list user failed, %s", err)
+			return fmt.Errorf("list user failed, %w", err)
 		}
 		nacos.users = newUserList
 		nacos.usersLastUpdateTime = &now
@@ -573,9 +723,9 @@ UserCheckDone:
 
 	if !existRRole || !existRWRole {
 		var extr, extrw bool
-		roleList, err := nacos.listRoles()
+		roleList, err := nacos.listRoles(ctx)
 		if err != nil {
-			return fmt.Errorf("list role failed, %s", err)
+			return fmt.Errorf("list role failed, %w", err)
 		}
 		for _, role := range roleList {
 			if role.Role == rRole && role.Username == rUser {
@@ -589,18 +739,18 @@ UserCheckDone:
 			}
 		}
 		if !extr {
-			if err := nacos.createRole(rRole, rUser); err != nil {
-				return fmt.Errorf("create read role failed, %s", err)
+			if err := nacos.createRole(ctx, rRole, rUser); err != nil {
+				return fmt.Errorf("create read role failed, %w", err)
 			}
 		}
 		if !extrw {
-			if err := nacos.createRole(rwRole, rwUser); err != nil {
-				return fmt.Errorf("create operator role failed, %s", err)
+			if err := nacos.createRole(ctx, rwRole, rwUser); err != nil {
+				return fmt.Errorf("create operator role failed, %w", err)
 			}
 		}
-		newRoleList, err := nacos.listRoles()
+		newRoleList, err := nacos.listRoles(ctx)
 		if err != nil {
-			return fmt.Errorf("list role failed, %s", err)
+			return fmt.Errorf("list role failed, %w", err)
 		}
 		nacos.roles = newRoleList
 		nacos.rolesLastUpdateTime = &now
@@ -609,9 +759,9 @@ RoleCheckDone:
 
 	if !existRPerm || !existRWPerm {
 		var extr, extrw bool
-		permList, err := nacos.listPerms()
+		permList, err := nacos.listPerms(ctx)
 		if err != nil {
-			return fmt.Errorf("list perm failed, %s", err)
+			return fmt.Errorf("list perm failed, %w", err)
 		}
 		for _, perm := range permList {
 			if perm.Role == rRole && perm.Action == "r" && perm.Resource == resource {
@@ -625,18 +775,18 @@ RoleCheckDone:
 			}
 		}
 		if !extr {
-			if err := nacos.createPerm(rRole, resource, "r"); err != nil {
-				return fmt.Errorf("create read perm failed, %s", err)
+			if err := nacos.createPerm(ctx, rRole, resource, "r"); err != nil {
+				return fmt.Errorf("create read perm failed, %w", err)
 			}
 		}
 		if !extrw {
-			if err := nacos.createPerm(rwRole, resource, "rw"); err != nil {
-				return fmt.Errorf("create operator perm failed, %s", err)
+			if err := nacos.createPerm(ctx, rwRole, resource, "rw"); err != nil {
+				return fmt.Errorf("create operator perm failed, %w", err)
 			}
 		}
-		newPermList, err := nacos.listPerms()
+		newPermList, err := nacos.listPerms(ctx)
 		if err != nil {
-			return fmt.Errorf("list perm failed, %s", err)
+			return fmt.Errorf("list perm failed, %w", err)
 		}
 		nacos.perms = newPermList
 		nacos.permsLastUpdateTime = &now
@@ -645,54 +795,53 @@ PermCheckDone:
 	return nil
 }
 
-func (nacos *NacosService) listUsers() ([]*NacosUser, error) {
+func (nacos *NacosService) listUsers(ctx context.Context) ([]*NacosUser, error) {
 	ret := []*NacosUser{}
-	err := nacos.listFunc(USER_PATH, func() interface{} { return &[]*NacosUser{} }, func(ptr interface{}) {
+	err := nacos.listFunc(ctx, USER_PATH, func() interface{} { return &[]*NacosUser{} }, func(ptr interface{}) {
 		list := ptr.(*[]*NacosUser)
 		ret = append(ret, *list...)
 	})
 	return ret, err
 }
 
-func (nacos *NacosService) listPerms() ([]*NacosPerm, error) {
+func (nacos *NacosService) listPerms(ctx context.Context) ([]*NacosPerm, error) {
 	ret := []*NacosPerm{}
-	nacos.listFunc(PERM_PATH, func() interface{} { return &[]*NacosPerm{} }, func(ptr interface{}) {
+	err := nacos.listFunc(ctx, PERM_PATH, func() interface{} { return &[]*NacosPerm{} }, func(ptr interface{}) {
 		list := ptr.(*[]*NacosPerm)
 		ret = append(ret, *list...)
 	})
-	return ret, nil
+	return ret, err
 }
 
-func (nacos *NacosService) listRoles() ([]*NacosRole, error) {
+func (nacos *NacosService) listRoles(ctx context.Context) ([]*NacosRole, error) {
 	ret := []*NacosRole{}
-	nacos.listFunc(ROLE_PATH, func() interface{} { return &[]*NacosRole{} }, func(ptr interface{}) {
+	err := nacos.listFunc(ctx, ROLE_PATH, func() interface{} { return &[]*NacosRole{} }, func(ptr interface{}) {
 		list := ptr.(*[]*NacosRole)
 		ret = append(ret, *list...)
 	})
-	return ret, nil
+	return ret, err
 }
 
-func (nacos *NacosService) listFunc(path string, f1 func() interface{}, f2 func(interface{})) error {
+func (nacos *NacosService) listFunc(ctx context.Context, path string, f1 func() interface{}, f2 func(interface{})) error {
 	var f traverseFunc
 	f = func(page, size int) error {
-		req, _ := http.NewRequest(http.MethodGet, nacos.addr+path, nil)
 		q := url.Values{}
 		q.Add("pageNo", strconv.Itoa(page))
 		q.Add("pageSize", strconv.Itoa(size))
-		req.URL.RawQuery = q.Encode()
-		resp, err := nacos.client.Do(req)
+		resp, err := nacos.do(ctx, http.MethodGet, path+"?"+q.Encode(), nil)
 		if err != nil {
-			return nil
+			return err
 		}
+		defer resp.Body.Close()
 		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("failed to list users, code is %d", resp.StatusCode)
+			return errorOfStatus(resp.StatusCode, "failed to list users")
 		}
 		ptr := f1()
 		respData := NacosListStruct{
 			PageItems: ptr,
 		}
 		if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
-			return err
+			return errorOfContext(ctx, err)
 		}
 		f2(ptr)
 		if page < respData.PagesAvailable {
@@ -703,13 +852,14 @@ func (nacos *NacosService) listFunc(path string, f1 func() interface{}, f2 func(
 	return f(DEFAULT_PAGE, DEFAULT_SIZE)
 }
 
-func (nacos *NacosService) listTenant() ([]*NacosNamespace, error) {
-	resp, err := nacos.client.Get(nacos.addr + TENANT_PATH)
+func (nacos *NacosService) listTenant(ctx context.Context) ([]*NacosNamespace, error) {
+	resp, err := nacos.do(ctx, http.MethodGet, TENANT_PATH, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to list nacos namespace, code is %d", resp.StatusCode)
+		return nil, errorOfStatus(resp.StatusCode, "failed to list nacos namespace")
 	}
 	nsList := []*NacosNamespace{}
 	respData := struct {
@@ -720,70 +870,217 @@ func (nacos *NacosService) listTenant() ([]*NacosNamespace, error) {
 		Data: &nsList,
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
-		return nil, fmt.Errorf("failed to decode nacos namespace resp, err is %v", err)
+		return nil, errorOfContext(ctx, fmt.Errorf("failed to decode nacos namespace resp, err is %v", err))
 	}
 	return nsList, nil
 }
 
-func (nacos *NacosService) postForm(path string, data url.Values) error {
-	resp, err := nacos.client.PostForm(nacos.addr+path, data)
+func (nacos *NacosService) postForm(ctx context.Context, path string, data url.Values) error {
+	resp, err := nacos.do(ctx, http.MethodPost, path, data)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to post data, code is %d", resp.StatusCode)
+		return errorOfStatus(resp.StatusCode, "failed to post data")
 	}
 	return nil
 }
 
-func (nacos *NacosService) createUser(uname string) error {
-	return nacos.postForm(USER_PATH, url.Values{
+func (nacos *NacosService) createUser(ctx context.Context, uname string) error {
+	cred, err := storeOr(nacos.credentials).Credential(ctx, uname)
+	if err != nil {
+		return err
+	}
+	return nacos.postForm(ctx, USER_PATH, url.Values{
 		"username": {uname},
-		"password": {GenPassword(uname)},
+		"password": {cred.Password},
 	})
 }
 
-func (nacos *NacosService) createRole(rolename, username string) error {
-	return nacos.postForm(ROLE_PATH, url.Values{
+// sendQuery sends the request with parameters in query, as nacos reads them for PUT and DELETE
+func (nacos *NacosService) sendQuery(ctx context.Context, method, path string, q url.Values) error {
+	resp, err := nacos.do(ctx, method, path+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errorOfStatus(resp.StatusCode, "failed to %s %s", strings.ToLower(method), path)
+	}
+	return nil
+}
+
+func (nacos *NacosService) updateUserPassword(ctx context.Context, uname, password string) error {
+	return nacos.sendQuery(ctx, http.MethodPut, USER_PATH, url.Values{"username": {uname}, "newPassword": {password}})
+}
+
+// setUserPassword creates the user if it is not in existing, or updates its password
+func (nacos *NacosService) setUserPassword(ctx context.Context, existing []*NacosUser, uname, password string) error {
+	for _, user := range existing {
+		if user.Username == uname {
+			return nacos.updateUserPassword(ctx, uname, password)
+		}
+	}
+	return nacos.postForm(ctx, USER_PATH, url.Values{"username": {uname}, "password": {password}})
+}
+
+// applyCredentials sets the users whose stored password is not applied yet, existing users get the password rotated
+func (nacos *NacosService) applyCredentials(ctx context.Context, users ...string) error {
+	store := storeOr(nacos.credentials)
+	pending := []*Credential{}
+	for _, user := range users {
+		cred, err := store.Credential(ctx, user)
+		if err != nil {
+			return err
+		}
+		if !cred.Applied {
+			pending = append(pending, cred)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	ctx, cancel := withTimeout(ctx, nacos.timeouts.Sync)
+	defer cancel()
+	nacos.syncLock.Lock()
+	defer nacos.syncLock.Unlock()
+	existing, err := nacos.listUsers(ctx)
+	if err != nil {
+		return fmt.Errorf("list users failed, %w", err)
+	}
+	for _, cred := range pending {
+		if err := nacos.setUserPassword(ctx, existing, cred.Username, cred.Password); err != nil {
+			return fmt.Errorf("set password of user %s failed, %w", cred.Username, err)
+		}
+		if err := store.MarkApplied(ctx, cred.Username, cred.Password); err != nil {
+			return err
+		}
+	}
+	// the users are listed again by preAction
+	nacos.usersLastUpdateTime = &time.Time{}
+	return nil
+}
+
+// RotateAccounts sets new passwords of the r/rw users, shadow users with the old passwords are bound to the same roles during grace
+func (nacos *NacosService) RotateAccounts(ctx context.Context, item *ConfigItem, grace time.Duration) ([]RotatedAccount, error) {
+	mapper, err := mapperForNacos(item)
+	if err != nil {
+		return nil, err
+	}
+	// the users and roles exist after preAction
+	if err := nacos.preAction(ctx, mapper); err != nil {
+		return nil, err
+	}
+	rUser, rwUser, rRole, rwRole, _ := nacos.userRolesFor(mapper)
+	store := storeOr(nacos.credentials)
+	sweepShadows(ctx, store, nacos.removeShadow)
+	old, rotated, err := rotateCredentials(ctx, store, rUser, rwUser)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx, nacos.timeouts.Sync)
+	defer cancel()
+	nacos.syncLock.Lock()
+	defer nacos.syncLock.Unlock()
+	existing, err := nacos.listUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list users failed, %w", err)
+	}
+	roles := []string{rRole, rwRole}
+	shadows := []Shadow{}
+	if grace > 0 {
+		expiresAt := time.Now().Add(grace)
+		for i, cred := range rotated {
+			shadows = append(shadows, Shadow{
+				User:      cred.Username,
+				Account:   Account{Username: ShadowUsername(cred.Username), Password: old[i].Password},
+				Role:      roles[i],
+				ExpiresAt: expiresAt,
+			})
+		}
+	}
+	if err := recordShadows(ctx, store, shadows); err != nil {
+		return nil, err
+	}
+	for i, cred := range rotated {
+		if grace > 0 {
+			shadow := shadows[i].Account
+			if err := nacos.setUserPassword(ctx, existing, shadow.Username, shadow.Password); err != nil {
+				return nil, fmt.Errorf("set shadow user of %s failed, %w", cred.Username, err)
+			}
+			// binding an existing role fails, which is fine
+			nacos.createRole(ctx, roles[i], shadow.Username)
+		}
+		if err := nacos.updateUserPassword(ctx, cred.Username, cred.Password); err != nil {
+			return nil, fmt.Errorf("rotate password of user %s failed, %w", cred.Username, err)
+		}
+		if err := store.MarkApplied(ctx, cred.Username, cred.Password); err != nil {
+			return nil, err
+		}
+	}
+	if grace > 0 {
+		removeShadowsAfter(grace, store, shadows, nacos.removeShadow)
+	}
+	nacos.usersLastUpdateTime = &time.Time{}
+	nacos.rolesLastUpdateTime = &time.Time{}
+	return rotatedAccounts(rotated, shadows, grace), nil
+}
+
+// removeShadow unbinds the role of the shadow user and deletes it
+func (nacos *NacosService) removeShadow(ctx context.Context, shadow Shadow) error {
+	nacos.sendQuery(ctx, http.MethodDelete, ROLE_PATH, url.Values{"role": {shadow.Role}, "username": {shadow.Account.Username}})
+	return nacos.sendQuery(ctx, http.MethodDelete, USER_PATH, url.Values{"username": {shadow.Account.Username}})
+}
+
+func (nacos *NacosService) createRole(ctx context.Context, rolename, username string) error {
+	return nacos.postForm(ctx, ROLE_PATH, url.Values{
 		"username": {username},
 		"role":     {rolename},
 	})
 }
 
-func (nacos *NacosService) createPerm(role, resource, action string) error {
-	return nacos.postForm(PERM_PATH, url.Values{
+func (nacos *NacosService) createPerm(ctx context.Context, role, resource, action string) error {
+	return nacos.postForm(ctx, PERM_PATH, url.Values{
 		"role":     {role},
 		"resource": {resource},
 		"action":   {action},
 	})
 }
 
-func (nacos *NacosService) createTenant(tenantid, tenantname string) error {
+func (nacos *NacosService) createTenant(ctx context.Context, tenantid, tenantname string) error {
 	q := url.Values{}
 	q.Add("customNamespaceId", tenantid)
 	q.Add("namespaceName", tenantname)
 	q.Add("namespaceDesc", tenantname)
-	req, _ := http.NewRequest(http.MethodPost, nacos.addr+TENANT_PATH+"?"+q.Encode(), nil)
-	resp, err := nacos.client.Do(req)
+	resp, err := nacos.do(ctx, http.MethodPost, TENANT_PATH+"?"+q.Encode(), nil)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to create nacos namespace, code is %d", resp.StatusCode)
+		return errorOfStatus(resp.StatusCode, "failed to create nacos namespace")
 	}
 	return nil
 }
 
 func (nacos *NacosService) userRolesFor(mapper *NacosDataMapper) (rUser, rwUser, rRole, rwRole, resource string) {
-	rUser = mapper.Tenant() + ":" + mapper.Environment() + ":r"
-	rwUser = mapper.Tenant() + ":" + mapper.Environment() + ":rw"
-	rRole = mapper.Tenant() + ":" + mapper.Environment() + ":r"
-	rwRole = mapper.Tenant() + ":" + mapper.Environment() + ":rw"
+	scope := mapper.Tenant() + ":" + mapper.Environment()
 	resource = mapper.TenantID() + ":" + mapper.Environment()
+	if nacos.applicationAccounts.enabled(mapper.item) {
+		// the data ids of the application start with its name and the delimiter
+		scope += ":" + mapper.Application()
+		resource += ":config/" + applicationKeyPrefix(mapper.Application()) + "*"
+	}
+	rUser = scope + ":r"
+	rwUser = scope + ":rw"
+	rRole = scope + ":r"
+	rwRole = scope + ":rw"
 	return
 }
 
+// urlFor returns the path with query, the address of the node is added when sending
 func (nacos *NacosService) urlFor(mapper *NacosDataMapper, path string) string {
 	q := url.Values{}
 	q.Add("tenant", mapper.TenantID())
@@ -795,47 +1092,194 @@ func (nacos *NacosService) urlFor(mapper *NacosDataMapper, path string) string {
 	default:
 		q.Add("appName", mapper.Application())
 	}
-	u := nacos.addr + path + "?" + q.Encode()
-	return u
+	return path + "?" + q.Encode()
 }
 
-func (nacos *NacosService) login() error {
+// login logins the node, the caller must hold the lock of the node
+func (nacos *NacosService) login(ctx context.Context, node *nacosNode) error {
+	ctx, cancel := withTimeout(ctx, nacos.timeouts.Login)
+	defer cancel()
 	q := url.Values{}
 	q.Add("username", nacos.username)
 	q.Add("password", nacos.password)
-	req, _ := http.NewRequest(http.MethodPost, nacos.addr+LOGIN_PATH, nil)
-	req.URL.RawQuery = q.Encode()
-	cli := http.Client{}
-	if nacos.baseRoundTripper != nil {
-		cli.Transport = nacos.baseRoundTripper
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, node.addr+LOGIN_PATH+"?"+q.Encode(), nil)
+	if err != nil {
+		return InvalidArgumentError("invalid nacos address %s, %v", node.addr, err)
 	}
-	req.Header.Add("namespace", "nacos")
-	req.Header.Add("service", "nacos-client")
-	req.Header.Add("port", "8848")
-	resp, err := cli.Do(req)
+	resp, err := nacos.plainDo(req)
 	if err != nil {
-		return err
+		return errorOfRequest(errorOfContext(ctx, err))
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to login nacos, code is %d", resp.StatusCode)
+		return errorOfStatus(resp.StatusCode, "failed to login nacos")
 	}
 	authResponse := AuthInfo{}
 	if err := json.NewDecoder(resp.Body).Decode(&authResponse); err != nil {
-		return fmt.Errorf("failed to decode login response, %s", err)
+		return errorOfContext(ctx, fmt.Errorf("failed to decode login response, %s", err))
 	}
-	nacos.authInfo = &authResponse
-	nacos.lastLogin = time.Now()
+	node.authInfo = &authResponse
+	node.lastLogin = time.Now()
 	return nil
 }
 
+// plainDo sends the request without token, it is used for login and health checks
+func (nacos *NacosService) plainDo(req *http.Request) (*http.Response, error) {
+	cli := http.Client{Transport: nacos.transport}
+	req.Header.Add("namespace", "nacos")
+	req.Header.Add("service", "nacos-client")
+	req.Header.Add("port", "8848")
+	return cli.Do(req)
+}
+
+// loginAny logins the nodes in order until one succeeds, unreachable nodes are marked down
+func (nacos *NacosService) loginAny(ctx context.Context) error {
+	var lastErr error
+	for _, node := range nacos.candidates() {
+		node.lock.Lock()
+		err := nacos.login(ctx, node)
+		node.lock.Unlock()
+		if err == nil {
+			nacos.markUp(node)
+			return nil
+		}
+		if !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		nacos.markDown(node)
+		lastErr = err
+	}
+	return lastErr
+}
+
+// tokenOf returns the token of the node, it logins again once the token expired
+func (nacos *NacosService) tokenOf(ctx context.Context, node *nacosNode) (string, error) {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	if node.authInfo == nil || time.Now().Unix()-node.lastLogin.Unix() >= node.authInfo.TokenTTL {
+		if err := nacos.login(ctx, node); err != nil {
+			return "", err
+		}
+	}
+	return node.authInfo.AccessToken, nil
+}
+
+// candidates returns the nodes to try in order, the preferred node first and nodes down last
+func (nacos *NacosService) candidates() []*nacosNode {
+	nacos.nodesLock.Lock()
+	defer nacos.nodesLock.Unlock()
+	up, down := []*nacosNode{}, []*nacosNode{}
+	for i := range nacos.nodes {
+		node := nacos.nodes[(nacos.preferred+i)%len(nacos.nodes)]
+		if node.down {
+			down = append(down, node)
+		} else {
+			up = append(up, node)
+		}
+	}
+	return append(up, down...)
+}
+
+func (nacos *NacosService) markUp(node *nacosNode) {
+	nacos.nodesLock.Lock()
+	defer nacos.nodesLock.Unlock()
+	node.down = false
+	for i := range nacos.nodes {
+		if nacos.nodes[i] == node {
+			nacos.preferred = i
+		}
+	}
+}
+
+func (nacos *NacosService) markDown(node *nacosNode) {
+	nacos.nodesLock.Lock()
+	defer nacos.nodesLock.Unlock()
+	node.down = true
+}
+
+func (nacos *NacosService) healthCheck() {
+	ticker := time.NewTicker(nacos.healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-nacos.stop:
+			return
+		case <-ticker.C:
+		}
+		for _, node := range nacos.nodes {
+			ctx, cancel := withTimeout(context.Background(), nacos.timeouts.Login)
+			healthy := nacos.checkNode(ctx, node)
+			cancel()
+			nacos.nodesLock.Lock()
+			node.down = !healthy
+			nacos.nodesLock.Unlock()
+		}
+	}
+}
+
+func (nacos *NacosService) checkNode(ctx context.Context, node *nacosNode) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, node.addr+nacosReadinessPath, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := nacos.plainDo(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// do sends the request with ctx to a healthy node, uri is the path with query and data is sent as a form if not nil.
+// it fails over to the next node if the node can not be connected, reads fail over on any transport error too.
+func (nacos *NacosService) do(ctx context.Context, method, uri string, data url.Values) (*http.Response, error) {
+	var lastErr error
+	for _, node := range nacos.candidates() {
+		var body io.Reader
+		if data != nil {
+			body = strings.NewReader(data.Encode())
+		}
+		req, err := http.NewRequestWithContext(context.WithValue(ctx, nacosNodeKey{}, node), method, node.addr+uri, body)
+		if err != nil {
+			return nil, InvalidArgumentError("invalid nacos request %s, %v", uri, err)
+		}
+		if data != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		resp, err := nacos.client.Do(req)
+		if err == nil {
+			nacos.markUp(node)
+			return resp, nil
+		}
+		lastErr = errorOfRequest(errorOfContext(ctx, err))
+		if ctx.Err() != nil || CodeOf(lastErr) != ErrorCodeBackendUnavailable || (method != http.MethodGet && !isDialError(err)) {
+			return nil, lastErr
+		}
+		nacos.markDown(node)
+	}
+	return nil, lastErr
+}
+
+// isDialError reports whether the request failed before it was sent
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
 type NacosDataMapper struct {
 	item *ConfigItem
 }
 
 func mapperForNacos(item *ConfigItem) (*NacosDataMapper, error) {
 	if item.Tenant == "" || item.Project == "" {
-		return nil, fmt.Errorf("tenant and project must be set")
+		return nil, InvalidArgumentError("tenant and project must be set")
 	}
 	return &NacosDataMapper{
 		item: item,
@@ -843,8 +1287,13 @@ func mapperForNacos(item *ConfigItem) (*NacosDataMapper, error) {
 }
 
 func (c *NacosDataMapper) TenantID() string {
+	return NacosTenantID(c.item.Tenant, c.item.Project)
+}
+
+// NacosTenantID returns the nacos namespace id of the kubegems tenant and project
+func NacosTenantID(tenant, project string) string {
 	hash := sha1.New()
-	b := "kubegems_" + c.item.Tenant + "_" + c.item.Project
+	b := "kubegems_" + tenant + "_" + project
 	hash.Write([]byte(b))
 	return fmt.Sprintf("%x", hash.Sum(nil))
 }
@@ -3,11 +3,13 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -451,7 +453,7 @@ func TestNewNacosService(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := NewNacosService(tt.args.addr, tt.args.username, tt.args.password, nil)
+			_, err := NewNacosService([]string{tt.args.addr}, tt.args.username, tt.args.password, nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("NewNacosService() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -572,7 +574,7 @@ func TestNacosService_Get(t *testing.T) {
 		},
 	}
 
-	nacos, err := NewNacosService(server.URL, "nacos", "nacos", nil)
+	nacos, err := NewNacosService([]string{server.URL}, "nacos", "nacos", nil)
 	if err != nil {
 		t.Errorf("NewNacosService() error = %v", err)
 	}
@@ -650,7 +652,7 @@ func TestNacosService_Pub(t *testing.T) {
 			wantErr: true,
 		},
 	}
-	nacos, err := NewNacosService(server.URL, "nacos", "nacos", nil)
+	nacos, err := NewNacosService([]string{server.URL}, "nacos", "nacos", nil)
 	if err != nil {
 		t.Errorf("NewNacosService() error = %v", err)
 	}
@@ -728,7 +730,7 @@ func TestNacosService_Delete(t *testing.T) {
 			wantErr: true,
 		},
 	}
-	nacos, err := NewNacosService(server.URL, "nacos", "nacos", nil)
+	nacos, err := NewNacosService([]string{server.URL}, "nacos", "nacos", nil)
 	if err != nil {
 		t.Errorf("NewNacosService() error = %v", err)
 	}
@@ -839,7 +841,7 @@ func TestNacosService_List(t *testing.T) {
 			wantErr: true,
 		},
 	}
-	nacos, err := NewNacosService(server.URL, "nacos", "nacos", nil)
+	nacos, err := NewNacosService([]string{server.URL}, "nacos", "nacos", nil)
 	if err != nil {
 		t.Errorf("NewNacosService() error = %v", err)
 	}
@@ -877,7 +879,7 @@ func TestNacosService_History(t *testing.T) {
 			},
 		},
 	}
-	nacos, err := NewNacosService(server.URL, "nacos", "nacos", nil)
+	nacos, err := NewNacosService([]string{server.URL}, "nacos", "nacos", nil)
 	if err != nil {
 		t.Errorf("NewNacosService() error = %v", err)
 	}
@@ -916,3 +918,79 @@ func TestNacosService_Accounts(t *testing.T) {
 		t.Error("username is not right")
 	}
 }
+
+func TestNacosService_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == LOGIN_PATH {
+			w.Write([]byte(`{"accessToken":"token","tokenTtl":18000,"globalAdmin":true}`))
+			return
+		}
+		// hang until the client gives up
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	timeouts := NacosTimeouts{Login: time.Second, Read: 50 * time.Millisecond, Write: 50 * time.Millisecond, Sync: 50 * time.Millisecond}
+	nacos, err := NewNacosService([]string{server.URL}, "nacos", "nacos", nil, WithNacosTimeouts(timeouts))
+	if err != nil {
+		t.Fatalf("NewNacosService() error = %v", err)
+	}
+	item := &ConfigItem{Tenant: "ten1", Project: "proj1", Environment: "dev", Key: "config"}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		fn   func(ctx context.Context) error
+	}{
+		{name: "get timeout in pre action", ctx: context.Background(), fn: func(ctx context.Context) error { return nacos.Get(ctx, item) }},
+		{name: "list timeout", ctx: context.Background(), fn: func(ctx context.Context) error {
+			_, err := nacos.List(ctx, &ListOptions{ConfigItem: *item})
+			return err
+		}},
+		{name: "history canceled", ctx: canceled, fn: func(ctx context.Context) error {
+			_, err := nacos.History(ctx, item)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			err := tt.fn(tt.ctx)
+			if !errors.Is(err, ErrTimeout) {
+				t.Errorf("error = %v, want Timeout", err)
+			}
+			if time.Since(start) > time.Second {
+				t.Errorf("request took %v, timeout not honoured", time.Since(start))
+			}
+		})
+	}
+}
+
+func TestNacosService_Failover(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	nacos, err := NewNacosService([]string{dead.URL, server.URL}, "nacos", "nacos", nil, WithNacosHealthCheckInterval(0))
+	if err != nil {
+		t.Fatalf("NewNacosService() error = %v", err)
+	}
+	defer nacos.Close()
+	if !nacos.nodes[0].down || nacos.nodes[1].down {
+		t.Fatalf("unreachable node should be marked down after login")
+	}
+	// requests go to the healthy node even if the dead one comes first again
+	nacos.markUp(nacos.nodes[0])
+	item := &ConfigItem{Tenant: "ten1", Project: "proj1", Environment: "dev", Application: "app1", Key: "config", Value: "a: b"}
+	if err := nacos.Pub(context.Background(), item); err != nil {
+		t.Fatalf("Pub() error = %v", err)
+	}
+	if got := nacos.candidates()[0]; got != nacos.nodes[1] {
+		t.Errorf("preferred node = %s, want %s", got.addr, server.URL)
+	}
+
+	if _, err := NewNacosService([]string{dead.URL}, "nacos", "nacos", nil); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("NewNacosService() of dead nodes error = %v, want BackendUnavailable", err)
+	}
+	if _, err := NewNacosService([]string{" "}, "nacos", "nacos", nil); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("NewNacosService() without endpoints error = %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,473 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+	Redis version requred: 6.2 +
+	mapping:
+		hash    = kubegems/{gems.tenant}/{gems.project}/{gems.environment}
+		field   = {gems.key}
+		history = kubegems/{gems.tenant}/{gems.project}/{gems.environment}/{gems.key}/history
+*/
+
+const (
+	RedisHistorySize = 10
+	redisRevisionKey = "kubegems/revision"
+)
+
+type RedisService struct {
+	cli redis.UniversalClient
+	db  int
+
+	users    []string
+	userLock sync.Mutex
+
+	credentials CredentialStore
+}
+
+type redisHistory struct {
+	Rev   int64  `json:"rev"`
+	Value string `json:"value"`
+	Time  string `json:"time"`
+}
+
+type RedisOption func(r *RedisService)
+
+// WithRedisCredentials sets the store of the passwords of the acl users created in redis
+func WithRedisCredentials(store CredentialStore) RedisOption {
+	return func(r *RedisService) {
+		r.credentials = store
+	}
+}
+
+func NewRedisService(endpoints []string, username, password string, opts ...RedisOption) (*RedisService, error) {
+	if len(endpoints) == 0 {
+		return nil, InvalidArgumentError("redis endpoints must be specified")
+	}
+	redisOpts := &redis.UniversalOptions{
+		Addrs:       endpoints,
+		Username:    username,
+		Password:    password,
+		DialTimeout: 5 * time.Second,
+	}
+	cli := redis.NewUniversalClient(redisOpts)
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpts.DialTimeout)
+	defer cancel()
+	if err := cli.Ping(ctx).Err(); err != nil {
+		cli.Close()
+		return nil, errorOfRedis(err)
+	}
+	r := &RedisService{
+		cli:   cli,
+		db:    redisOpts.DB,
+		users: []string{},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.enableKeyspaceEvents(ctx)
+	return r, nil
+}
+
+// Close closes the connections to redis, the service can not be used after closed
+func (r *RedisService) Close() error {
+	return r.cli.Close()
+}
+
+func (r *RedisService) BaseInfo(ctx context.Context, item *ConfigItem) (map[string]string, error) {
+	baseMap := map[string]string{
+		"provider": "redis",
+	}
+	mapper, err := mapperForRedis(item)
+	if err != nil {
+		return baseMap, err
+	}
+	baseMap["redis_hash"] = mapper.HashKey()
+	baseMap["redis_channel"] = mapper.KeyspaceChannel(r.db)
+	return baseMap, nil
+}
+
+func (r *RedisService) Get(ctx context.Context, item *ConfigItem) error {
+	mapper, err := mapperForRedis(item)
+	if err != nil {
+		return err
+	}
+	if err := r.preAction(ctx, mapper); err != nil {
+		return err
+	}
+	if item.Rev != 0 {
+		histories, err := r.histories(ctx, mapper)
+		if err != nil {
+			return err
+		}
+		for _, h := range histories {
+			if h.Rev == item.Rev {
+				item.Value = h.Value
+				return nil
+			}
+		}
+		return NotFoundError("rev %d of key %s not found", item.Rev, item.Key)
+	}
+	value, err := r.cli.HGet(ctx, mapper.HashKey(), item.Key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return NotFoundError("key %s not found in %s", item.Key, mapper.HashKey())
+		}
+		return errorOfRedis(err)
+	}
+	item.Value = value
+	return nil
+}
+
+func (r *RedisService) Pub(ctx context.Context, item *ConfigItem) error {
+	mapper, err := mapperForRedis(item)
+	if err != nil {
+		return err
+	}
+	if err := r.preAction(ctx, mapper); err != nil {
+		return err
+	}
+	rev, err := r.cli.Incr(ctx, redisRevisionKey).Result()
+	if err != nil {
+		return errorOfRedis(err)
+	}
+	history, _ := json.Marshal(redisHistory{
+		Rev:   rev,
+		Value: item.Value,
+		Time:  time.Now().Format(time.RFC3339),
+	})
+	_, err = r.cli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.HSet(ctx, mapper.HashKey(), item.Key, item.Value)
+		p.LPush(ctx, mapper.HistoryKey(), history)
+		p.LTrim(ctx, mapper.HistoryKey(), 0, RedisHistorySize-1)
+		return nil
+	})
+	if err != nil {
+		return errorOfRedis(err)
+	}
+	item.Rev = rev
+	return nil
+}
+
+func (r *RedisService) Delete(ctx context.Context, item *ConfigItem) error {
+	mapper, err := mapperForRedis(item)
+	if err != nil {
+		return err
+	}
+	if err := r.preAction(ctx, mapper); err != nil {
+		return err
+	}
+	var deleted *redis.IntCmd
+	_, err = r.cli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		deleted = p.HDel(ctx, mapper.HashKey(), item.Key)
+		p.Del(ctx, mapper.HistoryKey())
+		return nil
+	})
+	if err != nil {
+		return errorOfRedis(err)
+	}
+	if deleted.Val() == 0 {
+		return NotFoundError("key %s not found in %s", item.Key, mapper.HashKey())
+	}
+	return nil
+}
+
+func (r *RedisService) History(ctx context.Context, item *ConfigItem) ([]*HistoryVersion, error) {
+	mapper, err := mapperForRedis(item)
+	if err != nil {
+		return nil, err
+	}
+	histories, err := r.histories(ctx, mapper)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*HistoryVersion, len(histories))
+	for idx, h := range histories {
+		ret[idx] = &HistoryVersion{
+			Rev:            strconv.FormatInt(h.Rev, 10),
+			Version:        strconv.Itoa(len(histories) - idx),
+			LastUpdateTime: h.Time,
+		}
+	}
+	return ret, nil
+}
+
+func (r *RedisService) List(ctx context.Context, opts *ListOptions) ([]*ConfigItem, error) {
+	mapper, err := mapperForRedis(&opts.ConfigItem)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.preAction(ctx, mapper); err != nil {
+		return nil, err
+	}
+	hashKeys := []string{}
+	if opts.Environment != "" {
+		hashKeys = append(hashKeys, mapper.HashKey())
+	} else {
+		iter := r.cli.Scan(ctx, 0, mapper.ListKey()+"/*", 0).Iterator()
+		for iter.Next(ctx) {
+			// skip history lists
+			if len(strings.Split(iter.Val(), "/")) == 4 {
+				hashKeys = append(hashKeys, iter.Val())
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return nil, errorOfRedis(err)
+		}
+	}
+	ret := []*ConfigItem{}
+	for _, hashKey := range hashKeys {
+		kvs, err := r.cli.HGetAll(ctx, hashKey).Result()
+		if err != nil {
+			return nil, errorOfRedis(err)
+		}
+		seps := strings.Split(hashKey, "/")
+		for k, v := range kvs {
+			ret = append(ret, &ConfigItem{
+				Tenant:      seps[1],
+				Project:     seps[2],
+				Environment: seps[3],
+				Key:         k,
+				Value:       v,
+			})
+		}
+	}
+	return ret, nil
+}
+
+func (r *RedisService) Accounts(item *ConfigItem) ([]Account, error) {
+	mapper, err := mapperForRedis(item)
+	if err != nil {
+		return nil, err
+	}
+	rUser, rwUser := r.usersFor(mapper)
+	return accountsOf(context.Background(), storeOr(r.credentials), rUser, rwUser)
+}
+
+// Listener reports subscribers count of the keyspace notification channel of the environment
+func (r *RedisService) Listener(ctx context.Context, item *ConfigItem) (map[string]string, error) {
+	mapper, err := mapperForRedis(item)
+	if err != nil {
+		return nil, err
+	}
+	channel := mapper.KeyspaceChannel(r.db)
+	counts, err := r.cli.PubSubNumSub(ctx, channel).Result()
+	if err != nil {
+		return nil, errorOfRedis(err)
+	}
+	ret := map[string]string{}
+	for ch, count := range counts {
+		ret[ch] = strconv.FormatInt(count, 10)
+	}
+	return ret, nil
+}
+
+func (r *RedisService) histories(ctx context.Context, mapper *RedisMapper) ([]*redisHistory, error) {
+	datas, err := r.cli.LRange(ctx, mapper.HistoryKey(), 0, RedisHistorySize-1).Result()
+	if err != nil {
+		return nil, errorOfRedis(err)
+	}
+	ret := []*redisHistory{}
+	for _, data := range datas {
+		h := &redisHistory{}
+		if err := json.Unmarshal([]byte(data), h); err != nil {
+			continue
+		}
+		ret = append(ret, h)
+	}
+	return ret, nil
+}
+
+// enableKeyspaceEvents enables hash keyspace notifications, managed redis may forbid CONFIG, so errors are ignored
+func (r *RedisService) enableKeyspaceEvents(ctx context.Context) {
+	current, err := r.cli.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		return
+	}
+	flags := current["notify-keyspace-events"]
+	if strings.Contains(flags, "K") && (strings.Contains(flags, "h") || strings.Contains(flags, "A")) {
+		return
+	}
+	if !strings.Contains(flags, "K") {
+		flags += "K"
+	}
+	if !strings.Contains(flags, "h") && !strings.Contains(flags, "A") {
+		flags += "h"
+	}
+	r.cli.ConfigSet(ctx, "notify-keyspace-events", flags)
+}
+
+func (r *RedisService) preAction(ctx context.Context, mapper *RedisMapper) error {
+	rUser, rwUser := r.usersFor(mapper)
+	r.userLock.Lock()
+	defer r.userLock.Unlock()
+	keys := []string{"~" + mapper.HashKey(), "~" + mapper.HashKey() + "/*"}
+	channel := "&" + mapper.KeyspaceChannel(r.db)
+	if !contains(r.users, rUser) {
+		args := append([]interface{}{channel, "+@read", "+@connection", "+subscribe", "+psubscribe"}, toInterfaces(keys)...)
+		if err := r.setUser(ctx, rUser, args...); err != nil {
+			return err
+		}
+	}
+	if !contains(r.users, rwUser) {
+		args := append([]interface{}{channel, "+@read", "+@write", "+@connection", "+subscribe", "+psubscribe", "+incr"}, toInterfaces(keys)...)
+		args = append(args, "~"+redisRevisionKey)
+		if err := r.setUser(ctx, rwUser, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setUser resets the acl user with the stored password and rules, the caller must hold userLock
+func (r *RedisService) setUser(ctx context.Context, user string, rules ...interface{}) error {
+	store := storeOr(r.credentials)
+	cred, err := store.Credential(ctx, user)
+	if err != nil {
+		return err
+	}
+	args := append([]interface{}{"ACL", "SETUSER", user, "reset", "on", ">" + cred.Password}, rules...)
+	if err := r.cli.Do(ctx, args...).Err(); err != nil {
+		return fmt.Errorf("set acl user %s failed, %w", user, errorOfRedis(err))
+	}
+	r.users = append(r.users, user)
+	if cred.Applied {
+		return nil
+	}
+	return store.MarkApplied(ctx, user, cred.Password)
+}
+
+// RotateAccounts sets new passwords of the r/rw acl users, redis users accept more than one password,
+// so the old passwords are kept on the same users during grace instead of shadow users
+func (r *RedisService) RotateAccounts(ctx context.Context, item *ConfigItem, grace time.Duration) ([]RotatedAccount, error) {
+	mapper, err := mapperForRedis(item)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.preAction(ctx, mapper); err != nil {
+		return nil, err
+	}
+	rUser, rwUser := r.usersFor(mapper)
+	store := storeOr(r.credentials)
+	r.userLock.Lock()
+	defer r.userLock.Unlock()
+	sweepShadows(ctx, store, r.removeShadow)
+	old, rotated, err := rotateCredentials(ctx, store, rUser, rwUser)
+	if err != nil {
+		return nil, err
+	}
+	shadows := []Shadow{}
+	if grace > 0 {
+		expiresAt := time.Now().Add(grace)
+		for i, cred := range rotated {
+			// the old password is kept by the account itself
+			shadows = append(shadows, Shadow{User: cred.Username, Account: Account{Username: cred.Username, Password: old[i].Password}, ExpiresAt: expiresAt})
+		}
+	}
+	if err := recordShadows(ctx, store, shadows); err != nil {
+		return nil, err
+	}
+	for i, cred := range rotated {
+		args := []interface{}{"ACL", "SETUSER", cred.Username, "resetpass", ">" + cred.Password}
+		if grace > 0 {
+			args = append(args, ">"+old[i].Password)
+		}
+		if err := r.cli.Do(ctx, args...).Err(); err != nil {
+			return nil, fmt.Errorf("rotate password of user %s failed, %w", cred.Username, errorOfRedis(err))
+		}
+		if err := store.MarkApplied(ctx, cred.Username, cred.Password); err != nil {
+			return nil, err
+		}
+	}
+	if grace > 0 {
+		removeShadowsAfter(grace, store, shadows, r.removeShadow)
+	}
+	return rotatedAccounts(rotated, shadows, grace), nil
+}
+
+// removeShadow removes the old password from the account, resetpass of a later rotation may have removed it already
+func (r *RedisService) removeShadow(ctx context.Context, shadow Shadow) error {
+	err := r.cli.Do(ctx, "ACL", "SETUSER", shadow.Account.Username, "<"+shadow.Account.Password).Err()
+	if err != nil && strings.Contains(err.Error(), "does not exist") {
+		return nil
+	}
+	return errorOfRedis(err)
+}
+
+func (r *RedisService) usersFor(mapper *RedisMapper) (rUser, rwUser string) {
+	rUser = mapper.HashKey() + "-r"
+	rwUser = mapper.HashKey() + "-rw"
+	return
+}
+
+func toInterfaces(strs []string) []interface{} {
+	ret := make([]interface{}, len(strs))
+	for idx, s := range strs {
+		ret[idx] = s
+	}
+	return ret
+}
+
+type RedisMapper struct {
+	*EtcdMapper
+}
+
+// MapperForRedis returns the redis key mapper of the item, applications use it to locate their configs
+func MapperForRedis(item *ConfigItem) (*RedisMapper, error) {
+	return mapperForRedis(item)
+}
+
+func mapperForRedis(item *ConfigItem) (*RedisMapper, error) {
+	mapper, err := mapperForEtcd(item)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisMapper{EtcdMapper: mapper}, nil
+}
+
+func (c *RedisMapper) HashKey() string {
+	return c.NsPrefix()
+}
+
+func (c *RedisMapper) HistoryKey() string {
+	return c.Key() + "/history"
+}
+
+func (c *RedisMapper) KeyspaceChannel(db int) string {
+	return fmt.Sprintf("__keyspace@%d__:%s", db, c.HashKey())
+}
+
+// errorOfRedis classifies the error of redis by its type and the error prefix of redis
+func errorOfRedis(err error) error {
+	if err == nil {
+		return nil
+	}
+	var netErr net.Error
+	msg := err.Error()
+	switch {
+	case err == redis.Nil:
+		return newError(ErrorCodeNotFound, err, "key not found")
+	case strings.HasPrefix(msg, "NOPERM"), strings.HasPrefix(msg, "NOAUTH"), strings.HasPrefix(msg, "WRONGPASS"):
+		return newError(ErrorCodeUnauthorized, err, "access redis denied")
+	case strings.HasPrefix(msg, "WRONGTYPE"):
+		return newError(ErrorCodeConflict, err, "redis key type mismatch")
+	case errors.As(err, &netErr), errors.Is(err, io.EOF), errors.Is(err, redis.ErrClosed),
+		errors.Is(err, context.DeadlineExceeded), strings.HasPrefix(msg, "LOADING"), strings.HasPrefix(msg, "CLUSTERDOWN"):
+		return newError(ErrorCodeBackendUnavailable, err, "redis unavailable")
+	default:
+		return err
+	}
+}
@@ -0,0 +1,231 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	miniserver "github.com/alicebob/miniredis/v2/server"
+	"github.com/redis/go-redis/v9"
+)
+
+// runTestRedis runs a miniredis accepting the ACL commands, miniredis does not implement acl
+func runTestRedis(t *testing.T) *miniredis.Miniredis {
+	m := miniredis.RunT(t)
+	m.Server().Register("ACL", func(c *miniserver.Peer, cmd string, args []string) {
+		c.WriteOK()
+	})
+	return m
+}
+
+func newTestRedisService(t *testing.T) (*RedisService, *miniredis.Miniredis) {
+	m := runTestRedis(t)
+	r, err := NewRedisService([]string{m.Addr()}, "", "")
+	if err != nil {
+		t.Fatalf("NewRedisService() error = %v", err)
+	}
+	return r, m
+}
+
+func TestNewRedisService(t *testing.T) {
+	m := miniredis.RunT(t)
+	tests := []struct {
+		name      string
+		endpoints []string
+		wantErr   bool
+	}{
+		{
+			name:      "test new redisservice success",
+			endpoints: []string{m.Addr()},
+		},
+		{
+			name:      "test new redisservice failed with empty endpoints",
+			endpoints: []string{},
+			wantErr:   true,
+		},
+		{
+			name:      "test new redisservice failed with unreachable endpoints",
+			endpoints: []string{"127.0.0.1:1"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRedisService(tt.endpoints, "", "")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewRedisService() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRedisService_PubGetDelete(t *testing.T) {
+	r, m := newTestRedisService(t)
+	ctx := context.Background()
+	item := &ConfigItem{Tenant: "ten1", Project: "proj1", Environment: "dev", Key: "config"}
+	for _, v := range []string{"v1", "v2", "v3"} {
+		item.Value = v
+		if err := r.Pub(ctx, item); err != nil {
+			t.Fatalf("RedisService.Pub() error = %v", err)
+		}
+	}
+	if got := m.HGet("kubegems/ten1/proj1/dev", "config"); got != "v3" {
+		t.Errorf("hash field = %s, want v3", got)
+	}
+
+	got := &ConfigItem{Tenant: "ten1", Project: "proj1", Environment: "dev", Key: "config"}
+	if err := r.Get(ctx, got); err != nil || got.Value != "v3" {
+		t.Errorf("RedisService.Get() = %s, error = %v", got.Value, err)
+	}
+
+	history, err := r.History(ctx, item)
+	if err != nil {
+		t.Fatalf("RedisService.History() error = %v", err)
+	}
+	if len(history) != 3 || history[0].Version != "3" {
+		t.Errorf("RedisService.History() = %v", history)
+	}
+	got.Rev = 1
+	if err := r.Get(ctx, got); err != nil || got.Value != "v1" {
+		t.Errorf("RedisService.Get() with rev = %s, error = %v", got.Value, err)
+	}
+
+	if err := r.Delete(ctx, item); err != nil {
+		t.Errorf("RedisService.Delete() error = %v", err)
+	}
+	if m.Exists("kubegems/ten1/proj1/dev/config/history") {
+		t.Errorf("RedisService.Delete() should delete the history")
+	}
+	if err := r.Delete(ctx, item); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RedisService.Delete() missing key error = %v, want NotFound", err)
+	}
+	if err := r.Get(ctx, &ConfigItem{Tenant: "ten1", Project: "proj1", Environment: "dev", Key: "config"}); err == nil {
+		t.Errorf("RedisService.Get() deleted key should failed")
+	}
+	if err := r.Pub(ctx, &ConfigItem{Project: "proj1", Environment: "dev", Key: "config"}); err == nil {
+		t.Errorf("RedisService.Pub() without tenant should failed")
+	}
+}
+
+func TestRedisService_HistoryCapped(t *testing.T) {
+	r, _ := newTestRedisService(t)
+	ctx := context.Background()
+	item := &ConfigItem{Tenant: "ten1", Project: "proj1", Environment: "dev", Key: "config"}
+	for i := 0; i < RedisHistorySize+5; i++ {
+		if err := r.Pub(ctx, item); err != nil {
+			t.Fatalf("RedisService.Pub() error = %v", err)
+		}
+	}
+	history, err := r.History(ctx, item)
+	if err != nil {
+		t.Fatalf("RedisService.History() error = %v", err)
+	}
+	if len(history) != RedisHistorySize {
+		t.Errorf("RedisService.History() got %d versions, want %d", len(history), RedisHistorySize)
+	}
+}
+
+func TestRedisService_List(t *testing.T) {
+	r, _ := newTestRedisService(t)
+	ctx := context.Background()
+	for _, item := range []*ConfigItem{
+		{Tenant: "ten1", Project: "proj1", Environment: "dev", Key: "a", Value: "a"},
+		{Tenant: "ten1", Project: "proj1", Environment: "dev", Key: "b", Value: "b"},
+		{Tenant: "ten1", Project: "proj1", Environment: "prod", Key: "a", Value: "a"},
+		{Tenant: "ten1", Project: "proj2", Environment: "dev", Key: "a", Value: "a"},
+	} {
+		if err := r.Pub(ctx, item); err != nil {
+			t.Fatalf("RedisService.Pub() error = %v", err)
+		}
+	}
+	tests := []struct {
+		name    string
+		opts    *ListOptions
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "test list environment",
+			opts: &ListOptions{ConfigItem: ConfigItem{Tenant: "ten1", Project: "proj1", Environment: "dev"}},
+			want: 2,
+		},
+		{
+			name: "test list project",
+			opts: &ListOptions{ConfigItem: ConfigItem{Tenant: "ten1", Project: "proj1"}},
+			want: 3,
+		},
+		{
+			name:    "test list failed with no tenant",
+			opts:    &ListOptions{ConfigItem: ConfigItem{Project: "proj1"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.List(ctx, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RedisService.List() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != tt.want {
+				t.Errorf("RedisService.List() got %d items, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestRedisService_Listener(t *testing.T) {
+	r, m := newTestRedisService(t)
+	ctx := context.Background()
+	item := &ConfigItem{Tenant: "ten1", Project: "proj1", Environment: "dev", Key: "config"}
+
+	sub := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	defer sub.Close()
+	ps := sub.Subscribe(ctx, "__keyspace@0__:kubegems/ten1/proj1/dev")
+	defer ps.Close()
+	if _, err := ps.Receive(ctx); err != nil {
+		t.Fatalf("subscribe failed, %v", err)
+	}
+
+	got, err := r.Listener(ctx, item)
+	if err != nil {
+		t.Fatalf("RedisService.Listener() error = %v", err)
+	}
+	if got["__keyspace@0__:kubegems/ten1/proj1/dev"] != "1" {
+		t.Errorf("RedisService.Listener() = %v", got)
+	}
+}
+
+func TestRedisService_Accounts(t *testing.T) {
+	r := &RedisService{}
+	got, err := r.Accounts(&ConfigItem{
+		Tenant:      "t1",
+		Project:     "p1",
+		Environment: "e1",
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if got[0].Username != "kubegems/t1/p1/e1-r" {
+		t.Error("username is not right")
+	}
+	if got[1].Username != "kubegems/t1/p1/e1-rw" {
+		t.Error("username is not right")
+	}
+}
+
+func TestRedisService_SetUserFailed(t *testing.T) {
+	m := miniredis.RunT(t)
+	m.Server().Register("ACL", func(c *miniserver.Peer, cmd string, args []string) {
+		c.WriteError("NOPERM this user has no permissions to run the 'acl' command")
+	})
+	r, err := NewRedisService([]string{m.Addr()}, "", "")
+	if err != nil {
+		t.Fatalf("NewRedisService() error = %v", err)
+	}
+	item := &ConfigItem{Tenant: "ten1", Project: "proj1", Environment: "dev", Key: "config", Value: "v"}
+	if err := r.Pub(context.Background(), item); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("RedisService.Pub() error = %v, want Unauthorized", err)
+	}
+}
@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// referencePattern matches the references in values, such as ${secret:kv/data/app#password} or ${var:name}, the field is optional
+var referencePattern = regexp.MustCompile(`\$\{([a-zA-Z][a-zA-Z0-9-]*):([^}#]+)(?:#([^}]*))?\}`)
+
+// Reference is a reference in a value, it is replaced by the value it refers when rendered for applications
+type Reference struct {
+	Scheme string
+	Path   string
+	Field  string
+}
+
+func (r Reference) String() string {
+	if r.Field == "" {
+		return "${" + r.Scheme + ":" + r.Path + "}"
+	}
+	return "${" + r.Scheme + ":" + r.Path + "#" + r.Field + "}"
+}
+
+// ParseReferences returns the references in the value
+func ParseReferences(value string) []Reference {
+	ret := []Reference{}
+	for _, match := range referencePattern.FindAllStringSubmatch(value, -1) {
+		ret = append(ret, Reference{Scheme: match[1], Path: match[2], Field: match[3]})
+	}
+	return ret
+}
+
+// ReferenceResolver returns the value the reference in the item refers
+type ReferenceResolver interface {
+	Resolve(ctx context.Context, item *ConfigItem, ref Reference) (string, error)
+}
+
+type ReferenceResolverFunc func(ctx context.Context, item *ConfigItem, ref Reference) (string, error)
+
+func (f ReferenceResolverFunc) Resolve(ctx context.Context, item *ConfigItem, ref Reference) (string, error) {
+	return f(ctx, item, ref)
+}
+
+// ReferenceResolvers are the resolvers by scheme, references of other schemes are kept as is,
+// so placeholders of applications such as ${server.port:8080} are not affected
+type ReferenceResolvers map[string]ReferenceResolver
+
+// Render returns the value of item with the references replaced, the item is not changed
+func (resolvers ReferenceResolvers) Render(ctx context.Context, item *ConfigItem) (string, error) {
+	var rerr error
+	ret := referencePattern.ReplaceAllStringFunc(item.Value, func(match string) string {
+		sub := referencePattern.FindStringSubmatch(match)
+		ref := Reference{Scheme: sub[1], Path: sub[2], Field: sub[3]}
+		resolver, ok := resolvers[ref.Scheme]
+		if !ok || rerr != nil {
+			return match
+		}
+		value, err := resolver.Resolve(ctx, item, ref)
+		if err != nil {
+			rerr = err
+			return match
+		}
+		return value
+	})
+	if rerr != nil {
+		return "", rerr
+	}
+	return ret, nil
+}
+
+// CachedResolver caches the resolved values for ttl, so the backends of references are not called on every read
+func CachedResolver(resolver ReferenceResolver, ttl time.Duration) ReferenceResolver {
+	return &cachedResolver{resolver: resolver, ttl: ttl, values: map[string]cachedReference{}}
+}
+
+type cachedReference struct {
+	value     string
+	expiresAt time.Time
+}
+
+type cachedResolver struct {
+	resolver ReferenceResolver
+	ttl      time.Duration
+	values   map[string]cachedReference
+	lock     sync.Mutex
+}
+
+func (c *cachedResolver) Resolve(ctx context.Context, item *ConfigItem, ref Reference) (string, error) {
+	// the same reference may be resolved differently for projects, such as the namespaces allowed
+	key := strings.Join([]string{item.Tenant, item.Project, item.Environment, ref.String()}, "/")
+	now := time.Now()
+	c.lock.Lock()
+	cached, ok := c.values[key]
+	c.lock.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.value, nil
+	}
+	value, err := c.resolver.Resolve(ctx, item, ref)
+	if err != nil {
+		return "", err
+	}
+	c.lock.Lock()
+	for k, v := range c.values {
+		if !now.Before(v.expiresAt) {
+			delete(c.values, k)
+		}
+	}
+	c.values[key] = cachedReference{value: value, expiresAt: now.Add(c.ttl)}
+	c.lock.Unlock()
+	return value, nil
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReferenceResolvers_Render(t *testing.T) {
+	calls := 0
+	secrets := ReferenceResolverFunc(func(ctx context.Context, item *ConfigItem, ref Reference) (string, error) {
+		calls++
+		if ref.Path == "kv/data/app" && ref.Field == "password" {
+			return "s3cret", nil
+		}
+		return "", NotFoundError("%s not found", ref)
+	})
+	resolvers := ReferenceResolvers{"secret": CachedResolver(secrets, time.Minute)}
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "no reference", value: "port: 8080", want: "port: 8080"},
+		{name: "reference", value: "password: ${secret:kv/data/app#password}", want: "password: s3cret"},
+		{name: "references", value: "${secret:kv/data/app#password}/${secret:kv/data/app#password}", want: "s3cret/s3cret"},
+		{name: "unknown scheme is kept", value: "url: ${k8s-secret:ns/name#url} ${server.port:8080}", want: "url: ${k8s-secret:ns/name#url} ${server.port:8080}"},
+		{name: "missing secret", value: "password: ${secret:kv/data/other#password}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := &ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1", Key: "app.yaml", Value: tt.value}
+			got, err := resolvers.Render(context.Background(), item)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrNotFound)) {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Render() = %s, want %s", got, tt.want)
+			}
+			if item.Value != tt.value {
+				t.Errorf("Render() changed the item")
+			}
+		})
+	}
+	// the resolved value is cached, the missing one is not
+	if calls != 2 {
+		t.Errorf("resolver called %d times, want 2", calls)
+	}
+}
@@ -0,0 +1,326 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy is the exponential backoff with full jitter, the nth retry waits a random time in [0, min(MaxDelay, BaseDelay*2^n))
+type RetryPolicy struct {
+	// Attempts is the max number of calls including the first one
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:  3,
+	BaseDelay: 100 * time.Millisecond,
+	MaxDelay:  2 * time.Second,
+}
+
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.BaseDelay << retry
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// retryable reports whether the error is caused by the backend and may succeed next time
+func retryable(err error) bool {
+	switch CodeOf(err) {
+	case ErrorCodeBackendUnavailable, ErrorCodeTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+const (
+	DefaultBreakerFailureThreshold = 5
+	DefaultBreakerOpenTimeout      = 30 * time.Second
+)
+
+// CircuitBreaker rejects calls after FailureThreshold consecutive backend failures,
+// after OpenTimeout one call is let through to probe the backend, it closes again once the probe succeeds.
+type CircuitBreaker struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+
+	lock     sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+func NewCircuitBreaker() *CircuitBreaker {
+	return &CircuitBreaker{
+		FailureThreshold: DefaultBreakerFailureThreshold,
+		OpenTimeout:      DefaultBreakerOpenTimeout,
+		state:            BreakerClosed,
+		now:              time.Now,
+	}
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.OpenTimeout {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Failures returns the number of consecutive backend failures
+func (b *CircuitBreaker) Failures() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.failures
+}
+
+// allow returns an error if the call is rejected, every allowed call must be followed by done.
+// probe is true for the one call let through to probe the backend in the half-open state.
+func (b *CircuitBreaker) allow() (probe bool, err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.OpenTimeout {
+			return false, BackendUnavailableError("circuit breaker is open, backend failed %d times", b.failures)
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true, nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return false, BackendUnavailableError("circuit breaker is half-open, waiting for the probe")
+		}
+		b.probing = true
+		return true, nil
+	}
+	return false, nil
+}
+
+func (b *CircuitBreaker) done(ctx context.Context, probe bool, err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if probe {
+		b.probing = false
+	} else if b.state != BreakerClosed {
+		// a call allowed before the breaker opened, only the probe decides once it is open
+		return
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		// canceled by the caller, it tells nothing about the backend
+		if b.state == BreakerHalfOpen {
+			b.state = BreakerOpen
+		}
+		return
+	}
+	if !retryable(err) {
+		// errors such as NotFound mean the backend works
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.FailureThreshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// CASPublisher is implemented by backends which can publish with compare and swap, retrying such a publish is safe
+type CASPublisher interface {
+	// Revision returns the current revision of the item, 0 if it does not exist
+	Revision(ctx context.Context, item *ConfigItem) (int64, error)
+	// PubCAS publishes the item only if its current revision is prevRev, otherwise returns a Conflict error
+	PubCAS(ctx context.Context, item *ConfigItem, prevRev int64) error
+}
+
+// ResilientClient wraps a backend with retries and a circuit breaker.
+// only idempotent calls are retried: Get, List, History, and Pub if the backend is a CASPublisher.
+type ResilientClient struct {
+	Retry   RetryPolicy
+	Breaker *CircuitBreaker
+
+	inner ConfigClientIface
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+var _ ConfigClientIface = &ResilientClient{}
+
+func NewResilientClient(inner ConfigClientIface, breaker *CircuitBreaker) *ResilientClient {
+	if breaker == nil {
+		breaker = NewCircuitBreaker()
+	}
+	return &ResilientClient{
+		Retry:   DefaultRetryPolicy,
+		Breaker: breaker,
+		inner:   inner,
+		sleep:   sleepContext,
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return errorOfContext(ctx, ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Unwrap returns the wrapped backend
+func (r *ResilientClient) Unwrap() ConfigClientIface {
+	return r.inner
+}
+
+// Close closes the wrapped backend if it can be closed
+func (r *ResilientClient) Close() error {
+	if closer, ok := r.inner.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// call calls fn once through the circuit breaker
+func (r *ResilientClient) call(ctx context.Context, fn func() error) error {
+	probe, err := r.Breaker.allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	r.Breaker.done(ctx, probe, err)
+	return err
+}
+
+// retry calls fn until it succeeds, fails with an error not retryable or runs out of attempts
+func (r *ResilientClient) retry(ctx context.Context, fn func(attempt int) error) error {
+	var err error
+	for attempt := 0; attempt < r.Retry.Attempts || attempt == 0; attempt++ {
+		if attempt > 0 {
+			if serr := r.sleep(ctx, r.Retry.backoff(attempt-1)); serr != nil {
+				return err
+			}
+		}
+		err = r.call(ctx, func() error { return fn(attempt) })
+		if err == nil || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func (r *ResilientClient) BaseInfo(ctx context.Context, item *ConfigItem) (map[string]string, error) {
+	info, err := r.inner.BaseInfo(ctx, item)
+	if info != nil {
+		info["circuit_breaker"] = string(r.Breaker.State())
+		info["circuit_breaker_failures"] = strconv.Itoa(r.Breaker.Failures())
+	}
+	return info, err
+}
+
+func (r *ResilientClient) Get(ctx context.Context, item *ConfigItem) error {
+	return r.retry(ctx, func(int) error { return r.inner.Get(ctx, item) })
+}
+
+func (r *ResilientClient) Pub(ctx context.Context, item *ConfigItem) error {
+	cas, ok := r.inner.(CASPublisher)
+	if !ok {
+		return r.call(ctx, func() error { return r.inner.Pub(ctx, item) })
+	}
+	var rev int64
+	if err := r.retry(ctx, func(int) error {
+		var err error
+		rev, err = cas.Revision(ctx, item)
+		return err
+	}); err != nil {
+		return err
+	}
+	return r.retry(ctx, func(attempt int) error {
+		err := cas.PubCAS(ctx, item, rev)
+		if attempt > 0 && errors.Is(err, ErrConflict) {
+			// the previous attempt may have succeeded without a response
+			current := *item
+			if gerr := r.inner.Get(ctx, &current); gerr == nil && current.Value == item.Value {
+				return nil
+			}
+		}
+		return err
+	})
+}
+
+func (r *ResilientClient) Delete(ctx context.Context, item *ConfigItem) error {
+	return r.call(ctx, func() error { return r.inner.Delete(ctx, item) })
+}
+
+func (r *ResilientClient) List(ctx context.Context, opts *ListOptions) ([]*ConfigItem, error) {
+	var ret []*ConfigItem
+	err := r.retry(ctx, func(int) error {
+		var err error
+		ret, err = r.inner.List(ctx, opts)
+		return err
+	})
+	return ret, err
+}
+
+func (r *ResilientClient) History(ctx context.Context, item *ConfigItem) ([]*HistoryVersion, error) {
+	var ret []*HistoryVersion
+	err := r.retry(ctx, func(int) error {
+		var err error
+		ret, err = r.inner.History(ctx, item)
+		return err
+	})
+	return ret, err
+}
+
+func (r *ResilientClient) Accounts(item *ConfigItem) ([]Account, error) {
+	return r.inner.Accounts(item)
+}
+
+// RotateAccounts rotates the accounts of the wrapped backend once through the circuit breaker
+func (r *ResilientClient) RotateAccounts(ctx context.Context, item *ConfigItem, grace time.Duration) ([]RotatedAccount, error) {
+	rotator, ok := r.inner.(AccountRotator)
+	if !ok {
+		return nil, InvalidArgumentError("accounts of %T can not be rotated", r.inner)
+	}
+	var ret []RotatedAccount
+	err := r.call(ctx, func() error {
+		var err error
+		ret, err = rotator.RotateAccounts(ctx, item, grace)
+		return err
+	})
+	return ret, err
+}
+
+func (r *ResilientClient) Listener(ctx context.Context, item *ConfigItem) (map[string]string, error) {
+	var ret map[string]string
+	err := r.call(ctx, func() error {
+		var err error
+		ret, err = r.inner.Listener(ctx, item)
+		return err
+	})
+	return ret, err
+}
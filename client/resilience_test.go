@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// flakyClient fails the first failures calls of each method with err
+type flakyClient struct {
+	ConfigClientIface
+	err      error
+	failures int
+	calls    map[string]int
+	value    string
+	rev      int64
+	// lostResponse makes PubCAS apply the value but return err
+	lostResponse bool
+}
+
+func (f *flakyClient) fail(method string) error {
+	f.calls[method]++
+	if f.calls[method] <= f.failures {
+		return f.err
+	}
+	return nil
+}
+
+func (f *flakyClient) Get(ctx context.Context, item *ConfigItem) error {
+	if err := f.fail("Get"); err != nil {
+		return err
+	}
+	item.Value = f.value
+	return nil
+}
+
+func (f *flakyClient) Delete(ctx context.Context, item *ConfigItem) error {
+	return f.fail("Delete")
+}
+
+func (f *flakyClient) BaseInfo(ctx context.Context, item *ConfigItem) (map[string]string, error) {
+	return map[string]string{"provider": "fake"}, nil
+}
+
+type casClient struct {
+	*flakyClient
+}
+
+func (f casClient) Revision(ctx context.Context, item *ConfigItem) (int64, error) {
+	return f.rev, nil
+}
+
+func (f casClient) PubCAS(ctx context.Context, item *ConfigItem, prevRev int64) error {
+	f.calls["PubCAS"]++
+	if prevRev != f.rev {
+		return ConflictError("conflict")
+	}
+	f.value, f.rev = item.Value, f.rev+1
+	if f.lostResponse && f.calls["PubCAS"] == 1 {
+		return f.err
+	}
+	return nil
+}
+
+func TestResilientClient(t *testing.T) {
+	unavailable := BackendUnavailableError("down")
+	tests := []struct {
+		name      string
+		inner     *flakyClient
+		cas       bool
+		call      func(r *ResilientClient) error
+		method    string
+		wantErr   error
+		wantCalls int
+	}{
+		{
+			name:      "get retried until success",
+			inner:     &flakyClient{err: unavailable, failures: 2},
+			call:      func(r *ResilientClient) error { return r.Get(context.Background(), &ConfigItem{}) },
+			method:    "Get",
+			wantCalls: 3,
+		},
+		{
+			name:      "get gives up after attempts",
+			inner:     &flakyClient{err: unavailable, failures: 5},
+			call:      func(r *ResilientClient) error { return r.Get(context.Background(), &ConfigItem{}) },
+			method:    "Get",
+			wantErr:   ErrBackendUnavailable,
+			wantCalls: 3,
+		},
+		{
+			name:      "not found is not retried",
+			inner:     &flakyClient{err: NotFoundError("missing"), failures: 5},
+			call:      func(r *ResilientClient) error { return r.Get(context.Background(), &ConfigItem{}) },
+			method:    "Get",
+			wantErr:   ErrNotFound,
+			wantCalls: 1,
+		},
+		{
+			name:      "delete is not retried",
+			inner:     &flakyClient{err: unavailable, failures: 1},
+			call:      func(r *ResilientClient) error { return r.Delete(context.Background(), &ConfigItem{}) },
+			method:    "Delete",
+			wantErr:   ErrBackendUnavailable,
+			wantCalls: 1,
+		},
+		{
+			name:      "cas pub retried when response lost",
+			inner:     &flakyClient{err: unavailable, lostResponse: true},
+			cas:       true,
+			call:      func(r *ResilientClient) error { return r.Pub(context.Background(), &ConfigItem{Value: "v1"}) },
+			method:    "PubCAS",
+			wantCalls: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.inner.calls = map[string]int{}
+			var inner ConfigClientIface = tt.inner
+			if tt.cas {
+				inner = casClient{tt.inner}
+			}
+			r := NewResilientClient(inner, nil)
+			r.sleep = func(context.Context, time.Duration) error { return nil }
+			if err := tt.call(r); !errors.Is(err, tt.wantErr) && !(err == nil && tt.wantErr == nil) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if got := tt.inner.calls[tt.method]; got != tt.wantCalls {
+				t.Errorf("%s called %d times, want %d", tt.method, got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker()
+	breaker.now = func() time.Time { return now }
+	inner := &flakyClient{err: BackendUnavailableError("down"), failures: 100, calls: map[string]int{}}
+	r := NewResilientClient(inner, breaker)
+	r.Retry.Attempts = 1
+
+	for i := 0; i < breaker.FailureThreshold; i++ {
+		r.Delete(context.Background(), &ConfigItem{})
+	}
+	if breaker.State() != BreakerOpen {
+		t.Fatalf("State() = %s after %d failures, want open", breaker.State(), breaker.FailureThreshold)
+	}
+	r.Delete(context.Background(), &ConfigItem{})
+	if inner.calls["Delete"] != breaker.FailureThreshold {
+		t.Errorf("open breaker let the call through")
+	}
+	info, _ := r.BaseInfo(context.Background(), &ConfigItem{})
+	if info["circuit_breaker"] != string(BreakerOpen) {
+		t.Errorf("BaseInfo() = %v, want breaker state", info)
+	}
+
+	// the probe fails and opens the breaker again
+	now = now.Add(breaker.OpenTimeout)
+	if breaker.State() != BreakerHalfOpen {
+		t.Fatalf("State() = %s after open timeout, want half-open", breaker.State())
+	}
+	r.Delete(context.Background(), &ConfigItem{})
+	if breaker.State() != BreakerOpen || inner.calls["Delete"] != breaker.FailureThreshold+1 {
+		t.Fatalf("failed probe should open the breaker, state %s", breaker.State())
+	}
+
+	// the probe succeeds and closes the breaker
+	now = now.Add(breaker.OpenTimeout)
+	inner.failures = 0
+	if err := r.Delete(context.Background(), &ConfigItem{}); err != nil || breaker.State() != BreakerClosed {
+		t.Fatalf("succeeded probe should close the breaker, state %s, err %v", breaker.State(), err)
+	}
+}
+
+func TestCircuitBreaker_StaleCall(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker()
+	breaker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// a call allowed before the breaker opens finishes while the probe is running
+	stale, _ := breaker.allow()
+	for i := 0; i < breaker.FailureThreshold; i++ {
+		probe, _ := breaker.allow()
+		breaker.done(ctx, probe, BackendUnavailableError("down"))
+	}
+	now = now.Add(breaker.OpenTimeout)
+	probe, err := breaker.allow()
+	if err != nil || !probe {
+		t.Fatalf("allow() = %v, %v after open timeout, want the probe", probe, err)
+	}
+	breaker.done(ctx, stale, nil)
+	if _, err := breaker.allow(); err == nil {
+		t.Fatalf("a second probe is allowed after a stale call finished")
+	}
+	if breaker.State() != BreakerHalfOpen {
+		t.Fatalf("State() = %s after a stale call finished, want half-open", breaker.State())
+	}
+	breaker.done(ctx, probe, nil)
+	if breaker.State() != BreakerClosed {
+		t.Fatalf("State() = %s after the probe succeeded, want closed", breaker.State())
+	}
+}
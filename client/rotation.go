@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// CredentialRotator is implemented by the credential stores which can change the passwords
+type CredentialRotator interface {
+	// Rotate generates a new password of the account, backends apply it and call MarkApplied
+	Rotate(ctx context.Context, username string) (*Credential, error)
+}
+
+// RotatedAccount is an account with the new password.
+// Shadow is the account the old password keeps valid for until ShadowExpiresAt, it is nil without grace period.
+type RotatedAccount struct {
+	Username        string     `json:"username"`
+	Password        string     `json:"password"`
+	Shadow          *Account   `json:"shadow,omitempty"`
+	ShadowExpiresAt *time.Time `json:"shadowExpiresAt,omitempty"`
+}
+
+// AccountRotator is implemented by the backends whose accounts can be rotated
+type AccountRotator interface {
+	// RotateAccounts sets new passwords of the r/rw accounts of the environment of item,
+	// the old passwords keep valid by shadow accounts for grace if it is positive
+	RotateAccounts(ctx context.Context, item *ConfigItem, grace time.Duration) ([]RotatedAccount, error)
+}
+
+var _ AccountRotator = &NacosService{}
+var _ AccountRotator = &EtcdService{}
+var _ AccountRotator = &RedisService{}
+var _ AccountRotator = &ResilientClient{}
+
+// ShadowUsername is the name of the account keeping the old password of user during the grace period
+func ShadowUsername(user string) string {
+	return user + ":previous"
+}
+
+// ShadowRemoveTimeout is the timeout to remove the shadow accounts after the grace period
+var ShadowRemoveTimeout = 30 * time.Second
+
+// rotateCredentials generates new passwords of the users in store, old are the credentials before rotated
+func rotateCredentials(ctx context.Context, store CredentialStore, users ...string) (old, rotated []*Credential, err error) {
+	rotator, ok := store.(CredentialRotator)
+	if !ok {
+		return nil, nil, InvalidArgumentError("passwords derived from usernames can not be rotated, a credential store is required")
+	}
+	for _, user := range users {
+		cred, err := store.Credential(ctx, user)
+		if err != nil {
+			return nil, nil, err
+		}
+		newCred, err := rotator.Rotate(ctx, user)
+		if err != nil {
+			return nil, nil, err
+		}
+		old, rotated = append(old, cred), append(rotated, newCred)
+	}
+	return old, rotated, nil
+}
+
+// rotatedAccounts returns the accounts of the rotated credentials, shadows keep the old passwords
+func rotatedAccounts(rotated []*Credential, shadows []Shadow, grace time.Duration) []RotatedAccount {
+	ret := make([]RotatedAccount, len(rotated))
+	for i, cred := range rotated {
+		ret[i].Username, ret[i].Password = cred.Username, cred.Password
+		if grace > 0 {
+			ret[i].Shadow, ret[i].ShadowExpiresAt = &shadows[i].Account, &shadows[i].ExpiresAt
+		}
+	}
+	return ret
+}
+
+// Shadow is a shadow account keeping the old password of User until ExpiresAt
+type Shadow struct {
+	// ID identifies the shadow in the ShadowStore
+	ID      uint
+	User    string
+	Account Account
+	// Role is granted to the shadow account by the backends granting roles to accounts
+	Role      string
+	ExpiresAt time.Time
+}
+
+// ShadowStore is optionally implemented by the credential stores to keep the shadow accounts until they are removed,
+// the expired ones are removed by the next rotation if the process exits during the grace period
+type ShadowStore interface {
+	AddShadow(ctx context.Context, shadow Shadow) error
+	Shadows(ctx context.Context) ([]Shadow, error)
+	RemoveShadow(ctx context.Context, shadow Shadow) error
+}
+
+// recordShadows records the shadows before they are set, so they are removed even if the process exits during grace
+func recordShadows(ctx context.Context, store CredentialStore, shadows []Shadow) error {
+	shadowStore, ok := store.(ShadowStore)
+	if !ok {
+		return nil
+	}
+	for _, shadow := range shadows {
+		if err := shadowStore.AddShadow(ctx, shadow); err != nil {
+			return fmt.Errorf("record shadow of %s failed, %w", shadow.User, err)
+		}
+	}
+	return nil
+}
+
+// sweepShadows removes the expired shadows recorded in store, the ones failed to remove are kept for the next sweep.
+// a shadow is kept if another one of the same account is not expired, as the backend may keep one password of the account
+func sweepShadows(ctx context.Context, store CredentialStore, remove func(ctx context.Context, shadow Shadow) error) {
+	shadowStore, ok := store.(ShadowStore)
+	if !ok {
+		return
+	}
+	shadows, err := shadowStore.Shadows(ctx)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	alive := map[string]bool{}
+	for _, shadow := range shadows {
+		if shadow.ExpiresAt.After(now) {
+			alive[shadow.Account.Username] = true
+		}
+	}
+	for _, shadow := range shadows {
+		if shadow.ExpiresAt.After(now) || alive[shadow.Account.Username] {
+			continue
+		}
+		if err := remove(ctx, shadow); err != nil {
+			continue
+		}
+		shadowStore.RemoveShadow(ctx, shadow)
+	}
+}
+
+// removeShadowsAfter removes the shadows once the grace period passed
+func removeShadowsAfter(grace time.Duration, store CredentialStore, shadows []Shadow, remove func(ctx context.Context, shadow Shadow) error) {
+	time.AfterFunc(grace, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), ShadowRemoveTimeout)
+		defer cancel()
+		if _, ok := store.(ShadowStore); ok {
+			sweepShadows(ctx, store, remove)
+			return
+		}
+		for _, shadow := range shadows {
+			remove(ctx, shadow)
+		}
+	})
+}
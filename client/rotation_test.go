@@ -0,0 +1,218 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc"
+)
+
+func (m *memCredentials) Rotate(ctx context.Context, username string) (*Credential, error) {
+	password, err := RandomPassword()
+	if err != nil {
+		return nil, err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.creds[username] = &Credential{Username: username, Password: password}
+	return &Credential{Username: username, Password: password}, nil
+}
+
+// passwordAuthServer keeps the passwords of the users
+type passwordAuthServer struct {
+	mockAuthServer
+	lock      sync.Mutex
+	passwords map[string]string
+}
+
+func (a *passwordAuthServer) UserAdd(ctx context.Context, req *pb.AuthUserAddRequest) (*pb.AuthUserAddResponse, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if _, ok := a.passwords[req.Name]; ok {
+		return nil, errors.New("user name already exists")
+	}
+	a.passwords[req.Name] = req.Password
+	return &pb.AuthUserAddResponse{}, nil
+}
+
+func (a *passwordAuthServer) UserChangePassword(ctx context.Context, req *pb.AuthUserChangePasswordRequest) (*pb.AuthUserChangePasswordResponse, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.passwords[req.Name] = req.Password
+	return &pb.AuthUserChangePasswordResponse{}, nil
+}
+
+func (a *passwordAuthServer) UserDelete(ctx context.Context, req *pb.AuthUserDeleteRequest) (*pb.AuthUserDeleteResponse, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.passwords, req.Name)
+	return &pb.AuthUserDeleteResponse{}, nil
+}
+
+func (a *passwordAuthServer) password(user string) (string, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	password, ok := a.passwords[user]
+	return password, ok
+}
+
+func TestEtcdService_RotateAccounts(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := &passwordAuthServer{passwords: map[string]string{}}
+	svr := grpc.NewServer()
+	pb.RegisterKVServer(svr, &mockKVServer{})
+	pb.RegisterAuthServer(svr, auth)
+	go svr.Serve(ln)
+	defer svr.Stop()
+
+	store := &memCredentials{creds: map[string]*Credential{}}
+	etcd, err := NewEtcdService([]string{ln.Addr().String()}, "root", "root", WithEtcdCredentials(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer etcd.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	item := &ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1"}
+	before, err := etcd.Accounts(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grace := 100 * time.Millisecond
+	rotated, err := etcd.RotateAccounts(ctx, item, grace)
+	if err != nil {
+		t.Fatalf("RotateAccounts() error = %v", err)
+	}
+	for i, account := range rotated {
+		if password, _ := auth.password(account.Username); password != account.Password || password == before[i].Password {
+			t.Errorf("password of %s is not rotated", account.Username)
+		}
+		if account.Shadow == nil || account.Shadow.Username != ShadowUsername(account.Username) {
+			t.Fatalf("shadow of %s = %v, want %s", account.Username, account.Shadow, ShadowUsername(account.Username))
+		}
+		if password, _ := auth.password(account.Shadow.Username); password != before[i].Password {
+			t.Errorf("shadow %s should keep the old password", account.Shadow.Username)
+		}
+		if !store.creds[account.Username].Applied {
+			t.Errorf("rotated credential of %s is not marked applied", account.Username)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, account := range rotated {
+		for {
+			if _, ok := auth.password(account.Shadow.Username); !ok {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("shadow %s is not removed after the grace period", account.Shadow.Username)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	derived, err := NewEtcdService([]string{ln.Addr().String()}, "root", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer derived.Close()
+	if _, err := derived.RotateAccounts(ctx, item, 0); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("RotateAccounts() of derived passwords error = %v, want InvalidArgument", err)
+	}
+}
+
+// memShadowCredentials keeps the shadows in memory as the database of the service does
+type memShadowCredentials struct {
+	*memCredentials
+	shadows []Shadow
+}
+
+func (m *memShadowCredentials) AddShadow(ctx context.Context, shadow Shadow) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	shadow.ID = uint(len(m.shadows) + 1)
+	m.shadows = append(m.shadows, shadow)
+	return nil
+}
+
+func (m *memShadowCredentials) Shadows(ctx context.Context) ([]Shadow, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]Shadow{}, m.shadows...), nil
+}
+
+func (m *memShadowCredentials) RemoveShadow(ctx context.Context, shadow Shadow) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for i := range m.shadows {
+		if m.shadows[i].ID == shadow.ID {
+			m.shadows = append(m.shadows[:i], m.shadows[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func TestEtcdService_RotateAccountsSweepShadows(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := &passwordAuthServer{passwords: map[string]string{}}
+	svr := grpc.NewServer()
+	pb.RegisterKVServer(svr, &mockKVServer{})
+	pb.RegisterAuthServer(svr, auth)
+	go svr.Serve(ln)
+	defer svr.Stop()
+
+	store := &memShadowCredentials{memCredentials: &memCredentials{creds: map[string]*Credential{}}}
+	etcd, err := NewEtcdService([]string{ln.Addr().String()}, "root", "root", WithEtcdCredentials(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer etcd.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	item := &ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1"}
+
+	rotated, err := etcd.RotateAccounts(ctx, item, time.Hour)
+	if err != nil {
+		t.Fatalf("RotateAccounts() error = %v", err)
+	}
+	shadows, _ := store.Shadows(ctx)
+	if len(shadows) != len(rotated) {
+		t.Fatalf("recorded shadows = %v, want %d", shadows, len(rotated))
+	}
+	for i, shadow := range shadows {
+		if shadow.Account != *rotated[i].Shadow || !shadow.ExpiresAt.Equal(*rotated[i].ShadowExpiresAt) {
+			t.Errorf("recorded shadow = %v, want %v", shadow, rotated[i].Shadow)
+		}
+	}
+
+	// expired while the process was not running, the timer of the grace period is lost
+	store.lock.Lock()
+	for i := range store.shadows {
+		store.shadows[i].ExpiresAt = time.Now().Add(-time.Minute)
+	}
+	store.lock.Unlock()
+	if _, err := etcd.RotateAccounts(ctx, item, 0); err != nil {
+		t.Fatalf("RotateAccounts() error = %v", err)
+	}
+	for _, account := range rotated {
+		if _, ok := auth.password(account.Shadow.Username); ok {
+			t.Errorf("expired shadow %s should be removed by the next rotation", account.Shadow.Username)
+		}
+	}
+	if shadows, _ := store.Shadows(ctx); len(shadows) != 0 {
+		t.Errorf("removed shadows should be forgotten, got %v", shadows)
+	}
+}
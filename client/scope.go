@@ -0,0 +1,39 @@
+package client
+
+import "strings"
+
+// ApplicationKeyDelimiter separates the application name from the rest of the keys of the application,
+// so the keys of app1 are not granted to app10. "/" is not used as etcd keys and nacos data ids can not contain it
+const ApplicationKeyDelimiter = "."
+
+// ApplicationAccountsFunc reports whether the project uses per-application accounts.
+// in such projects the config keys of an application must start with the application name and ApplicationKeyDelimiter,
+// and the accounts of the application are granted the keys with the prefix only.
+// configs without application are shared, only the accounts of the environment can access them.
+type ApplicationAccountsFunc func(tenant, project string) bool
+
+// enabled reports whether the accounts of item are the accounts of its application
+func (f ApplicationAccountsFunc) enabled(item *ConfigItem) bool {
+	return f != nil && item.Application != "" && f(item.Tenant, item.Project)
+}
+
+// checkKey returns an error if the key of the item is out of the permissions of its application accounts
+func (f ApplicationAccountsFunc) checkKey(item *ConfigItem) error {
+	if f.enabled(item) && !strings.HasPrefix(item.Key, applicationKeyPrefix(item.Application)) {
+		return InvalidArgumentError("key %s must start with %s, as the project uses per-application accounts",
+			item.Key, applicationKeyPrefix(item.Application))
+	}
+	return nil
+}
+
+// applicationKeyPrefix is the prefix of the keys of the application
+func applicationKeyPrefix(application string) string {
+	return application + ApplicationKeyDelimiter
+}
+
+// environmentItem returns the item without application, its accounts are the accounts of the environment
+func environmentItem(item *ConfigItem) *ConfigItem {
+	ret := *item
+	ret.Application = ""
+	return &ret
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestApplicationAccounts(t *testing.T) {
+	scoped := ApplicationAccountsFunc(func(tenant, project string) bool { return project == "p1" })
+	tests := []struct {
+		name         string
+		item         *ConfigItem
+		wantNacos    [2]string // read user and resource
+		wantEtcd     [2]string // read user and the start of the permission range
+		wantKeyError bool
+	}{
+		{
+			name:      "shared config",
+			item:      &ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1", Key: "common.yaml"},
+			wantNacos: [2]string{"kubegems/t1/p1:e1:r", NacosTenantID("t1", "p1") + ":e1"},
+			wantEtcd:  [2]string{"kubegems/t1/p1/e1-r", "kubegems/t1/p1/e1"},
+		},
+		{
+			name:      "application config",
+			item:      &ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1", Application: "app1", Key: "app1.e1.yaml"},
+			wantNacos: [2]string{"kubegems/t1/p1:e1:app1:r", NacosTenantID("t1", "p1") + ":e1:config/app1.*"},
+			wantEtcd:  [2]string{"kubegems/t1/p1/e1/app1-r", "kubegems/t1/p1/e1/app1."},
+		},
+		{
+			name:         "key without application prefix",
+			item:         &ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1", Application: "app1", Key: "other.yaml"},
+			wantNacos:    [2]string{"kubegems/t1/p1:e1:app1:r", NacosTenantID("t1", "p1") + ":e1:config/app1.*"},
+			wantEtcd:     [2]string{"kubegems/t1/p1/e1/app1-r", "kubegems/t1/p1/e1/app1."},
+			wantKeyError: true,
+		},
+		{
+			name:         "key of another application prefixed by the name",
+			item:         &ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1", Application: "app1", Key: "app10.yaml"},
+			wantNacos:    [2]string{"kubegems/t1/p1:e1:app1:r", NacosTenantID("t1", "p1") + ":e1:config/app1.*"},
+			wantEtcd:     [2]string{"kubegems/t1/p1/e1/app1-r", "kubegems/t1/p1/e1/app1."},
+			wantKeyError: true,
+		},
+		{
+			name:         "key without delimiter",
+			item:         &ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1", Application: "api", Key: "api-gateway.yaml"},
+			wantNacos:    [2]string{"kubegems/t1/p1:e1:api:r", NacosTenantID("t1", "p1") + ":e1:config/api.*"},
+			wantEtcd:     [2]string{"kubegems/t1/p1/e1/api-r", "kubegems/t1/p1/e1/api."},
+			wantKeyError: true,
+		},
+		{
+			name:      "project without application accounts",
+			item:      &ConfigItem{Tenant: "t1", Project: "p2", Environment: "e1", Application: "app1", Key: "other.yaml"},
+			wantNacos: [2]string{"kubegems/t1/p2:e1:r", NacosTenantID("t1", "p2") + ":e1"},
+			wantEtcd:  [2]string{"kubegems/t1/p2/e1-r", "kubegems/t1/p2/e1"},
+		},
+	}
+	nacos := &NacosService{applicationAccounts: scoped}
+	etcd := &EtcdService{applicationAccounts: scoped}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rUser, _, _, _, resource := nacos.userRolesFor(&NacosDataMapper{item: tt.item})
+			if got := [2]string{rUser, resource}; got != tt.wantNacos {
+				t.Errorf("nacos userRolesFor() = %v, want %v", got, tt.wantNacos)
+			}
+			mapper := &EtcdMapper{item: tt.item}
+			rUser, _, _, _ = etcd.userRolesFor(mapper)
+			key, _ := etcd.permissionRange(mapper)
+			if got := [2]string{rUser, key}; got != tt.wantEtcd {
+				t.Errorf("etcd userRolesFor() = %v, want %v", got, tt.wantEtcd)
+			}
+			if err := scoped.checkKey(tt.item); (err != nil) != tt.wantKeyError || (err != nil && !errors.Is(err, ErrInvalidArgument)) {
+				t.Errorf("checkKey() error = %v, wantErr %v", err, tt.wantKeyError)
+			}
+			if !tt.wantKeyError {
+				return
+			}
+			// keys out of the permissions are rejected before reaching the backend
+			if err := etcd.Delete(context.Background(), tt.item); !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("etcd Delete() error = %v, want invalid argument", err)
+			}
+			if err := nacos.Delete(context.Background(), tt.item); !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("nacos Delete() error = %v, want invalid argument", err)
+			}
+		})
+	}
+}
+
+func TestApplicationAccounts_PrefixedNames(t *testing.T) {
+	scoped := ApplicationAccountsFunc(func(tenant, project string) bool { return true })
+	etcd := &EtcdService{applicationAccounts: scoped}
+	apps := []struct{ app, other string }{{"app1", "app10"}, {"api", "api-gateway"}}
+	for _, tt := range apps {
+		item := &ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1", Application: tt.app}
+		start, end := etcd.permissionRange(&EtcdMapper{item: item})
+		other := &EtcdMapper{item: &ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1", Application: tt.other, Key: tt.other + ".yaml"}}
+		if key := other.Key(); key >= start && key < end {
+			t.Errorf("key %s of %s is granted to %s by range [%s, %s)", key, tt.other, tt.app, start, end)
+		}
+		own := &EtcdMapper{item: &ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1", Application: tt.app, Key: tt.app + ".yaml"}}
+		if key := own.Key(); key < start || key >= end {
+			t.Errorf("key %s of %s is not granted by range [%s, %s)", key, tt.app, start, end)
+		}
+		if err := scoped.checkKey(other.item); err != nil {
+			t.Errorf("checkKey() of %s error = %v", tt.other, err)
+		}
+		_, _, _, _, resource := (&NacosService{applicationAccounts: scoped}).userRolesFor(&NacosDataMapper{item: item})
+		if matched, _ := path.Match(strings.SplitN(resource, ":config/", 2)[1], tt.other+".yaml"); matched {
+			t.Errorf("data id %s.yaml of %s is granted to %s by resource %s", tt.other, tt.other, tt.app, resource)
+		}
+	}
+}
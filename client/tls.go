@@ -0,0 +1,65 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+)
+
+// TLSConfig is the tls of the connections to a backend, certificates and keys are PEM encoded
+type TLSConfig struct {
+	// CA is the bundle to verify the server, the system roots are used if empty
+	CA string `json:"ca,omitempty"`
+	// Cert and Key are the client certificate for mTLS
+	Cert       string `json:"cert,omitempty"`
+	Key        string `json:"key,omitempty"`
+	ServerName string `json:"serverName,omitempty"`
+	// InsecureSkipVerify skips verifying the server, only for development
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// Build returns the tls.Config, nil if c is nil
+func (c *TLSConfig) Build() (*tls.Config, error) {
+	if c == nil {
+		return nil, nil
+	}
+	cfg := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if c.CA != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(c.CA)) {
+			return nil, InvalidArgumentError("no valid certificate in ca bundle")
+		}
+		cfg.RootCAs = pool
+	}
+	if c.Cert != "" || c.Key != "" {
+		cert, err := tls.X509KeyPair([]byte(c.Cert), []byte(c.Key))
+		if err != nil {
+			return nil, InvalidArgumentError("invalid client certificate, %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// transportWithTLS returns base with the tls applied, base must be nil or an *http.Transport
+func transportWithTLS(base http.RoundTripper, cfg *tls.Config) (http.RoundTripper, error) {
+	if cfg == nil {
+		return base, nil
+	}
+	switch t := base.(type) {
+	case nil:
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = cfg
+		return transport, nil
+	case *http.Transport:
+		transport := t.Clone()
+		transport.TLSClientConfig = cfg
+		return transport, nil
+	default:
+		return nil, InvalidArgumentError("tls can not be applied to round tripper %T", base)
+	}
+}
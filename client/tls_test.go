@@ -0,0 +1,189 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM string
+	keyPEM  string
+}
+
+func (c testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair([]byte(c.certPEM), []byte(c.keyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// newTestCert issues a certificate signed by parent, it is self-signed if parent is nil
+func newTestCert(t *testing.T, name string, parent *testCert, usage x509.ExtKeyUsage) testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		keyPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+	}
+}
+
+// newTestPKI returns a ca, a server certificate and a client certificate
+func newTestPKI(t *testing.T) (ca, server, client testCert) {
+	ca = newTestCert(t, "test ca", nil, x509.ExtKeyUsageAny)
+	server = newTestCert(t, "localhost", &ca, x509.ExtKeyUsageServerAuth)
+	client = newTestCert(t, "configer", &ca, x509.ExtKeyUsageClientAuth)
+	return
+}
+
+func serverTLS(t *testing.T, ca, server testCert) *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return &tls.Config{
+		Certificates: []tls.Certificate{server.tlsCertificate(t)},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+}
+
+func TestTLSConfig_Build(t *testing.T) {
+	ca, _, cli := newTestPKI(t)
+	tests := []struct {
+		name    string
+		config  *TLSConfig
+		wantErr bool
+	}{
+		{name: "nil", config: nil},
+		{name: "mtls", config: &TLSConfig{CA: ca.certPEM, Cert: cli.certPEM, Key: cli.keyPEM, ServerName: "localhost"}},
+		{name: "insecure", config: &TLSConfig{InsecureSkipVerify: true}},
+		{name: "invalid ca", config: &TLSConfig{CA: "not a pem"}, wantErr: true},
+		{name: "key without cert", config: &TLSConfig{Key: cli.keyPEM}, wantErr: true},
+		{name: "mismatched key", config: &TLSConfig{Cert: cli.certPEM, Key: ca.keyPEM}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := tt.config.Build()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Build() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("Build() error = %v, want InvalidArgument", err)
+			}
+			if tt.config == nil && cfg != nil {
+				t.Errorf("Build() of nil = %v, want nil", cfg)
+			}
+		})
+	}
+}
+
+func TestNacosService_TLS(t *testing.T) {
+	ca, srv, cli := newTestPKI(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"accessToken":"token","tokenTtl":18000,"globalAdmin":true}`))
+	}))
+	server.TLS = serverTLS(t, ca, srv)
+	server.StartTLS()
+	defer server.Close()
+
+	other, _, _ := newTestPKI(t)
+	tests := []struct {
+		name    string
+		config  *TLSConfig
+		wantErr bool
+	}{
+		{name: "mtls", config: &TLSConfig{CA: ca.certPEM, Cert: cli.certPEM, Key: cli.keyPEM}},
+		{name: "without client certificate", config: &TLSConfig{CA: ca.certPEM}, wantErr: true},
+		{name: "unknown ca", config: &TLSConfig{CA: other.certPEM, Cert: cli.certPEM, Key: cli.keyPEM}, wantErr: true},
+		{name: "insecure skip verify", config: &TLSConfig{InsecureSkipVerify: true, Cert: cli.certPEM, Key: cli.keyPEM}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewNacosService([]string{server.URL}, "nacos", "nacos", nil, WithNacosTLS(tt.config))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewNacosService() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	if _, err := NewNacosService([]string{server.URL}, "nacos", "nacos", roundTripWrapper{}, WithNacosTLS(&TLSConfig{})); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("NewNacosService() with custom round tripper error = %v, want InvalidArgument", err)
+	}
+}
+
+func TestEtcdService_TLS(t *testing.T) {
+	ca, srv, cli := newTestPKI(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr := grpc.NewServer(grpc.Creds(credentials.NewTLS(serverTLS(t, ca, srv))))
+	pb.RegisterKVServer(svr, &mockKVServer{})
+	pb.RegisterAuthServer(svr, &mockAuthServer{})
+	go svr.Serve(ln)
+	defer svr.Stop()
+
+	etcd, err := NewEtcdService([]string{ln.Addr().String()}, "root", "root",
+		WithEtcdTLS(&TLSConfig{CA: ca.certPEM, Cert: cli.certPEM, Key: cli.keyPEM, ServerName: "localhost"}))
+	if err != nil {
+		t.Fatalf("NewEtcdService() error = %v", err)
+	}
+	defer etcd.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	item := &ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1", Key: "k1"}
+	if err := etcd.Get(ctx, item); err != nil {
+		t.Errorf("Get() over mtls error = %v", err)
+	}
+	if _, err := NewEtcdService([]string{ln.Addr().String()}, "root", "root", WithEtcdTLS(&TLSConfig{CA: "invalid"})); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("NewEtcdService() with invalid ca error = %v, want InvalidArgument", err)
+	}
+}
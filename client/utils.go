@@ -1,5 +1,7 @@
 package client
 
+import "context"
+
 func contains(s []string, e string) bool {
 	for _, a := range s {
 		if a == e {
@@ -8,3 +10,31 @@ func contains(s []string, e string) bool {
 	}
 	return false
 }
+
+// ListAllPageSize is the page size to list all the items of an environment
+const ListAllPageSize = 500
+
+// ListAll lists all the items matching item page by page, backends not paging return all the items on the first page
+func ListAll(ctx context.Context, cli ConfigClientIface, item *ConfigItem) ([]*ConfigItem, error) {
+	ret := []*ConfigItem{}
+	seen := map[string]bool{}
+	for page := 1; ; page++ {
+		items, err := cli.List(ctx, &ListOptions{ConfigItem: *item, Page: page, Size: ListAllPageSize})
+		if err != nil {
+			return nil, err
+		}
+		added := 0
+		for _, it := range items {
+			id := it.Environment + "/" + it.Key
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			ret = append(ret, it)
+			added++
+		}
+		if len(items) < ListAllPageSize || added == 0 {
+			return ret, nil
+		}
+	}
+}
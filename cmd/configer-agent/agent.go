@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"kubegems.io/configer/sdk"
+)
+
+// DefaultFileMode keeps the files readable by the owner only, as the values may be secrets
+const DefaultFileMode os.FileMode = 0o600
+
+type AgentOptions struct {
+	Tenant      string
+	Project     string
+	Environment string
+	Keys        []string
+	Dir         string
+	// FileName is a text/template rendered with FileNameData
+	FileName string
+	// FileMode is the mode of the files written, 0600 if not set as the values may be secrets
+	FileMode os.FileMode
+	Once     bool
+
+	PID     int
+	PIDFile string
+	Signal  os.Signal
+	HookURL string
+}
+
+type FileNameData struct {
+	Tenant      string
+	Project     string
+	Environment string
+	Key         string
+}
+
+type Agent struct {
+	opts     AgentOptions
+	cli      *sdk.Client
+	fileName *template.Template
+	changes  chan string
+}
+
+func NewAgent(opts AgentOptions, cli *sdk.Client) (*Agent, error) {
+	if len(opts.Keys) == 0 {
+		return nil, fmt.Errorf("keys must be specified")
+	}
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("dir must be specified")
+	}
+	if opts.FileName == "" {
+		opts.FileName = "{{ .Key }}"
+	}
+	if opts.FileMode == 0 {
+		opts.FileMode = DefaultFileMode
+	}
+	tpl, err := template.New("filename").Option("missingkey=error").Parse(opts.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filename template, %v", err)
+	}
+	return &Agent{
+		opts:     opts,
+		cli:      cli,
+		fileName: tpl,
+		changes:  make(chan string, len(opts.Keys)),
+	}, nil
+}
+
+// Run writes all keys, then watches them until ctx done unless Once is set
+func (a *Agent) Run(ctx context.Context) error {
+	for _, key := range a.opts.Keys {
+		v, err := a.cli.Get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("get %s failed, %v", key, err)
+		}
+		if err := a.write(key, v.Raw); err != nil {
+			return err
+		}
+	}
+	if a.opts.Once {
+		return nil
+	}
+	for _, key := range a.opts.Keys {
+		key := key
+		a.cli.Watch(ctx, key, func(v *sdk.Value) {
+			if err := a.write(key, v.Raw); err != nil {
+				log.Printf("write %s failed, %v", key, err)
+				return
+			}
+			// the callback may be called after Run returned
+			select {
+			case a.changes <- key:
+			case <-ctx.Done():
+			}
+		})
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case key := <-a.changes:
+			log.Printf("config %s changed", key)
+			if err := a.notify(ctx, key); err != nil {
+				log.Printf("notify main process failed, %v", err)
+			}
+		}
+	}
+}
+
+func (a *Agent) path(key string) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := a.fileName.Execute(buf, FileNameData{
+		Tenant:      a.opts.Tenant,
+		Project:     a.opts.Project,
+		Environment: a.opts.Environment,
+		Key:         key,
+	}); err != nil {
+		return "", err
+	}
+	name := filepath.Clean(buf.String())
+	if name == "." || filepath.IsAbs(name) || strings.HasPrefix(name, "..") {
+		return "", fmt.Errorf("invalid file name %s of key %s", name, key)
+	}
+	return filepath.Join(a.opts.Dir, name), nil
+}
+
+// write replaces the file atomically, so the main process never reads a partial file
+func (a *Agent) write(key, value string) error {
+	file, err := a.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".configer-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(value); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(a.opts.FileMode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+func (a *Agent) notify(ctx context.Context, key string) error {
+	if pid, err := a.pid(); err != nil {
+		return err
+	} else if pid > 0 {
+		if err := signalProcess(pid, a.opts.Signal); err != nil {
+			return fmt.Errorf("signal process %d failed, %v", pid, err)
+		}
+	}
+	if a.opts.HookURL == "" {
+		return nil
+	}
+	nctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(nctx, http.MethodPost, a.opts.HookURL, nil)
+	if err != nil {
+		return err
+	}
+	q := req.URL.Query()
+	q.Set("key", key)
+	req.URL.RawQuery = q.Encode()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("hook %s failed, code is %d", a.opts.HookURL, resp.StatusCode)
+	}
+	return nil
+}
+
+func (a *Agent) pid() (int, error) {
+	if a.opts.PID > 0 || a.opts.PIDFile == "" {
+		return a.opts.PID, nil
+	}
+	content, err := os.ReadFile(a.opts.PIDFile)
+	if err != nil {
+		return 0, err
+	}
+	var pid int
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(content)), "%d", &pid); err != nil {
+		return 0, fmt.Errorf("invalid pid file %s, %v", a.opts.PIDFile, err)
+	}
+	return pid, nil
+}
+
+func signalProcess(pid int, sig os.Signal) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Signal(sig)
+}
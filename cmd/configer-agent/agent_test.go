@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"kubegems.io/configer/sdk"
+)
+
+func newTestAgent(t *testing.T, opts AgentOptions) (*Agent, *miniredis.Miniredis) {
+	m := miniredis.RunT(t)
+	m.HSet("kubegems/ten1/proj1/dev", "app.yaml", "port: 8080")
+	m.HSet("kubegems/ten1/proj1/dev", "log.xml", "<log/>")
+	cli, err := sdk.New(sdk.Options{
+		Tenant:      "ten1",
+		Project:     "proj1",
+		Environment: "dev",
+		BaseInfo:    map[string]string{"provider": "redis"},
+		Endpoints:   []string{m.Addr()},
+	})
+	if err != nil {
+		t.Fatalf("sdk.New() error = %v", err)
+	}
+	t.Cleanup(func() { cli.Close() })
+	opts.Tenant, opts.Project, opts.Environment = "ten1", "proj1", "dev"
+	agent, err := NewAgent(opts, cli)
+	if err != nil {
+		t.Fatalf("NewAgent() error = %v", err)
+	}
+	return agent, m
+}
+
+func TestAgent_Path(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name: "test default file name",
+			want: "app.yaml",
+		},
+		{
+			name:     "test templated file name",
+			fileName: "{{ .Environment }}/{{ .Key }}",
+			want:     "dev/app.yaml",
+		},
+		{
+			name:     "test file name out of dir",
+			fileName: "../{{ .Key }}",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			agent, _ := newTestAgent(t, AgentOptions{Keys: []string{"app.yaml"}, Dir: dir, FileName: tt.fileName})
+			got, err := agent.path("app.yaml")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Agent.path() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got != filepath.Join(dir, tt.want) {
+				t.Errorf("Agent.path() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAgent_RunOnce(t *testing.T) {
+	dir := t.TempDir()
+	agent, _ := newTestAgent(t, AgentOptions{Keys: []string{"app.yaml", "log.xml"}, Dir: dir, Once: true})
+	if err := agent.Run(context.Background()); err != nil {
+		t.Fatalf("Agent.Run() error = %v", err)
+	}
+	for file, want := range map[string]string{"app.yaml": "port: 8080", "log.xml": "<log/>"} {
+		got, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil || string(got) != want {
+			t.Errorf("file %s = %s, error = %v", file, got, err)
+		}
+		if info, err := os.Stat(filepath.Join(dir, file)); err != nil || info.Mode().Perm() != DefaultFileMode {
+			t.Errorf("file %s mode = %v, error = %v, want %v", file, info, err, DefaultFileMode)
+		}
+	}
+
+	dir = t.TempDir()
+	agent, _ = newTestAgent(t, AgentOptions{Keys: []string{"app.yaml"}, Dir: dir, FileMode: 0o640, Once: true})
+	if err := agent.Run(context.Background()); err != nil {
+		t.Fatalf("Agent.Run() error = %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "app.yaml")); err != nil || info.Mode().Perm() != 0o640 {
+		t.Errorf("file = %v, error = %v, want mode 0640", info, err)
+	}
+}
+
+func TestAgent_RunWatchWithHook(t *testing.T) {
+	hooked := make(chan string, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hooked <- r.URL.Query().Get("key")
+	}))
+	defer hook.Close()
+
+	dir := t.TempDir()
+	agent, m := newTestAgent(t, AgentOptions{Keys: []string{"app.yaml"}, Dir: dir, HookURL: hook.URL})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go agent.Run(ctx)
+	// wait for the initial write
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(filepath.Join(dir, "app.yaml")); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	m.HSet("kubegems/ten1/proj1/dev", "app.yaml", "port: 9090")
+	deadline := time.After(5 * time.Second)
+	for {
+		// miniredis doesn't emit keyspace notifications, publish it manually
+		m.Publish("__keyspace@0__:kubegems/ten1/proj1/dev", "hset")
+		select {
+		case key := <-hooked:
+			if key != "app.yaml" {
+				t.Errorf("hooked key = %s, want app.yaml", key)
+			}
+			got, _ := os.ReadFile(filepath.Join(dir, "app.yaml"))
+			if string(got) != "port: 9090" {
+				t.Errorf("file content = %s, want port: 9090", got)
+			}
+			return
+		case <-deadline:
+			t.Fatal("hook not called")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"kubegems.io/configer/sdk"
+)
+
+/*
+configer-agent materializes configs into files for workloads which only read files, eg:
+
+	configer-agent --tenant t --project p --environment dev \
+		--baseinfo '{"provider":"nacos"}' --endpoints http://nacos:8848 \
+		--keys application.yaml,logback.xml --dir /etc/app --pid-file /var/run/app.pid
+
+credentials are read from CONFIGER_USERNAME and CONFIGER_PASSWORD if not specified.
+encrypted values are decrypted by the data key of the environment, which is fetched from --server with the account,
+or given by --data-key (CONFIGER_DATA_KEY). the bearer token of the server is read from CONFIGER_TOKEN if not specified.
+*/
+
+func main() {
+	var (
+		opts                                         AgentOptions
+		sdkOpts                                      sdk.Options
+		keys, endpoints, baseInfo, provider, sigName string
+		dataKey, fileMode                            string
+	)
+	flag.StringVar(&opts.Tenant, "tenant", "", "tenant of configs")
+	flag.StringVar(&opts.Project, "project", "", "project of configs")
+	flag.StringVar(&opts.Environment, "environment", "", "environment of configs")
+	flag.StringVar(&sdkOpts.Application, "application", "", "application of configs")
+	flag.StringVar(&keys, "keys", "", "comma separated keys to materialize")
+	flag.StringVar(&opts.Dir, "dir", "", "directory to write configs into")
+	flag.StringVar(&opts.FileName, "filename", "{{ .Key }}", "file name template, fields: .Tenant .Project .Environment .Key")
+	flag.StringVar(&fileMode, "file-mode", "0600", "octal mode of the files written")
+	flag.BoolVar(&opts.Once, "once", false, "write configs and exit, eg: as an init container")
+	flag.StringVar(&baseInfo, "baseinfo", "{}", "baseinfo returned by configer in json")
+	flag.StringVar(&provider, "provider", "", "provider of backend, override the provider of baseinfo")
+	flag.StringVar(&endpoints, "endpoints", "", "comma separated backend endpoints")
+	flag.StringVar(&sdkOpts.Account.Username, "username", os.Getenv("CONFIGER_USERNAME"), "username of the account")
+	flag.StringVar(&sdkOpts.Account.Password, "password", os.Getenv("CONFIGER_PASSWORD"), "password of the account")
+	flag.StringVar(&sdkOpts.Server, "server", "", "base url of the configer api, the data key of encrypted values is fetched from it")
+	flag.StringVar(&sdkOpts.Token, "token", os.Getenv("CONFIGER_TOKEN"), "bearer token of the configer api")
+	flag.StringVar(&dataKey, "data-key", os.Getenv("CONFIGER_DATA_KEY"), "base64 encoded data key to decrypt encrypted values instead of fetching it")
+	flag.StringVar(&sdkOpts.CacheDir, "cache-dir", "", "directory to cache configs for starting when backend is down")
+	flag.IntVar(&opts.PID, "pid", 0, "pid of the main process to signal after a change")
+	flag.StringVar(&opts.PIDFile, "pid-file", "", "pid file of the main process to signal after a change")
+	flag.StringVar(&sigName, "signal", "SIGHUP", "signal sent to the main process")
+	flag.StringVar(&opts.HookURL, "hook-url", "", "url to post after a change")
+	flag.Parse()
+
+	sig, ok := signals[strings.ToUpper(sigName)]
+	if !ok {
+		log.Fatalf("unsupported signal %s", sigName)
+	}
+	opts.Signal = sig
+	mode, err := strconv.ParseUint(fileMode, 8, 32)
+	if err != nil || mode > 0o777 {
+		log.Fatalf("invalid file mode %s", fileMode)
+	}
+	opts.FileMode = os.FileMode(mode)
+	if dataKey != "" {
+		if sdkOpts.DataKey, err = base64.StdEncoding.DecodeString(dataKey); err != nil {
+			log.Fatalf("invalid data key, %v", err)
+		}
+	}
+	opts.Keys = splitComma(keys)
+	sdkOpts.Tenant, sdkOpts.Project, sdkOpts.Environment = opts.Tenant, opts.Project, opts.Environment
+	sdkOpts.Endpoints = splitComma(endpoints)
+	if err := json.Unmarshal([]byte(baseInfo), &sdkOpts.BaseInfo); err != nil {
+		log.Fatalf("invalid baseinfo, %v", err)
+	}
+	if sdkOpts.BaseInfo == nil {
+		sdkOpts.BaseInfo = map[string]string{}
+	}
+	if provider != "" {
+		sdkOpts.BaseInfo["provider"] = provider
+	}
+
+	cli, err := sdk.New(sdkOpts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cli.Close()
+	agent, err := NewAgent(opts, cli)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	if err := agent.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func splitComma(s string) []string {
+	ret := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// processes on windows can only be killed, the main process should be notified by --hook-url instead
+var signals = map[string]os.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGKILL": os.Kill,
+}
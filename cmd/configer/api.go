@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"kubegems.io/configer/client"
+)
+
+// apiResponse is the envelope of configer api, the same as response.Response of kubegems
+type apiResponse struct {
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+	Error   interface{}     `json:"error"`
+}
+
+type API struct {
+	Server      string
+	Token       string
+	Tenant      string
+	Project     string
+	Environment string
+	Application string
+	HTTPClient  *http.Client
+}
+
+func (a *API) envPath(suffix string) string {
+	p := fmt.Sprintf("/configer/tenant/%s/project/%s/environment/%s",
+		url.PathEscape(a.Tenant), url.PathEscape(a.Project), url.PathEscape(a.Environment))
+	return p + suffix
+}
+
+func (a *API) keyPath(key, suffix string) string {
+	return a.envPath("/key/" + url.PathEscape(key) + suffix)
+}
+
+func (a *API) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		bts, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(bts)
+	}
+	u := strings.TrimSuffix(a.Server, "/") + path
+	if query == nil {
+		query = url.Values{}
+	}
+	if a.Application != "" {
+		query.Set("application", a.Application)
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if a.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	}
+	cli := a.HTTPClient
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	ret := &apiResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(ret); err != nil {
+		return fmt.Errorf("%s %s failed, code is %d, %v", method, path, resp.StatusCode, err)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s failed, code is %d, %s", method, path, resp.StatusCode, ret.Message)
+	}
+	if out == nil || len(ret.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(ret.Data, out)
+}
+
+func (a *API) List(ctx context.Context, page, size int) ([]*client.ConfigItem, error) {
+	ret := []*client.ConfigItem{}
+	q := url.Values{"page": {strconv.Itoa(page)}, "size": {strconv.Itoa(size)}}
+	return ret, a.do(ctx, http.MethodGet, a.envPath(""), q, nil, &ret)
+}
+
+func (a *API) Get(ctx context.Context, key string, rev int64) (*client.ConfigItem, error) {
+	ret := &client.ConfigItem{}
+	q := url.Values{}
+	if rev != 0 {
+		q.Set("rev", strconv.FormatInt(rev, 10))
+	}
+	return ret, a.do(ctx, http.MethodGet, a.keyPath(key, ""), q, nil, ret)
+}
+
+func (a *API) Pub(ctx context.Context, item *client.ConfigItem) (*client.ConfigItem, error) {
+	ret := &client.ConfigItem{}
+	return ret, a.do(ctx, http.MethodPost, a.keyPath(item.Key, ""), nil, item, ret)
+}
+
+func (a *API) Delete(ctx context.Context, key string) error {
+	return a.do(ctx, http.MethodDelete, a.keyPath(key, ""), nil, nil, nil)
+}
+
+func (a *API) History(ctx context.Context, key string) ([]*client.HistoryVersion, error) {
+	ret := []*client.HistoryVersion{}
+	return ret, a.do(ctx, http.MethodGet, a.keyPath(key, "/history"), nil, nil, &ret)
+}
+
+func (a *API) Backup(ctx context.Context) error {
+	return a.do(ctx, http.MethodPost, a.envPath("/action/backup"), nil, nil, nil)
+}
+
+func (a *API) Restore(ctx context.Context) error {
+	return a.do(ctx, http.MethodPost, a.envPath("/action/restore"), nil, nil, nil)
+}
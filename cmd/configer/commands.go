@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+	"kubegems.io/configer/client"
+)
+
+const listPageSize = 100
+
+// ExportedItem is the item of an exported file
+type ExportedItem struct {
+	Key         string `json:"key" yaml:"key"`
+	Application string `json:"application,omitempty" yaml:"application,omitempty"`
+	Value       string `json:"value" yaml:"value"`
+}
+
+func runList(ctx context.Context, app *App, fs *flag.FlagSet, args []string) error {
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	items, err := listAll(ctx, app.API)
+	if err != nil {
+		return err
+	}
+	return printItems(app.Out, app.Output, items)
+}
+
+func runGet(ctx context.Context, app *App, fs *flag.FlagSet, args []string) error {
+	rev := fs.Int64("rev", 0, "revision of the config, the latest if not specified")
+	pos, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	item, err := app.API.Get(ctx, pos[0], *rev)
+	if err != nil {
+		return err
+	}
+	return printItem(app.Out, app.Output, item)
+}
+
+func runPub(ctx context.Context, app *App, fs *flag.FlagSet, args []string) error {
+	file := fs.String("f", "", "file of the value, - for stdin")
+	value := fs.String("value", "", "literal value, used if -f not specified")
+	dryRun := fs.Bool("dry-run", false, "only print the diff with the current value")
+	pos, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	key := pos[0]
+	newValue := *value
+	if *file != "" {
+		if newValue, err = app.readValue(*file); err != nil {
+			return err
+		}
+	}
+	if *dryRun {
+		current, _ := app.currentValue(ctx, key)
+		if !unifiedDiff(app.Out, key+" (current)", key+" (new)", current, newValue) {
+			fmt.Fprintf(app.Out, "%s unchanged\n", key)
+		}
+		return nil
+	}
+	item, err := app.API.Pub(ctx, &client.ConfigItem{Key: key, Application: app.API.Application, Value: newValue})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(app.Out, "%s published, rev %d\n", item.Key, item.Rev)
+	return nil
+}
+
+func runDelete(ctx context.Context, app *App, fs *flag.FlagSet, args []string) error {
+	dryRun := fs.Bool("dry-run", false, "only print the value to delete")
+	pos, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	key := pos[0]
+	if *dryRun {
+		current, err := app.currentValue(ctx, key)
+		if err != nil {
+			return err
+		}
+		unifiedDiff(app.Out, key+" (current)", "/dev/null", current, "")
+		return nil
+	}
+	if err := app.API.Delete(ctx, key); err != nil {
+		return err
+	}
+	fmt.Fprintf(app.Out, "%s deleted\n", key)
+	return nil
+}
+
+func runHistory(ctx context.Context, app *App, fs *flag.FlagSet, args []string) error {
+	pos, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	versions, err := app.API.History(ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	return printHistory(app.Out, app.Output, versions)
+}
+
+func runDiff(ctx context.Context, app *App, fs *flag.FlagSet, args []string) error {
+	rev := fs.Int64("rev", 0, "revision to compare, the latest if not specified")
+	rev2 := fs.Int64("rev2", 0, "another revision to compare with --rev")
+	file := fs.String("f", "", "local file to compare with, - for stdin")
+	pos, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	key := pos[0]
+	if (*rev2 == 0) == (*file == "") {
+		return fmt.Errorf("one of --rev2 and -f is required")
+	}
+	a, err := app.API.Get(ctx, key, *rev)
+	if err != nil {
+		return err
+	}
+	nameA := fmt.Sprintf("%s@%d", key, a.Rev)
+	var nameB, valueB string
+	if *file != "" {
+		if valueB, err = app.readValue(*file); err != nil {
+			return err
+		}
+		nameB = *file
+	} else {
+		b, err := app.API.Get(ctx, key, *rev2)
+		if err != nil {
+			return err
+		}
+		nameB, valueB = fmt.Sprintf("%s@%d", key, b.Rev), b.Value
+	}
+	unifiedDiff(app.Out, nameA, nameB, a.Value, valueB)
+	return nil
+}
+
+func runRollback(ctx context.Context, app *App, fs *flag.FlagSet, args []string) error {
+	rev := fs.Int64("rev", 0, "revision to rollback to")
+	dryRun := fs.Bool("dry-run", false, "only print the diff with the current value")
+	pos, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	key := pos[0]
+	if *rev == 0 {
+		return fmt.Errorf("--rev is required")
+	}
+	target, err := app.API.Get(ctx, key, *rev)
+	if err != nil {
+		return err
+	}
+	current, err := app.currentValue(ctx, key)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		if !unifiedDiff(app.Out, key+" (current)", fmt.Sprintf("%s@%d", key, *rev), current, target.Value) {
+			fmt.Fprintf(app.Out, "%s unchanged\n", key)
+		}
+		return nil
+	}
+	if current == target.Value {
+		fmt.Fprintf(app.Out, "%s unchanged\n", key)
+		return nil
+	}
+	item, err := app.API.Pub(ctx, &client.ConfigItem{Key: key, Application: app.API.Application, Value: target.Value})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(app.Out, "%s rolled back to rev %d, new rev %d\n", key, *rev, item.Rev)
+	return nil
+}
+
+func runBackup(ctx context.Context, app *App, fs *flag.FlagSet, args []string) error {
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	if err := app.API.Backup(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintln(app.Out, "backup succeeded")
+	return nil
+}
+
+func runRestore(ctx context.Context, app *App, fs *flag.FlagSet, args []string) error {
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	if err := app.API.Restore(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintln(app.Out, "restore succeeded")
+	return nil
+}
+
+func runExport(ctx context.Context, app *App, fs *flag.FlagSet, args []string) error {
+	dir := fs.String("dir", "", "export each config into a file of the directory instead of a single document")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	items, err := listAll(ctx, app.API)
+	if err != nil {
+		return err
+	}
+	if *dir != "" {
+		for _, item := range items {
+			path := filepath.Join(*dir, filepath.FromSlash(item.Key))
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, []byte(item.Value), 0o644); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(app.Out, "%d configs exported into %s\n", len(items), *dir)
+		return nil
+	}
+	exported := make([]ExportedItem, 0, len(items))
+	for _, item := range items {
+		exported = append(exported, ExportedItem{Key: item.Key, Application: item.Application, Value: item.Value})
+	}
+	format := app.Output
+	if format == OutputTable {
+		format = OutputYAML
+	}
+	return printer(app.Out, format, exported, nil)
+}
+
+func runImport(ctx context.Context, app *App, fs *flag.FlagSet, args []string) error {
+	file := fs.String("f", "", "exported file, json or yaml, - for stdin")
+	dir := fs.String("dir", "", "directory to import, each file is a config")
+	dryRun := fs.Bool("dry-run", false, "only print the configs to create or update")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	var items []ExportedItem
+	switch {
+	case *file != "" && *dir == "":
+		content, err := app.readValue(*file)
+		if err != nil {
+			return err
+		}
+		// yaml is a superset of json
+		if err := yaml.Unmarshal([]byte(content), &items); err != nil {
+			return fmt.Errorf("invalid exported file, %v", err)
+		}
+	case *dir != "" && *file == "":
+		var err error
+		if items, err = readDir(*dir); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("one of -f and --dir is required")
+	}
+
+	for _, item := range items {
+		application := item.Application
+		if application == "" {
+			application = app.API.Application
+		}
+		current, err := app.currentValue(ctx, item.Key)
+		action := "updated"
+		switch {
+		case err != nil:
+			action = "created"
+		case current == item.Value:
+			fmt.Fprintf(app.Out, "%s unchanged\n", item.Key)
+			continue
+		}
+		if *dryRun {
+			fmt.Fprintf(app.Out, "%s %s (dry run)\n", item.Key, action)
+			continue
+		}
+		if _, err := app.API.Pub(ctx, &client.ConfigItem{Key: item.Key, Application: application, Value: item.Value}); err != nil {
+			return fmt.Errorf("import %s failed, %v", item.Key, err)
+		}
+		fmt.Fprintf(app.Out, "%s %s\n", item.Key, action)
+	}
+	return nil
+}
+
+// readValue reads the content of file, - for stdin
+func (app *App) readValue(file string) (string, error) {
+	if file == "-" {
+		bts, err := io.ReadAll(app.In)
+		return string(bts), err
+	}
+	bts, err := os.ReadFile(file)
+	return string(bts), err
+}
+
+func (app *App) currentValue(ctx context.Context, key string) (string, error) {
+	item, err := app.API.Get(ctx, key, 0)
+	if err != nil {
+		return "", err
+	}
+	return item.Value, nil
+}
+
+func listAll(ctx context.Context, api *API) ([]*client.ConfigItem, error) {
+	ret := []*client.ConfigItem{}
+	seen := map[string]bool{}
+	for page := 1; ; page++ {
+		items, err := api.List(ctx, page, listPageSize)
+		if err != nil {
+			return nil, err
+		}
+		added := 0
+		for _, item := range items {
+			// some backends ignore the paging and return all items
+			if id := item.Application + "/" + item.Key; !seen[id] {
+				seen[id] = true
+				ret = append(ret, item)
+				added++
+			}
+		}
+		if len(items) < listPageSize || added == 0 {
+			return ret, nil
+		}
+	}
+}
+
+func readDir(dir string) ([]ExportedItem, error) {
+	ret := []ExportedItem{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		bts, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		ret = append(ret, ExportedItem{Key: filepath.ToSlash(rel), Value: string(bts)})
+		return nil
+	})
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Key < ret[j].Key })
+	return ret, err
+}
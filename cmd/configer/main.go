@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+)
+
+/*
+configer is the command line tool of configer api, eg:
+
+	configer --server https://kubegems.example.com/api/v1 --tenant t --project p --environment dev list
+	configer get application.yaml --rev 3
+	cat application.yaml | configer pub application.yaml -f - --dry-run
+	configer rollback application.yaml --rev 3
+	configer export > dev.yaml && configer import -f dev.yaml --environment prod --dry-run
+
+server, token, tenant, project and environment are read from CONFIGER_SERVER, CONFIGER_TOKEN,
+CONFIGER_TENANT, CONFIGER_PROJECT and CONFIGER_ENVIRONMENT if not specified.
+*/
+
+type App struct {
+	API    *API
+	Output string
+	In     io.Reader
+	Out    io.Writer
+}
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, app *App, fs *flag.FlagSet, args []string) error
+}
+
+var commands = map[string]command{
+	"list":     {usage: "list configs of the environment", run: runList},
+	"get":      {usage: "get KEY, print the value of the config", run: runGet},
+	"pub":      {usage: "pub KEY, publish the config from a file, stdin or a literal value", run: runPub},
+	"delete":   {usage: "delete KEY, delete the config", run: runDelete},
+	"history":  {usage: "history KEY, list history versions of the config", run: runHistory},
+	"diff":     {usage: "diff KEY, diff the config with a local file or another revision", run: runDiff},
+	"rollback": {usage: "rollback KEY --rev N, publish the value of revision N", run: runRollback},
+	"backup":   {usage: "sync configs of backend into database", run: runBackup},
+	"restore":  {usage: "sync configs of database into backend", run: runRestore},
+	"export":   {usage: "export configs of the environment into a file or a directory", run: runExport},
+	"import":   {usage: "import configs from a file or a directory", run: runImport},
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	if err := Run(ctx, os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func Run(ctx context.Context, args []string, in io.Reader, out io.Writer) error {
+	app := &App{
+		API: &API{
+			Server:      os.Getenv("CONFIGER_SERVER"),
+			Token:       os.Getenv("CONFIGER_TOKEN"),
+			Tenant:      os.Getenv("CONFIGER_TENANT"),
+			Project:     os.Getenv("CONFIGER_PROJECT"),
+			Environment: os.Getenv("CONFIGER_ENVIRONMENT"),
+		},
+		Output: OutputTable,
+		In:     in,
+		Out:    out,
+	}
+	global := flag.NewFlagSet("configer", flag.ContinueOnError)
+	app.bindFlags(global)
+	global.Usage = func() { usage(global) }
+	if err := global.Parse(args); err != nil {
+		return err
+	}
+	args = global.Args()
+	if len(args) == 0 {
+		usage(global)
+		return fmt.Errorf("no command specified")
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		usage(global)
+		return fmt.Errorf("unknown command %s", args[0])
+	}
+	// global flags are also accepted after the command
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	app.bindFlags(fs)
+	return cmd.run(ctx, app, fs, args[1:])
+}
+
+// bindFlags binds the global flags, the current values are the defaults
+func (app *App) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&app.API.Server, "server", app.API.Server, "address of kubegems api, eg: https://kubegems.example.com/api/v1")
+	fs.StringVar(&app.API.Token, "token", app.API.Token, "bearer token of kubegems api")
+	fs.StringVar(&app.API.Tenant, "tenant", app.API.Tenant, "tenant of configs")
+	fs.StringVar(&app.API.Project, "project", app.API.Project, "project of configs")
+	fs.StringVar(&app.API.Environment, "environment", app.API.Environment, "environment of configs")
+	fs.StringVar(&app.API.Application, "application", app.API.Application, "application of configs")
+	fs.StringVar(&app.Output, "o", app.Output, "output format, one of table, json, yaml")
+}
+
+// parseArgs parses flags which may be placed after positional arguments
+func parseArgs(fs *flag.FlagSet, args []string, positional int) ([]string, error) {
+	ret := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		ret = append(ret, args[0])
+		args = args[1:]
+	}
+	if len(ret) != positional {
+		return nil, fmt.Errorf("%s requires %d argument(s), got %d", fs.Name(), positional, len(ret))
+	}
+	if fs.Lookup("server").Value.String() == "" {
+		return nil, fmt.Errorf("server is required, use --server or CONFIGER_SERVER")
+	}
+	return ret, nil
+}
+
+func usage(fs *flag.FlagSet) {
+	w := fs.Output()
+	fmt.Fprintln(w, "Usage: configer [flags] COMMAND [args] [flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintln(w, "\nFlags:")
+	fs.PrintDefaults()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"kubegems.io/configer/client"
+)
+
+// fakeServer is an in-memory configer api, it keeps every revision of the configs
+type fakeServer struct {
+	lock     sync.Mutex
+	rev      int64
+	versions map[string][]*client.ConfigItem
+	pubs     int
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	write := func(code int, data interface{}, msg string) {
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": msg, "data": data})
+	}
+	prefix := "/configer/tenant/t/project/p/environment/dev"
+	path := strings.TrimPrefix(r.URL.Path, prefix)
+	if path == r.URL.Path {
+		write(http.StatusNotFound, nil, "not found")
+		return
+	}
+	if path == "" {
+		ret := []*client.ConfigItem{}
+		for _, versions := range s.versions {
+			ret = append(ret, versions[len(versions)-1])
+		}
+		write(http.StatusOK, ret, "ok")
+		return
+	}
+	key := strings.TrimPrefix(path, "/key/")
+	switch r.Method {
+	case http.MethodGet:
+		versions := s.versions[key]
+		rev, _ := strconv.ParseInt(r.URL.Query().Get("rev"), 10, 64)
+		for i := len(versions) - 1; i >= 0; i-- {
+			if rev == 0 || versions[i].Rev == rev {
+				write(http.StatusOK, versions[i], "ok")
+				return
+			}
+		}
+		write(http.StatusBadRequest, nil, "config not found")
+	case http.MethodPost:
+		item := &client.ConfigItem{}
+		json.NewDecoder(r.Body).Decode(item)
+		s.rev++
+		s.pubs++
+		item.Rev = s.rev
+		s.versions[key] = append(s.versions[key], item)
+		write(http.StatusOK, item, "ok")
+	}
+}
+
+func runCommand(t *testing.T, server *httptest.Server, stdin string, args ...string) string {
+	out := &bytes.Buffer{}
+	args = append([]string{"--server", server.URL, "--tenant", "t", "--project", "p", "--environment", "dev"}, args...)
+	if err := Run(context.Background(), args, strings.NewReader(stdin), out); err != nil {
+		t.Fatalf("run %v failed, %v", args, err)
+	}
+	return out.String()
+}
+
+func TestRun(t *testing.T) {
+	fake := &fakeServer{versions: map[string][]*client.ConfigItem{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	runCommand(t, server, "a: 1\n", "pub", "app.yaml", "-f", "-")
+	runCommand(t, server, "a: 2\n", "pub", "app.yaml", "-f", "-")
+	if got := runCommand(t, server, "", "get", "app.yaml"); got != "a: 2\n" {
+		t.Errorf("get = %q", got)
+	}
+	if got := runCommand(t, server, "", "get", "app.yaml", "--rev", "1"); got != "a: 1\n" {
+		t.Errorf("get rev 1 = %q", got)
+	}
+
+	// dry run must not publish
+	got := runCommand(t, server, "a: 3\n", "pub", "app.yaml", "-f", "-", "--dry-run")
+	if !strings.Contains(got, "-a: 2\n+a: 3\n") || fake.pubs != 2 {
+		t.Errorf("pub dry run = %q, pubs %d", got, fake.pubs)
+	}
+	runCommand(t, server, "", "rollback", "app.yaml", "--rev", "1", "--dry-run")
+	if fake.pubs != 2 {
+		t.Errorf("rollback dry run published")
+	}
+	runCommand(t, server, "", "rollback", "app.yaml", "--rev", "1")
+	if got := runCommand(t, server, "", "get", "app.yaml"); got != "a: 1\n" {
+		t.Errorf("get after rollback = %q", got)
+	}
+
+	exported := runCommand(t, server, "", "export", "-o", "json")
+	var items []ExportedItem
+	if err := json.Unmarshal([]byte(exported), &items); err != nil || len(items) != 1 || items[0].Value != "a: 1\n" {
+		t.Fatalf("export = %s, %v", exported, err)
+	}
+	got = runCommand(t, server, `[{"key":"app.yaml","value":"a: 1\n"},{"key":"new.yaml","value":"b"}]`, "import", "-f", "-", "--dry-run")
+	if got != "app.yaml unchanged\nnew.yaml created (dry run)\n" {
+		t.Errorf("import dry run = %q", got)
+	}
+	runCommand(t, server, "- key: new.yaml\n  value: b\n", "import", "-f", "-")
+	if got := runCommand(t, server, "", "get", "new.yaml"); got != "b" {
+		t.Errorf("get imported = %q", got)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{name: "same", a: "a\nb\n", b: "a\nb\n", want: ""},
+		{name: "changed", a: "a\nb\nc\n", b: "a\nB\nc\n", want: "--- a\n+++ b\n a\n-b\n+B\n c\n"},
+		{name: "added", a: "", b: "x\n", want: "--- a\n+++ b\n+x\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			changed := unifiedDiff(out, "a", "b", tt.a, tt.b)
+			if out.String() != tt.want || changed != (tt.want != "") {
+				t.Errorf("unifiedDiff() = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
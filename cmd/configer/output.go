@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+	"kubegems.io/configer/client"
+)
+
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+)
+
+// printer prints data as json or yaml, the table is printed by the given function
+func printer(w io.Writer, format string, data interface{}, table func(tw *tabwriter.Writer)) error {
+	switch format {
+	case OutputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(data)
+	case OutputYAML:
+		// convert by json to keep the json field names
+		bts, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		var obj interface{}
+		if err := json.Unmarshal(bts, &obj); err != nil {
+			return err
+		}
+		return yaml.NewEncoder(w).Encode(obj)
+	case OutputTable, "":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		table(tw)
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %s", format)
+	}
+}
+
+func printItems(w io.Writer, format string, items []*client.ConfigItem) error {
+	return printer(w, format, items, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "KEY\tAPPLICATION\tLAST UPDATE USER\tLAST MODIFIED\tVALUE")
+		for _, item := range items {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", item.Key, item.Application, item.LastUpdateUser, item.LastModifiedTime, abbrev(item.Value))
+		}
+	})
+}
+
+func printItem(w io.Writer, format string, item *client.ConfigItem) error {
+	if format == OutputTable || format == "" {
+		// the raw value, so it can be redirected into a file
+		_, err := io.WriteString(w, item.Value)
+		return err
+	}
+	return printer(w, format, item, nil)
+}
+
+func printHistory(w io.Writer, format string, versions []*client.HistoryVersion) error {
+	return printer(w, format, versions, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "REV\tVERSION\tLAST UPDATE TIME")
+		for _, v := range versions {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", v.Rev, v.Version, v.LastUpdateTime)
+		}
+	})
+}
+
+func abbrev(value string) string {
+	value = strings.ReplaceAll(value, "\n", " ")
+	if len(value) > 40 {
+		return value[:37] + "..."
+	}
+	return value
+}
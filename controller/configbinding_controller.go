@@ -0,0 +1,327 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	configerclient "kubegems.io/configer/client"
+)
+
+const (
+	DefaultRefreshInterval = time.Minute
+	// AnnotationConfigHash is set on pod templates of referencing workloads to trigger a rolling restart
+	AnnotationConfigHash = "configer.kubegems.io/config-hash"
+	LabelManagedBy       = "app.kubernetes.io/managed-by"
+	managedByValue       = "configer"
+)
+
+// ClientGetter returns the backend client of the item, service.ConfigService implements it
+type ClientGetter interface {
+	ClientOf(item *configerclient.ConfigItem) (string, configerclient.ConfigClientIface, error)
+}
+
+// Renderer is optionally implemented by the ClientGetter to resolve the references in values, such as secrets
+type Renderer interface {
+	Render(ctx context.Context, item *configerclient.ConfigItem) error
+}
+
+// SensitiveChecker is optionally implemented by the ClientGetter, the sensitive configs are only synced into Secrets
+type SensitiveChecker interface {
+	IsSensitive(ctx context.Context, item *configerclient.ConfigItem) (bool, error)
+}
+
+type ConfigBindingReconciler struct {
+	client.Client
+	Scheme  *runtime.Scheme
+	Clients ClientGetter
+	// Authorize returns an error if the bindings in the namespace can not read the configs of the environment of item,
+	// no binding is synced if it is nil
+	Authorize func(ctx context.Context, namespace string, item *configerclient.ConfigItem) error
+}
+
+func (r *ConfigBindingReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		// the status updates do not change the generation, so they do not trigger reconciling again
+		For(&ConfigBinding{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&corev1.Secret{}).
+		Complete(r)
+}
+
+func (r *ConfigBindingReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	binding := &ConfigBinding{}
+	if err := r.Get(ctx, req.NamespacedName, binding); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	interval := DefaultRefreshInterval
+	if binding.Spec.RefreshInterval != nil && binding.Spec.RefreshInterval.Duration > 0 {
+		interval = binding.Spec.RefreshInterval.Duration
+	}
+
+	if err := r.authorize(ctx, binding); err != nil {
+		logger.Error(err, "binding refused")
+		return ctrl.Result{}, r.updateStatus(ctx, binding, binding.Status.Hash, err)
+	}
+	data, err := r.fetch(ctx, binding)
+	if err != nil {
+		logger.Error(err, "fetch configs failed")
+		return ctrl.Result{RequeueAfter: interval}, r.updateStatus(ctx, binding, binding.Status.Hash, err)
+	}
+	hash := hashOf(data)
+	if err := r.render(ctx, binding, data); err != nil {
+		return ctrl.Result{}, r.updateStatus(ctx, binding, binding.Status.Hash, err)
+	}
+	if binding.Spec.RestartWorkloads && binding.Status.Hash != "" && binding.Status.Hash != hash {
+		if err := r.restartWorkloads(ctx, binding, hash); err != nil {
+			return ctrl.Result{}, r.updateStatus(ctx, binding, binding.Status.Hash, err)
+		}
+	}
+	return ctrl.Result{RequeueAfter: interval}, r.updateStatus(ctx, binding, hash, nil)
+}
+
+func (r *ConfigBindingReconciler) authorize(ctx context.Context, binding *ConfigBinding) error {
+	if r.Authorize == nil {
+		return fmt.Errorf("bindings are not authorized to read configs")
+	}
+	return r.Authorize(ctx, binding.Namespace, &configerclient.ConfigItem{
+		Tenant:      binding.Spec.Tenant,
+		Project:     binding.Spec.Project,
+		Environment: binding.Spec.Environment,
+	})
+}
+
+// fetch reads the configs through ConfigClientIface
+func (r *ConfigBindingReconciler) fetch(ctx context.Context, binding *ConfigBinding) (map[string]string, error) {
+	item := &configerclient.ConfigItem{
+		Tenant:      binding.Spec.Tenant,
+		Project:     binding.Spec.Project,
+		Environment: binding.Spec.Environment,
+	}
+	_, cli, err := r.Clients.ClientOf(item)
+	if err != nil {
+		return nil, err
+	}
+	render := func(it *configerclient.ConfigItem) error {
+		if checker, ok := r.Clients.(SensitiveChecker); ok && binding.Spec.Target.Kind != TargetSecret {
+			sensitive, err := checker.IsSensitive(ctx, it)
+			if err != nil {
+				return err
+			}
+			if sensitive {
+				return fmt.Errorf("config %s is sensitive, it can only be synced into a Secret", it.Key)
+			}
+		}
+		renderer, ok := r.Clients.(Renderer)
+		if !ok {
+			return nil
+		}
+		if err := renderer.Render(ctx, it); err != nil {
+			return fmt.Errorf("render %s failed, %v", it.Key, err)
+		}
+		return nil
+	}
+	data := map[string]string{}
+	if len(binding.Spec.Keys) == 0 {
+		items, err := configerclient.ListAll(ctx, cli, item)
+		if err != nil {
+			return nil, err
+		}
+		for _, it := range items {
+			if err := render(it); err != nil {
+				return nil, err
+			}
+			data[it.Key] = it.Value
+		}
+		return data, nil
+	}
+	for _, key := range binding.Spec.Keys {
+		it := *item
+		it.Key = key
+		if err := cli.Get(ctx, &it); err != nil {
+			return nil, fmt.Errorf("get %s failed, %v", key, err)
+		}
+		if err := render(&it); err != nil {
+			return nil, err
+		}
+		data[key] = it.Value
+	}
+	return data, nil
+}
+
+func (r *ConfigBindingReconciler) render(ctx context.Context, binding *ConfigBinding, data map[string]string) error {
+	meta := metav1.ObjectMeta{Name: targetName(binding), Namespace: binding.Namespace}
+	var obj client.Object
+	mutate := func() error {
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[LabelManagedBy] = managedByValue
+		obj.SetLabels(labels)
+		return controllerutil.SetControllerReference(binding, obj, r.Scheme)
+	}
+	switch binding.Spec.Target.Kind {
+	case TargetSecret:
+		secret := &corev1.Secret{ObjectMeta: meta}
+		obj = secret
+		_, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+			secret.Data = map[string][]byte{}
+			for k, v := range data {
+				secret.Data[k] = []byte(v)
+			}
+			return mutate()
+		})
+		return err
+	case TargetConfigMap, "":
+		cm := &corev1.ConfigMap{ObjectMeta: meta}
+		obj = cm
+		_, err := controllerutil.CreateOrUpdate(ctx, r.Client, cm, func() error {
+			cm.Data = data
+			return mutate()
+		})
+		return err
+	default:
+		return fmt.Errorf("unsupported target kind %s", binding.Spec.Target.Kind)
+	}
+}
+
+// restartWorkloads updates the pod template annotation of workloads which reference the target
+func (r *ConfigBindingReconciler) restartWorkloads(ctx context.Context, binding *ConfigBinding, hash string) error {
+	name, isSecret := targetName(binding), binding.Spec.Target.Kind == TargetSecret
+	restart := func(obj client.Object, tpl *corev1.PodTemplateSpec) error {
+		if !referenced(&tpl.Spec, name, isSecret) {
+			return nil
+		}
+		patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+		if tpl.Annotations == nil {
+			tpl.Annotations = map[string]string{}
+		}
+		tpl.Annotations[AnnotationConfigHash] = hash
+		return r.Patch(ctx, obj, patch)
+	}
+	deploys := &appsv1.DeploymentList{}
+	if err := r.List(ctx, deploys, client.InNamespace(binding.Namespace)); err != nil {
+		return err
+	}
+	for i := range deploys.Items {
+		if err := restart(&deploys.Items[i], &deploys.Items[i].Spec.Template); err != nil {
+			return err
+		}
+	}
+	stss := &appsv1.StatefulSetList{}
+	if err := r.List(ctx, stss, client.InNamespace(binding.Namespace)); err != nil {
+		return err
+	}
+	for i := range stss.Items {
+		if err := restart(&stss.Items[i], &stss.Items[i].Spec.Template); err != nil {
+			return err
+		}
+	}
+	dss := &appsv1.DaemonSetList{}
+	if err := r.List(ctx, dss, client.InNamespace(binding.Namespace)); err != nil {
+		return err
+	}
+	for i := range dss.Items {
+		if err := restart(&dss.Items[i], &dss.Items[i].Spec.Template); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateStatus writes the status only if it changed, so refreshing unchanged configs does not write the binding
+func (r *ConfigBindingReconciler) updateStatus(ctx context.Context, binding *ConfigBinding, hash string, syncErr error) error {
+	status := binding.Status
+	status.ObservedGeneration = binding.Generation
+	status.Hash = hash
+	status.Ready = syncErr == nil
+	status.Message = ""
+	if syncErr != nil {
+		status.Message = syncErr.Error()
+	}
+	if status == binding.Status {
+		return syncErr
+	}
+	if syncErr == nil {
+		status.LastSyncTime = metav1.Now()
+	}
+	binding.Status = status
+	if err := r.Status().Update(ctx, binding); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return syncErr
+}
+
+func referenced(spec *corev1.PodSpec, name string, isSecret bool) bool {
+	for _, v := range spec.Volumes {
+		if isSecret && v.Secret != nil && v.Secret.SecretName == name {
+			return true
+		}
+		if !isSecret && v.ConfigMap != nil && v.ConfigMap.Name == name {
+			return true
+		}
+	}
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		for _, from := range c.EnvFrom {
+			if isSecret && from.SecretRef != nil && from.SecretRef.Name == name {
+				return true
+			}
+			if !isSecret && from.ConfigMapRef != nil && from.ConfigMapRef.Name == name {
+				return true
+			}
+		}
+		for _, env := range c.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if isSecret && env.ValueFrom.SecretKeyRef != nil && env.ValueFrom.SecretKeyRef.Name == name {
+				return true
+			}
+			if !isSecret && env.ValueFrom.ConfigMapKeyRef != nil && env.ValueFrom.ConfigMapKeyRef.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func targetName(binding *ConfigBinding) string {
+	if binding.Spec.Target.Name != "" {
+		return binding.Spec.Target.Name
+	}
+	return binding.Name
+}
+
+func hashOf(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(data[k]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
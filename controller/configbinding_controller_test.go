@@ -0,0 +1,237 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	configerclient "kubegems.io/configer/client"
+)
+
+// memoryClient is an in-memory ConfigClientIface
+type memoryClient struct {
+	configerclient.ConfigClientIface
+	values    map[string]string
+	sensitive map[string]bool
+}
+
+func (m *memoryClient) Get(ctx context.Context, item *configerclient.ConfigItem) error {
+	v, ok := m.values[item.Key]
+	if !ok {
+		return fmt.Errorf("key %s not found", item.Key)
+	}
+	item.Value = v
+	return nil
+}
+
+func (m *memoryClient) List(ctx context.Context, opts *configerclient.ListOptions) ([]*configerclient.ConfigItem, error) {
+	ret := []*configerclient.ConfigItem{}
+	for k, v := range m.values {
+		ret = append(ret, &configerclient.ConfigItem{Key: k, Value: v})
+	}
+	return ret, nil
+}
+
+func (m *memoryClient) IsSensitive(ctx context.Context, item *configerclient.ConfigItem) (bool, error) {
+	return m.sensitive[item.Key], nil
+}
+
+func (m *memoryClient) ClientOf(item *configerclient.ConfigItem) (string, configerclient.ConfigClientIface, error) {
+	return "test", m, nil
+}
+
+func newTestReconciler(t *testing.T, values map[string]string, objs ...client.Object) *ConfigBindingReconciler {
+	scheme := runtime.NewScheme()
+	clientgoscheme.AddToScheme(scheme)
+	AddToScheme(scheme)
+	return &ConfigBindingReconciler{
+		Client:  fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+		Scheme:  scheme,
+		Clients: &memoryClient{values: values, sensitive: map[string]bool{"password": true}},
+		Authorize: func(ctx context.Context, namespace string, item *configerclient.ConfigItem) error {
+			if item.Environment == "prod" {
+				return configerclient.UnauthorizedError("namespace %s can not read environment %s", namespace, item.Environment)
+			}
+			return nil
+		},
+	}
+}
+
+func TestConfigBindingReconciler_Reconcile(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     ConfigBindingSpec
+		wantData map[string]string
+		wantErr  bool
+	}{
+		{
+			name:     "test render configmap with keys",
+			spec:     ConfigBindingSpec{Tenant: "t", Project: "p", Environment: "dev", Keys: []string{"a"}},
+			wantData: map[string]string{"a": "1"},
+		},
+		{
+			name:     "test render secret with all keys",
+			spec:     ConfigBindingSpec{Tenant: "t", Project: "p", Environment: "dev", Target: ConfigBindingTarget{Kind: TargetSecret, Name: "creds"}},
+			wantData: map[string]string{"a": "1", "b": "2", "password": "3"},
+		},
+		{
+			name:     "test render sensitive key into secret",
+			spec:     ConfigBindingSpec{Tenant: "t", Project: "p", Environment: "dev", Keys: []string{"password"}, Target: ConfigBindingTarget{Kind: TargetSecret, Name: "creds"}},
+			wantData: map[string]string{"password": "3"},
+		},
+		{
+			name:    "test render failed with sensitive key into configmap",
+			spec:    ConfigBindingSpec{Tenant: "t", Project: "p", Environment: "dev", Keys: []string{"password"}},
+			wantErr: true,
+		},
+		{
+			name:    "test render failed with all keys including sensitive into configmap",
+			spec:    ConfigBindingSpec{Tenant: "t", Project: "p", Environment: "dev"},
+			wantErr: true,
+		},
+		{
+			name:    "test render failed with environment not authorized",
+			spec:    ConfigBindingSpec{Tenant: "t", Project: "p", Environment: "prod", Keys: []string{"a"}},
+			wantErr: true,
+		},
+		{
+			name:    "test render failed with not exist key",
+			spec:    ConfigBindingSpec{Tenant: "t", Project: "p", Environment: "dev", Keys: []string{"c"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binding := &ConfigBinding{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}, Spec: tt.spec}
+			r := newTestReconciler(t, map[string]string{"a": "1", "b": "2", "password": "3"}, binding)
+			ctx := context.Background()
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "app", Namespace: "default"}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reconcile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got := &ConfigBinding{}
+			r.Get(ctx, client.ObjectKeyFromObject(binding), got)
+			if got.Status.Ready == tt.wantErr {
+				t.Errorf("status ready = %v, message = %s", got.Status.Ready, got.Status.Message)
+			}
+			if tt.wantErr {
+				return
+			}
+			data := map[string]string{}
+			if tt.spec.Target.Kind == TargetSecret {
+				secret := &corev1.Secret{}
+				if err := r.Get(ctx, types.NamespacedName{Name: tt.spec.Target.Name, Namespace: "default"}, secret); err != nil {
+					t.Fatalf("get secret failed, %v", err)
+				}
+				for k, v := range secret.Data {
+					data[k] = string(v)
+				}
+			} else {
+				cm := &corev1.ConfigMap{}
+				if err := r.Get(ctx, types.NamespacedName{Name: "app", Namespace: "default"}, cm); err != nil {
+					t.Fatalf("get configmap failed, %v", err)
+				}
+				data = cm.Data
+			}
+			if fmt.Sprint(data) != fmt.Sprint(tt.wantData) {
+				t.Errorf("rendered data = %v, want %v", data, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestConfigBindingReconciler_RestartWorkloads(t *testing.T) {
+	binding := &ConfigBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       ConfigBindingSpec{Tenant: "t", Project: "p", Environment: "dev", RestartWorkloads: true},
+	}
+	podSpec := func(cm string) corev1.PodTemplateSpec {
+		return corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app", EnvFrom: []corev1.EnvFromSource{{
+				ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: cm}},
+			}}}},
+		}}
+	}
+	referencing := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "ref", Namespace: "default"}, Spec: appsv1.DeploymentSpec{Template: podSpec("app")}}
+	other := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}, Spec: appsv1.DeploymentSpec{Template: podSpec("other")}}
+	values := map[string]string{"a": "1"}
+	r := newTestReconciler(t, values, binding, referencing, other)
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "app", Namespace: "default"}}
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	got := &appsv1.Deployment{}
+	r.Get(ctx, client.ObjectKeyFromObject(referencing), got)
+	if _, ok := got.Spec.Template.Annotations[AnnotationConfigHash]; ok {
+		t.Errorf("workload should not be restarted on the first sync")
+	}
+
+	values["a"] = "2"
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	r.Get(ctx, client.ObjectKeyFromObject(referencing), got)
+	if got.Spec.Template.Annotations[AnnotationConfigHash] == "" {
+		t.Errorf("referencing workload should be restarted")
+	}
+	r.Get(ctx, client.ObjectKeyFromObject(other), got)
+	if _, ok := got.Spec.Template.Annotations[AnnotationConfigHash]; ok {
+		t.Errorf("not referencing workload should not be restarted")
+	}
+}
+
+func TestConfigBindingReconciler_NotAuthorized(t *testing.T) {
+	binding := &ConfigBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       ConfigBindingSpec{Tenant: "t", Project: "p", Environment: "dev"},
+	}
+	r := newTestReconciler(t, map[string]string{"a": "1"}, binding)
+	r.Authorize = nil
+	ctx := context.Background()
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "app", Namespace: "default"}}); err == nil {
+		t.Fatalf("Reconcile() should be refused without Authorize")
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "app", Namespace: "default"}, &corev1.ConfigMap{}); err == nil {
+		t.Errorf("configmap should not be created")
+	}
+}
+
+func TestConfigBindingReconciler_StatusUnchanged(t *testing.T) {
+	binding := &ConfigBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       ConfigBindingSpec{Tenant: "t", Project: "p", Environment: "dev"},
+	}
+	values := map[string]string{"a": "1"}
+	r := newTestReconciler(t, values, binding)
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "app", Namespace: "default"}}
+	reconcile := func() *ConfigBinding {
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+		got := &ConfigBinding{}
+		r.Get(ctx, req.NamespacedName, got)
+		return got
+	}
+
+	first := reconcile()
+	if second := reconcile(); second.ResourceVersion != first.ResourceVersion {
+		t.Errorf("status should not be written if nothing changed, resource version %s -> %s", first.ResourceVersion, second.ResourceVersion)
+	}
+	values["a"] = "2"
+	if third := reconcile(); third.ResourceVersion == first.ResourceVersion || third.Status.Hash == first.Status.Hash {
+		t.Errorf("status should be written if the configs changed")
+	}
+}
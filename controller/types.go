@@ -0,0 +1,132 @@
+package controller
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	GroupVersion  = schema.GroupVersion{Group: "configer.kubegems.io", Version: "v1alpha1"}
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+	AddToScheme   = SchemeBuilder.AddToScheme
+)
+
+func init() {
+	SchemeBuilder.Register(&ConfigBinding{}, &ConfigBindingList{})
+}
+
+type TargetKind string
+
+const (
+	TargetConfigMap TargetKind = "ConfigMap"
+	TargetSecret    TargetKind = "Secret"
+)
+
+type ConfigBindingTarget struct {
+	// Kind is ConfigMap or Secret, default ConfigMap
+	Kind TargetKind `json:"kind,omitempty"`
+	// Name of the rendered ConfigMap or Secret, default the name of ConfigBinding
+	Name string `json:"name,omitempty"`
+}
+
+type ConfigBindingSpec struct {
+	Tenant      string `json:"tenant"`
+	Project     string `json:"project"`
+	Environment string `json:"environment"`
+	// Keys to render, all keys of the environment are rendered if empty
+	Keys   []string            `json:"keys,omitempty"`
+	Target ConfigBindingTarget `json:"target,omitempty"`
+	// RestartWorkloads triggers a rolling restart of workloads referencing the target once changed
+	RestartWorkloads bool `json:"restartWorkloads,omitempty"`
+	// RefreshInterval is the interval to check changes from backend, default 1m
+	RefreshInterval *metav1.Duration `json:"refreshInterval,omitempty"`
+}
+
+type ConfigBindingStatus struct {
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+	Hash               string `json:"hash,omitempty"`
+	// LastSyncTime is when the synced configs or the status changed last time
+	LastSyncTime metav1.Time `json:"lastSyncTime,omitempty"`
+	Ready        bool        `json:"ready"`
+	Message      string      `json:"message,omitempty"`
+}
+
+// ConfigBinding renders configs of configer into a ConfigMap or Secret
+type ConfigBinding struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ConfigBindingSpec   `json:"spec,omitempty"`
+	Status ConfigBindingStatus `json:"status,omitempty"`
+}
+
+type ConfigBindingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ConfigBinding `json:"items"`
+}
+
+func (in *ConfigBinding) DeepCopyInto(out *ConfigBinding) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+func (in *ConfigBinding) DeepCopy() *ConfigBinding {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigBinding)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *ConfigBinding) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+func (in *ConfigBindingSpec) DeepCopyInto(out *ConfigBindingSpec) {
+	*out = *in
+	if in.Keys != nil {
+		out.Keys = make([]string, len(in.Keys))
+		copy(out.Keys, in.Keys)
+	}
+	if in.RefreshInterval != nil {
+		out.RefreshInterval = new(metav1.Duration)
+		*out.RefreshInterval = *in.RefreshInterval
+	}
+}
+
+func (in *ConfigBindingStatus) DeepCopyInto(out *ConfigBindingStatus) {
+	*out = *in
+	in.LastSyncTime.DeepCopyInto(&out.LastSyncTime)
+}
+
+func (in *ConfigBindingList) DeepCopyInto(out *ConfigBindingList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]ConfigBinding, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+func (in *ConfigBindingList) DeepCopy() *ConfigBindingList {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigBindingList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *ConfigBindingList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
@@ -0,0 +1,515 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: configer/v1/configer.proto
+
+package configerv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// ConfigerClient is the client API for Configer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ConfigerClient interface {
+	// list configs of the environment
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	// base info of the backend
+	BaseInfo(ctx context.Context, in *EnvironmentRequest, opts ...grpc.CallOption) (*BaseInfoResponse, error)
+	// accounts of the environment
+	Accounts(ctx context.Context, in *EnvironmentRequest, opts ...grpc.CallOption) (*AccountsResponse, error)
+	// get config item detail
+	Get(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*ConfigItem, error)
+	// publish config item
+	Pub(ctx context.Context, in *ConfigItem, opts ...grpc.CallOption) (*ConfigItem, error)
+	// delete config item
+	Delete(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*ConfigItem, error)
+	// get config item history
+	History(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*HistoryResponse, error)
+	// show config item listener
+	Listener(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*ListenerResponse, error)
+	// sync backend data to database
+	Backup(ctx context.Context, in *EnvironmentRequest, opts ...grpc.CallOption) (*EnvironmentRequest, error)
+	// sync database data to backend
+	Restore(ctx context.Context, in *EnvironmentRequest, opts ...grpc.CallOption) (*EnvironmentRequest, error)
+	// watch sends the config item first, then sends it again whenever the value changes
+	Watch(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (Configer_WatchClient, error)
+}
+
+type configerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewConfigerClient(cc grpc.ClientConnInterface) ConfigerClient {
+	return &configerClient{cc}
+}
+
+func (c *configerClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, "/configer.v1.Configer/List", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *configerClient) BaseInfo(ctx context.Context, in *EnvironmentRequest, opts ...grpc.CallOption) (*BaseInfoResponse, error) {
+	out := new(BaseInfoResponse)
+	err := c.cc.Invoke(ctx, "/configer.v1.Configer/BaseInfo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *configerClient) Accounts(ctx context.Context, in *EnvironmentRequest, opts ...grpc.CallOption) (*AccountsResponse, error) {
+	out := new(AccountsResponse)
+	err := c.cc.Invoke(ctx, "/configer.v1.Configer/Accounts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *configerClient) Get(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*ConfigItem, error) {
+	out := new(ConfigItem)
+	err := c.cc.Invoke(ctx, "/configer.v1.Configer/Get", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *configerClient) Pub(ctx context.Context, in *ConfigItem, opts ...grpc.CallOption) (*ConfigItem, error) {
+	out := new(ConfigItem)
+	err := c.cc.Invoke(ctx, "/configer.v1.Configer/Pub", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *configerClient) Delete(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*ConfigItem, error) {
+	out := new(ConfigItem)
+	err := c.cc.Invoke(ctx, "/configer.v1.Configer/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *configerClient) History(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*HistoryResponse, error) {
+	out := new(HistoryResponse)
+	err := c.cc.Invoke(ctx, "/configer.v1.Configer/History", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *configerClient) Listener(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*ListenerResponse, error) {
+	out := new(ListenerResponse)
+	err := c.cc.Invoke(ctx, "/configer.v1.Configer/Listener", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *configerClient) Backup(ctx context.Context, in *EnvironmentRequest, opts ...grpc.CallOption) (*EnvironmentRequest, error) {
+	out := new(EnvironmentRequest)
+	err := c.cc.Invoke(ctx, "/configer.v1.Configer/Backup", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *configerClient) Restore(ctx context.Context, in *EnvironmentRequest, opts ...grpc.CallOption) (*EnvironmentRequest, error) {
+	out := new(EnvironmentRequest)
+	err := c.cc.Invoke(ctx, "/configer.v1.Configer/Restore", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *configerClient) Watch(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (Configer_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Configer_ServiceDesc.Streams[0], "/configer.v1.Configer/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &configerWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Configer_WatchClient interface {
+	Recv() (*ConfigItem, error)
+	grpc.ClientStream
+}
+
+type configerWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *configerWatchClient) Recv() (*ConfigItem, error) {
+	m := new(ConfigItem)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ConfigerServer is the server API for Configer service.
+// All implementations must embed UnimplementedConfigerServer
+// for forward compatibility
+type ConfigerServer interface {
+	// list configs of the environment
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	// base info of the backend
+	BaseInfo(context.Context, *EnvironmentRequest) (*BaseInfoResponse, error)
+	// accounts of the environment
+	Accounts(context.Context, *EnvironmentRequest) (*AccountsResponse, error)
+	// get config item detail
+	Get(context.Context, *KeyRequest) (*ConfigItem, error)
+	// publish config item
+	Pub(context.Context, *ConfigItem) (*ConfigItem, error)
+	// delete config item
+	Delete(context.Context, *KeyRequest) (*ConfigItem, error)
+	// get config item history
+	History(context.Context, *KeyRequest) (*HistoryResponse, error)
+	// show config item listener
+	Listener(context.Context, *KeyRequest) (*ListenerResponse, error)
+	// sync backend data to database
+	Backup(context.Context, *EnvironmentRequest) (*EnvironmentRequest, error)
+	// sync database data to backend
+	Restore(context.Context, *EnvironmentRequest) (*EnvironmentRequest, error)
+	// watch sends the config item first, then sends it again whenever the value changes
+	Watch(*KeyRequest, Configer_WatchServer) error
+	mustEmbedUnimplementedConfigerServer()
+}
+
+// UnimplementedConfigerServer must be embedded to have forward compatible implementations.
+type UnimplementedConfigerServer struct {
+}
+
+func (UnimplementedConfigerServer) List(context.Context, *ListRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedConfigerServer) BaseInfo(context.Context, *EnvironmentRequest) (*BaseInfoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BaseInfo not implemented")
+}
+func (UnimplementedConfigerServer) Accounts(context.Context, *EnvironmentRequest) (*AccountsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Accounts not implemented")
+}
+func (UnimplementedConfigerServer) Get(context.Context, *KeyRequest) (*ConfigItem, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedConfigerServer) Pub(context.Context, *ConfigItem) (*ConfigItem, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Pub not implemented")
+}
+func (UnimplementedConfigerServer) Delete(context.Context, *KeyRequest) (*ConfigItem, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedConfigerServer) History(context.Context, *KeyRequest) (*HistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method History not implemented")
+}
+func (UnimplementedConfigerServer) Listener(context.Context, *KeyRequest) (*ListenerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Listener not implemented")
+}
+func (UnimplementedConfigerServer) Backup(context.Context, *EnvironmentRequest) (*EnvironmentRequest, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Backup not implemented")
+}
+func (UnimplementedConfigerServer) Restore(context.Context, *EnvironmentRequest) (*EnvironmentRequest, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Restore not implemented")
+}
+func (UnimplementedConfigerServer) Watch(*KeyRequest, Configer_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedConfigerServer) mustEmbedUnimplementedConfigerServer() {}
+
+// UnsafeConfigerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ConfigerServer will
+// result in compilation errors.
+type UnsafeConfigerServer interface {
+	mustEmbedUnimplementedConfigerServer()
+}
+
+func RegisterConfigerServer(s grpc.ServiceRegistrar, srv ConfigerServer) {
+	s.RegisterService(&Configer_ServiceDesc, srv)
+}
+
+func _Configer_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConfigerServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/configer.v1.Configer/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConfigerServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Configer_BaseInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnvironmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConfigerServer).BaseInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/configer.v1.Configer/BaseInfo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConfigerServer).BaseInfo(ctx, req.(*EnvironmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Configer_Accounts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnvironmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConfigerServer).Accounts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/configer.v1.Configer/Accounts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConfigerServer).Accounts(ctx, req.(*EnvironmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Configer_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConfigerServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/configer.v1.Configer/Get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConfigerServer).Get(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Configer_Pub_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfigItem)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConfigerServer).Pub(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/configer.v1.Configer/Pub",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConfigerServer).Pub(ctx, req.(*ConfigItem))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Configer_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConfigerServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/configer.v1.Configer/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConfigerServer).Delete(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Configer_History_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConfigerServer).History(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/configer.v1.Configer/History",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConfigerServer).History(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Configer_Listener_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConfigerServer).Listener(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/configer.v1.Configer/Listener",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConfigerServer).Listener(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Configer_Backup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnvironmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConfigerServer).Backup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/configer.v1.Configer/Backup",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConfigerServer).Backup(ctx, req.(*EnvironmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Configer_Restore_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnvironmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConfigerServer).Restore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/configer.v1.Configer/Restore",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConfigerServer).Restore(ctx, req.(*EnvironmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Configer_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(KeyRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ConfigerServer).Watch(m, &configerWatchServer{stream})
+}
+
+type Configer_WatchServer interface {
+	Send(*ConfigItem) error
+	grpc.ServerStream
+}
+
+type configerWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *configerWatchServer) Send(m *ConfigItem) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Configer_ServiceDesc is the grpc.ServiceDesc for Configer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Configer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "configer.v1.Configer",
+	HandlerType: (*ConfigerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "List",
+			Handler:    _Configer_List_Handler,
+		},
+		{
+			MethodName: "BaseInfo",
+			Handler:    _Configer_BaseInfo_Handler,
+		},
+		{
+			MethodName: "Accounts",
+			Handler:    _Configer_Accounts_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _Configer_Get_Handler,
+		},
+		{
+			MethodName: "Pub",
+			Handler:    _Configer_Pub_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Configer_Delete_Handler,
+		},
+		{
+			MethodName: "History",
+			Handler:    _Configer_History_Handler,
+		},
+		{
+			MethodName: "Listener",
+			Handler:    _Configer_Listener_Handler,
+		},
+		{
+			MethodName: "Backup",
+			Handler:    _Configer_Backup_Handler,
+		},
+		{
+			MethodName: "Restore",
+			Handler:    _Configer_Restore_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _Configer_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "configer/v1/configer.proto",
+}
@@ -0,0 +1,60 @@
+package sdk
+
+import (
+	"os"
+	"path/filepath"
+
+	"kubegems.io/configer/client"
+)
+
+// diskCache keeps the last fetched values, so that the application can start when backend is down
+type diskCache struct {
+	dir string
+}
+
+func (d *diskCache) path(item *client.ConfigItem) string {
+	return filepath.Join(d.dir, item.Tenant, item.Project, item.Environment, item.Key)
+}
+
+func (d *diskCache) load(item *client.ConfigItem) (string, error) {
+	if d.dir == "" {
+		return "", os.ErrNotExist
+	}
+	content, err := os.ReadFile(d.path(item))
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// store writes the value atomically, errors are ignored since cache is optional
+func (d *diskCache) store(item *client.ConfigItem, value string) {
+	if d.dir == "" {
+		return
+	}
+	file := d.path(item)
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".tmp-*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(value); err != nil {
+		tmp.Close()
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		return
+	}
+	os.Rename(tmp.Name(), file)
+}
+
+// remove deletes the cached value of the key which does not exist anymore
+func (d *diskCache) remove(item *client.ConfigItem) {
+	if d.dir == "" {
+		return
+	}
+	os.Remove(d.path(item))
+}
@@ -0,0 +1,75 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"kubegems.io/configer/client"
+)
+
+// dataKey returns the data key of the environment, it is fetched from configer server with the account once needed
+func (c *Client) dataKey(ctx context.Context) ([]byte, error) {
+	c.keyLock.Lock()
+	defer c.keyLock.Unlock()
+	if c.opts.DataKey != nil {
+		return c.opts.DataKey, nil
+	}
+	if c.opts.Server == "" {
+		return nil, fmt.Errorf("the value is encrypted, server or data key must be specified")
+	}
+	body, err := json.Marshal(c.opts.Account)
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("%s/configer/tenant/%s/project/%s/environment/%s/datakey", strings.TrimSuffix(c.opts.Server, "/"),
+		url.PathEscape(c.opts.Tenant), url.PathEscape(c.opts.Project), url.PathEscape(c.opts.Environment))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opts.Token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	ret := struct {
+		Data    client.DataKey `json:"data"`
+		Message string         `json:"message"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, fmt.Errorf("get data key failed, status %d, %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get data key failed, status %d, %s", resp.StatusCode, ret.Message)
+	}
+	key, err := base64.StdEncoding.DecodeString(ret.Data.Key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key, %w", err)
+	}
+	c.opts.DataKey = key
+	return key, nil
+}
+
+// decrypt returns the plain value of raw, values not encrypted are returned as is
+func (c *Client) decrypt(ctx context.Context, key, raw string) (string, error) {
+	if !client.IsEncryptedValue(raw) {
+		return raw, nil
+	}
+	dataKey, err := c.dataKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	item := c.itemOf(key)
+	item.Value = raw
+	return client.DecryptValue(dataKey, item)
+}
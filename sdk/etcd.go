@@ -0,0 +1,76 @@
+package sdk
+
+import (
+	"context"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"kubegems.io/configer/client"
+)
+
+type etcdBackend struct {
+	opts Options
+	cli  *clientv3.Client
+}
+
+func newEtcdBackend(opts Options) (*etcdBackend, error) {
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   opts.Endpoints,
+		Username:    opts.Account.Username,
+		Password:    opts.Account.Password,
+		DialTimeout: opts.Timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &etcdBackend{opts: opts, cli: cli}, nil
+}
+
+func (e *etcdBackend) keyOf(key string) (string, error) {
+	mapper, err := client.MapperForEtcd(&client.ConfigItem{
+		Tenant:      e.opts.Tenant,
+		Project:     e.opts.Project,
+		Environment: e.opts.Environment,
+		Key:         key,
+	})
+	if err != nil {
+		return "", err
+	}
+	return mapper.Key(), nil
+}
+
+func (e *etcdBackend) get(ctx context.Context, key string) (string, error) {
+	k, err := e.keyOf(key)
+	if err != nil {
+		return "", err
+	}
+	resp, err := e.cli.Get(ctx, k)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Kvs) != 1 {
+		return "", client.NotFoundError("key %s not found", k)
+	}
+	return string(resp.Kvs[0].Value), nil
+}
+
+func (e *etcdBackend) watch(ctx context.Context, key string, onChange func(value string)) error {
+	k, err := e.keyOf(key)
+	if err != nil {
+		return err
+	}
+	for resp := range e.cli.Watch(ctx, k) {
+		if err := resp.Err(); err != nil {
+			return err
+		}
+		for _, ev := range resp.Events {
+			if ev.Type == clientv3.EventTypePut {
+				onChange(string(ev.Kv.Value))
+			}
+		}
+	}
+	return nil
+}
+
+func (e *etcdBackend) close() error {
+	return e.cli.Close()
+}
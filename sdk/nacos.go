@@ -0,0 +1,222 @@
+package sdk
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"kubegems.io/configer/client"
+)
+
+const nacosLongPollingTimeout = 30 * time.Second
+
+// nacosBackend reads configs with the application account, it only needs read permission.
+// the endpoints are tried in turn, the one responded last is used first
+type nacosBackend struct {
+	opts    Options
+	addrs   []string
+	current int32
+	tenant  string
+	client  *http.Client
+
+	token    string
+	tokenExp time.Time
+	lock     sync.Mutex
+}
+
+func newNacosBackend(opts Options) (*nacosBackend, error) {
+	if len(opts.Endpoints) == 0 {
+		return nil, fmt.Errorf("nacos endpoints must be specified")
+	}
+	tenant := opts.BaseInfo["nacos_tenant"]
+	if tenant == "" {
+		tenant = client.NacosTenantID(opts.Tenant, opts.Project)
+	}
+	addrs := make([]string, len(opts.Endpoints))
+	for i, endpoint := range opts.Endpoints {
+		addrs[i] = strings.TrimSuffix(endpoint, "/")
+	}
+	return &nacosBackend{
+		opts:   opts,
+		addrs:  addrs,
+		tenant: tenant,
+		client: &http.Client{Timeout: nacosLongPollingTimeout + opts.Timeout},
+	}, nil
+}
+
+// do sends the request built for an endpoint, the next endpoint is tried if it is unreachable or responds a server error
+func (n *nacosBackend) do(ctx context.Context, newRequest func(addr string) (*http.Request, error)) (*http.Response, error) {
+	start := int(atomic.LoadInt32(&n.current))
+	var lastErr error
+	for i := range n.addrs {
+		idx := (start + i) % len(n.addrs)
+		req, err := newRequest(n.addrs[idx])
+		if err != nil {
+			return nil, err
+		}
+		resp, err := n.client.Do(req)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			atomic.StoreInt32(&n.current, int32(idx))
+			return resp, nil
+		}
+		if err == nil {
+			resp.Body.Close()
+			err = client.ErrorOfStatus(resp.StatusCode, "request nacos %s failed", n.addrs[idx])
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, client.ErrorOfBackend(ctx, lastErr)
+}
+
+func (n *nacosBackend) accessToken(ctx context.Context) (string, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.opts.Account.Username == "" || time.Now().Before(n.tokenExp) {
+		return n.token, nil
+	}
+	form := url.Values{"username": {n.opts.Account.Username}, "password": {n.opts.Account.Password}}
+	resp, err := n.do(ctx, func(addr string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr+client.LOGIN_PATH, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", client.ErrorOfStatus(resp.StatusCode, "failed to login nacos")
+	}
+	auth := client.AuthInfo{}
+	if err := json.NewDecoder(resp.Body).Decode(&auth); err != nil {
+		return "", err
+	}
+	n.token = auth.AccessToken
+	// refresh the token before it expires
+	n.tokenExp = time.Now().Add(time.Duration(auth.TokenTTL)*time.Second - time.Minute)
+	return n.token, nil
+}
+
+func (n *nacosBackend) query(ctx context.Context, key string) (url.Values, error) {
+	token, err := n.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	q.Add("tenant", n.tenant)
+	q.Add("group", n.opts.Environment)
+	q.Add("dataId", key)
+	if token != "" {
+		q.Add("accessToken", token)
+	}
+	return q, nil
+}
+
+func (n *nacosBackend) get(ctx context.Context, key string) (string, error) {
+	q, err := n.query(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	resp, err := n.do(ctx, func(addr string) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, addr+client.CONFIG_PATH+"?"+q.Encode(), nil)
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", client.ErrorOfBackend(ctx, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", client.ErrorOfStatus(resp.StatusCode, "get config %s failed", key)
+	}
+	return string(content), nil
+}
+
+func (n *nacosBackend) watch(ctx context.Context, key string, onChange func(value string)) error {
+	current, err := n.get(ctx, key)
+	if err != nil {
+		return err
+	}
+	for {
+		changed, err := n.poll(ctx, key, current)
+		if err != nil {
+			return err
+		}
+		if changed {
+			value, err := n.get(ctx, key)
+			if err != nil {
+				return err
+			}
+			current = value
+			onChange(value)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// poll is the nacos long polling listener, returns true if the value changed
+func (n *nacosBackend) poll(ctx context.Context, key, current string) (bool, error) {
+	q, err := n.query(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	md5sum := ""
+	if current != "" {
+		sum := md5.Sum([]byte(current))
+		md5sum = hex.EncodeToString(sum[:])
+	}
+	listening := strings.Join([]string{key, n.opts.Environment, md5sum, n.tenant}, "\x02") + "\x01"
+	form := url.Values{"Listening-Configs": {listening}}
+	resp, err := n.do(ctx, func(addr string) (*http.Request, error) {
+		u := addr + client.LISTENER_PATH
+		if token := q.Get("accessToken"); token != "" {
+			u += "?accessToken=" + url.QueryEscape(token)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Long-Pulling-Timeout", fmt.Sprint(nacosLongPollingTimeout.Milliseconds()))
+		return req, nil
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, nil
+		}
+		return false, err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, client.ErrorOfStatus(resp.StatusCode, "listen config %s failed", key)
+	}
+	return strings.TrimSpace(string(content)) != "", nil
+}
+
+func (n *nacosBackend) close() error {
+	n.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,77 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"kubegems.io/configer/client"
+)
+
+type redisBackend struct {
+	mapper *client.RedisMapper
+	cli    redis.UniversalClient
+	db     int
+}
+
+func newRedisBackend(opts Options) (*redisBackend, error) {
+	if len(opts.Endpoints) == 0 {
+		return nil, fmt.Errorf("redis endpoints must be specified")
+	}
+	mapper, err := client.MapperForRedis(&client.ConfigItem{
+		Tenant:      opts.Tenant,
+		Project:     opts.Project,
+		Environment: opts.Environment,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ropts := &redis.UniversalOptions{
+		Addrs:       opts.Endpoints,
+		Username:    opts.Account.Username,
+		Password:    opts.Account.Password,
+		DialTimeout: opts.Timeout,
+	}
+	return &redisBackend{
+		mapper: mapper,
+		cli:    redis.NewUniversalClient(ropts),
+		db:     ropts.DB,
+	}, nil
+}
+
+func (r *redisBackend) get(ctx context.Context, key string) (string, error) {
+	value, err := r.cli.HGet(ctx, r.mapper.HashKey(), key).Result()
+	if err == redis.Nil {
+		return "", client.NotFoundError("key %s not found in %s", key, r.mapper.HashKey())
+	}
+	return value, err
+}
+
+// watch subscribes the keyspace notifications of the environment hash, the event doesn't contain the field, so the value is compared by caller
+func (r *redisBackend) watch(ctx context.Context, key string, onChange func(value string)) error {
+	sub := r.cli.Subscribe(ctx, r.mapper.KeyspaceChannel(r.db))
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-ch:
+			if !ok {
+				return fmt.Errorf("subscription of %s closed", r.mapper.HashKey())
+			}
+			value, err := r.get(ctx, key)
+			if err != nil {
+				continue
+			}
+			onChange(value)
+		}
+	}
+}
+
+func (r *redisBackend) close() error {
+	return r.cli.Close()
+}
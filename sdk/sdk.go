@@ -0,0 +1,220 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"kubegems.io/configer/client"
+)
+
+/*
+	sdk for applications consuming configs managed by configer, usage:
+
+	cli, err := sdk.New(sdk.Options{
+		Tenant:      "tenant",
+		Project:     "project",
+		Environment: "dev",
+		Account:     client.Account{Username: "...", Password: "..."}, // from configer accounts api
+		BaseInfo:    map[string]string{"provider": "nacos", "nacos_tenant": "..."}, // from configer baseinfo api
+		Endpoints:   []string{"http://nacos:8848"},
+		CacheDir:    "/var/cache/configer",
+		Server:      "http://configer/api", // to get the data key if some values are encrypted
+	})
+	value, err := cli.Get(ctx, "application.yaml")
+	cli.Watch(ctx, "application.yaml", func(v *sdk.Value) { ... })
+*/
+
+const (
+	DefaultTimeout     = 5 * time.Second
+	watchRetryInterval = 5 * time.Second
+)
+
+type Options struct {
+	Tenant      string
+	Project     string
+	Environment string
+	Application string
+
+	Account   client.Account
+	Endpoints []string
+	// BaseInfo is the result of configer baseinfo api, the backend is detected from it's provider
+	BaseInfo map[string]string
+	// CacheDir is used to store the last fetched values, they are used when backend is down, empty to disable
+	CacheDir string
+	Timeout  time.Duration
+
+	// Server is the base url of the configer api, the data key of the environment is fetched from it with the account
+	// once an encrypted value is read, Token is sent as the bearer token if the api requires
+	Server string
+	Token  string
+	// DataKey decrypts the encrypted values instead of fetching it from Server
+	DataKey []byte
+}
+
+type backend interface {
+	get(ctx context.Context, key string) (string, error)
+	// watch blocks until ctx done, onChange is called with the new value once the key changed
+	watch(ctx context.Context, key string, onChange func(value string)) error
+	close() error
+}
+
+type Client struct {
+	opts    Options
+	backend backend
+	cache   *diskCache
+
+	values map[string]string
+	lock   sync.RWMutex
+
+	keyLock sync.Mutex
+}
+
+func New(opts Options) (*Client, error) {
+	if opts.Tenant == "" || opts.Project == "" || opts.Environment == "" {
+		return nil, fmt.Errorf("tenant, project and environment must be specified")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	var (
+		b   backend
+		err error
+	)
+	switch provider := opts.BaseInfo["provider"]; provider {
+	case "nacos":
+		b, err = newNacosBackend(opts)
+	case "etcd":
+		b, err = newEtcdBackend(opts)
+	case "redis":
+		b, err = newRedisBackend(opts)
+	default:
+		return nil, fmt.Errorf("provider %s is not supported", provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		opts:    opts,
+		backend: b,
+		cache:   &diskCache{dir: opts.CacheDir},
+		values:  map[string]string{},
+	}, nil
+}
+
+// Get fetches the value from backend, the cached value is returned only if backend is unavailable or timeout,
+// so a deleted key or a revoked permission is reported instead of a stale value.
+// encrypted values are decrypted, the cache keeps them encrypted.
+func (c *Client) Get(ctx context.Context, key string) (*Value, error) {
+	nctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+	raw, err := c.backend.get(nctx, key)
+	if err != nil {
+		err = client.ErrorOfBackend(nctx, err)
+		if !errors.Is(err, client.ErrBackendUnavailable) && !errors.Is(err, client.ErrTimeout) {
+			if errors.Is(err, client.ErrNotFound) {
+				c.cache.remove(c.itemOf(key))
+			}
+			return nil, err
+		}
+		cached, cerr := c.cache.load(c.itemOf(key))
+		if cerr != nil {
+			return nil, err
+		}
+		raw = cached
+	} else {
+		c.cache.store(c.itemOf(key), raw)
+	}
+	c.lock.Lock()
+	c.values[key] = raw
+	c.lock.Unlock()
+	value, err := c.decrypt(nctx, key, raw)
+	if err != nil {
+		return nil, err
+	}
+	return &Value{Key: key, Raw: value}, nil
+}
+
+// Watch calls onChange in background once the value of key changed, until ctx done
+func (c *Client) Watch(ctx context.Context, key string, onChange func(v *Value)) {
+	go func() {
+		for {
+			err := c.backend.watch(ctx, key, func(raw string) {
+				c.lock.Lock()
+				old, exist := c.values[key]
+				c.values[key] = raw
+				c.lock.Unlock()
+				if exist && old == raw {
+					return
+				}
+				c.cache.store(c.itemOf(key), raw)
+				// the change is skipped if it can not be decrypted, the application keeps the last value
+				value, err := c.decrypt(ctx, key, raw)
+				if err != nil {
+					return
+				}
+				onChange(&Value{Key: key, Raw: value})
+			})
+			if err == nil || ctx.Err() != nil {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(watchRetryInterval):
+			}
+		}
+	}()
+}
+
+func (c *Client) Close() error {
+	return c.backend.close()
+}
+
+func (c *Client) itemOf(key string) *client.ConfigItem {
+	return &client.ConfigItem{
+		Tenant:      c.opts.Tenant,
+		Project:     c.opts.Project,
+		Environment: c.opts.Environment,
+		Application: c.opts.Application,
+		Key:         key,
+	}
+}
+
+type Value struct {
+	Key string
+	Raw string
+}
+
+func (v *Value) String() string {
+	return v.Raw
+}
+
+func (v *Value) Int() (int64, error) {
+	return strconv.ParseInt(strings.TrimSpace(v.Raw), 10, 64)
+}
+
+func (v *Value) Float() (float64, error) {
+	return strconv.ParseFloat(strings.TrimSpace(v.Raw), 64)
+}
+
+func (v *Value) Bool() (bool, error) {
+	return strconv.ParseBool(strings.TrimSpace(v.Raw))
+}
+
+// Unmarshal decodes the value into out, the format is detected from the extension of key, json is used by default
+func (v *Value) Unmarshal(out interface{}) error {
+	switch strings.ToLower(path.Ext(v.Key)) {
+	case ".yaml", ".yml":
+		return yaml.Unmarshal([]byte(v.Raw), out)
+	default:
+		return json.Unmarshal([]byte(v.Raw), out)
+	}
+}
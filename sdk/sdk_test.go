@@ -0,0 +1,239 @@
+package sdk
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"kubegems.io/configer/client"
+)
+
+func newTestRedisClient(t *testing.T, m *miniredis.Miniredis, cacheDir string) *Client {
+	cli, err := New(Options{
+		Tenant:      "ten1",
+		Project:     "proj1",
+		Environment: "dev",
+		BaseInfo:    map[string]string{"provider": "redis"},
+		Endpoints:   []string{m.Addr()},
+		CacheDir:    cacheDir,
+		Timeout:     time.Second,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { cli.Close() })
+	return cli
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{
+			name: "test new nacos client success",
+			opts: Options{Tenant: "t", Project: "p", Environment: "e", BaseInfo: map[string]string{"provider": "nacos"}, Endpoints: []string{"http://127.0.0.1:8848"}},
+		},
+		{
+			name:    "test new client failed with unknown provider",
+			opts:    Options{Tenant: "t", Project: "p", Environment: "e", BaseInfo: map[string]string{"provider": "zookeeper"}},
+			wantErr: true,
+		},
+		{
+			name:    "test new client failed with no environment",
+			opts:    Options{Tenant: "t", Project: "p", BaseInfo: map[string]string{"provider": "nacos"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_GetWithCache(t *testing.T) {
+	m := miniredis.RunT(t)
+	m.HSet("kubegems/ten1/proj1/dev", "app.json", `{"port": 8080}`)
+	cli := newTestRedisClient(t, m, t.TempDir())
+	ctx := context.Background()
+
+	v, err := cli.Get(ctx, "app.json")
+	if err != nil {
+		t.Fatalf("Client.Get() error = %v", err)
+	}
+	conf := struct {
+		Port int `json:"port"`
+	}{}
+	if err := v.Unmarshal(&conf); err != nil || conf.Port != 8080 {
+		t.Errorf("Value.Unmarshal() = %v, error = %v", conf, err)
+	}
+
+	// a deleted key is reported, and removed from the cache
+	m.HSet("kubegems/ten1/proj1/dev", "deleted.json", `{}`)
+	if _, err := cli.Get(ctx, "deleted.json"); err != nil {
+		t.Fatalf("Client.Get() error = %v", err)
+	}
+	m.HDel("kubegems/ten1/proj1/dev", "deleted.json")
+	if _, err := cli.Get(ctx, "deleted.json"); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("Client.Get() deleted key error = %v, want NotFound", err)
+	}
+
+	// backend is down, the cached value is used
+	m.Close()
+	v, err = cli.Get(ctx, "app.json")
+	if err != nil || v.Raw != `{"port": 8080}` {
+		t.Errorf("Client.Get() from cache = %v, error = %v", v, err)
+	}
+	for _, key := range []string{"not-cached", "deleted.json"} {
+		if _, err := cli.Get(ctx, key); !errors.Is(err, client.ErrBackendUnavailable) {
+			t.Errorf("Client.Get() not cached key %s error = %v, want BackendUnavailable", key, err)
+		}
+	}
+}
+
+func TestClient_WatchRedis(t *testing.T) {
+	m := miniredis.RunT(t)
+	m.HSet("kubegems/ten1/proj1/dev", "replicas", "1")
+	cli := newTestRedisClient(t, m, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan *Value, 1)
+	cli.Watch(ctx, "replicas", func(v *Value) { changes <- v })
+	// miniredis doesn't emit keyspace notifications, publish it manually
+	deadline := time.After(5 * time.Second)
+	m.HSet("kubegems/ten1/proj1/dev", "replicas", "3")
+	for {
+		m.Publish("__keyspace@0__:kubegems/ten1/proj1/dev", "hset")
+		select {
+		case v := <-changes:
+			if n, err := v.Int(); err != nil || n != 3 {
+				t.Errorf("changed value = %s, error = %v", v.Raw, err)
+			}
+			return
+		case <-deadline:
+			t.Fatal("change callback not called")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func TestClient_NacosGetAndWatch(t *testing.T) {
+	value := "v1"
+	mux := http.NewServeMux()
+	mux.HandleFunc(client.LOGIN_PATH, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(client.AuthInfo{AccessToken: "token", TokenTTL: 18000})
+	})
+	mux.HandleFunc(client.CONFIG_PATH, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("accessToken") != "token" || r.URL.Query().Get("tenant") != client.NacosTenantID("ten1", "proj1") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(value))
+	})
+	mux.HandleFunc(client.LISTENER_PATH, func(w http.ResponseWriter, r *http.Request) {
+		// the value changed once it is listened
+		value = "v2"
+		w.Write([]byte("changed"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	// the first endpoint is down, the others are tried
+	down := httptest.NewServer(mux)
+	down.Close()
+
+	cli, err := New(Options{
+		Tenant:      "ten1",
+		Project:     "proj1",
+		Environment: "dev",
+		Account:     client.Account{Username: "u", Password: "p"},
+		BaseInfo:    map[string]string{"provider": "nacos"},
+		Endpoints:   []string{down.URL, server.URL},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	v, err := cli.Get(ctx, "config")
+	if err != nil || v.String() != "v1" {
+		t.Fatalf("Client.Get() = %v, error = %v", v, err)
+	}
+	changes := make(chan *Value, 1)
+	cli.Watch(ctx, "config", func(v *Value) {
+		select {
+		case changes <- v:
+		default:
+		}
+	})
+	select {
+	case v := <-changes:
+		if v.String() != "v2" {
+			t.Errorf("changed value = %s, want v2", v.String())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("change callback not called")
+	}
+}
+
+func TestClient_GetEncrypted(t *testing.T) {
+	dataKey := make([]byte, client.DataKeySize)
+	item := &client.ConfigItem{Tenant: "ten1", Project: "proj1", Environment: "dev", Key: "db.password", Value: "s3cret"}
+	encrypted, err := client.EncryptValue(dataKey, item)
+	if err != nil {
+		t.Fatalf("EncryptValue() error = %v", err)
+	}
+	fetched := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		account := client.Account{}
+		json.NewDecoder(r.Body).Decode(&account)
+		if r.URL.Path != "/configer/tenant/ten1/project/proj1/environment/dev/datakey" || account.Username != "u" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fetched++
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": client.DataKey{Key: base64.StdEncoding.EncodeToString(dataKey)}})
+	}))
+	defer server.Close()
+
+	m := miniredis.RunT(t)
+	m.RequireUserAuth("u", "p")
+	m.HSet("kubegems/ten1/proj1/dev", "db.password", encrypted)
+	m.HSet("kubegems/ten1/proj1/dev", "app.json", encrypted)
+	cli, err := New(Options{
+		Tenant:      "ten1",
+		Project:     "proj1",
+		Environment: "dev",
+		Account:     client.Account{Username: "u", Password: "p"},
+		BaseInfo:    map[string]string{"provider": "redis"},
+		Endpoints:   []string{m.Addr()},
+		Server:      server.URL,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer cli.Close()
+	for i := 0; i < 2; i++ {
+		if v, err := cli.Get(context.Background(), "db.password"); err != nil || v.String() != "s3cret" {
+			t.Errorf("Client.Get() = %v, error = %v", v, err)
+		}
+	}
+	if fetched != 1 {
+		t.Errorf("data key fetched %d times, want 1", fetched)
+	}
+	// the value is bound to its key
+	if _, err := cli.Get(context.Background(), "app.json"); err == nil {
+		t.Errorf("Client.Get() value copied from another key should failed")
+	}
+}
@@ -0,0 +1,340 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"kubegems.io/configer/client"
+)
+
+// CredentialKeyEnv is the env of the base64 encoded 32 bytes key to encrypt the backend credentials
+const CredentialKeyEnv = "CONFIGER_CREDENTIAL_KEY"
+
+// CredentialKeyGetter is optionally implemented by the InfoGetter to keep random passwords of the backend accounts
+// in database, encrypted by the key. NewPlugin fails if the InfoGetter does not implement it
+type CredentialKeyGetter interface {
+	// CredentialKey returns the 32 bytes key, nil derives the passwords from the usernames as before, which is insecure
+	CredentialKey() ([]byte, error)
+}
+
+// CredentialKeyFromEnv decodes the key from CONFIGER_CREDENTIAL_KEY for the CredentialKeyGetter, returns nil if the env is not set
+func CredentialKeyFromEnv() ([]byte, error) {
+	value := os.Getenv(CredentialKeyEnv)
+	if value == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s, %w", CredentialKeyEnv, err)
+	}
+	return key, nil
+}
+
+// credentialKeyOf returns the credential key of the InfoGetter, nil for the derived passwords if it is not a CredentialKeyGetter
+func credentialKeyOf(infoGetter InfoGetter) ([]byte, error) {
+	getter, ok := infoGetter.(CredentialKeyGetter)
+	if !ok {
+		log.Printf("warning: the InfoGetter does not implement CredentialKeyGetter, passwords of the backend accounts are derived")
+		return nil, nil
+	}
+	key, err := getter.CredentialKey()
+	if err != nil {
+		return nil, err
+	}
+	if key != nil && len(key) != 32 {
+		return nil, fmt.Errorf("invalid credential key, the key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// credentialStore keeps the credentials and the shadows of the accounts of a cluster in database, passwords are encrypted by AES-GCM
+type credentialStore struct {
+	db      *gorm.DB
+	cluster string
+	aead    cipher.AEAD
+
+	lock sync.Mutex
+	// cache holds applied credentials only, the others are read from database until applied
+	cache map[string]*client.Credential
+}
+
+var _ client.ShadowStore = &credentialStore{}
+
+func newCredentialStore(db *gorm.DB, cluster string, key []byte) (*credentialStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &credentialStore{db: db, cluster: cluster, aead: aead, cache: map[string]*client.Credential{}}, nil
+}
+
+// additionalData binds the ciphertext to the account, so it can not be copied to another one
+func (s *credentialStore) additionalData(username string) []byte {
+	return []byte(s.cluster + "/" + username)
+}
+
+func (s *credentialStore) encrypt(username, password string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(password), s.additionalData(username))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *credentialStore) decrypt(username, encrypted string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted password of %s", username)
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	password, err := s.aead.Open(nil, nonce, ciphertext, s.additionalData(username))
+	if err != nil {
+		return "", fmt.Errorf("decrypt password of %s failed, %w", username, err)
+	}
+	return string(password), nil
+}
+
+func (s *credentialStore) Credential(ctx context.Context, username string) (*client.Credential, error) {
+	s.lock.Lock()
+	cached, ok := s.cache[username]
+	s.lock.Unlock()
+	if ok {
+		ret := *cached
+		return &ret, nil
+	}
+
+	cred, err := s.load(ctx, username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		cred, err = s.create(ctx, username)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cred.Applied {
+		s.lock.Lock()
+		s.cache[username] = cred
+		s.lock.Unlock()
+	}
+	ret := *cred
+	return &ret, nil
+}
+
+func (s *credentialStore) load(ctx context.Context, username string) (*client.Credential, error) {
+	dbcred := BackendCredential{}
+	if err := s.db.WithContext(ctx).Where("cluster = ? and username = ?", s.cluster, username).First(&dbcred).Error; err != nil {
+		return nil, err
+	}
+	password, err := s.decrypt(username, dbcred.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &client.Credential{Username: username, Password: password, Applied: dbcred.Applied}, nil
+}
+
+// create generates a random password for the account, the one created by a concurrent request wins
+func (s *credentialStore) create(ctx context.Context, username string) (*client.Credential, error) {
+	password, err := client.RandomPassword()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := s.encrypt(username, password)
+	if err != nil {
+		return nil, err
+	}
+	dbcred := &BackendCredential{Cluster: s.cluster, Username: username, Password: encrypted}
+	if err := s.db.WithContext(ctx).Create(dbcred).Error; err != nil {
+		if cred, loadErr := s.load(ctx, username); loadErr == nil {
+			return cred, nil
+		}
+		return nil, fmt.Errorf("save credential of %s failed, %w", username, err)
+	}
+	return &client.Credential{Username: username, Password: password}, nil
+}
+
+func (s *credentialStore) MarkApplied(ctx context.Context, username, password string) error {
+	dbcred := BackendCredential{}
+	if err := s.db.WithContext(ctx).Where("cluster = ? and username = ?", s.cluster, username).First(&dbcred).Error; err != nil {
+		return err
+	}
+	stored, err := s.decrypt(username, dbcred.Password)
+	if err != nil {
+		return err
+	}
+	if stored != password {
+		// rotated again since the password was read
+		return nil
+	}
+	// the password is compared again in case of a concurrent rotation
+	if err := s.db.WithContext(ctx).Model(&BackendCredential{}).
+		Where("id = ? and password = ?", dbcred.ID, dbcred.Password).
+		Update("applied", true).Error; err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.cache[username] = &client.Credential{Username: username, Password: password, Applied: true}
+	s.lock.Unlock()
+	return nil
+}
+
+// Rotate replaces the password of the account by a random one, it is not applied until MarkApplied
+func (s *credentialStore) Rotate(ctx context.Context, username string) (*client.Credential, error) {
+	password, err := client.RandomPassword()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := s.encrypt(username, password)
+	if err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	delete(s.cache, username)
+	s.lock.Unlock()
+	result := s.db.WithContext(ctx).Model(&BackendCredential{}).
+		Where("cluster = ? and username = ?", s.cluster, username).
+		Updates(map[string]interface{}{"password": encrypted, "applied": false})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if err := s.db.WithContext(ctx).Create(&BackendCredential{Cluster: s.cluster, Username: username, Password: encrypted}).Error; err != nil {
+			return nil, fmt.Errorf("save credential of %s failed, %w", username, err)
+		}
+	}
+	return &client.Credential{Username: username, Password: password}, nil
+}
+
+func (s *credentialStore) AddShadow(ctx context.Context, shadow client.Shadow) error {
+	encrypted, err := s.encrypt(shadow.Account.Username, shadow.Account.Password)
+	if err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Create(&BackendShadow{
+		Cluster:   s.cluster,
+		Username:  shadow.User,
+		Shadow:    shadow.Account.Username,
+		Password:  encrypted,
+		Role:      shadow.Role,
+		ExpiresAt: shadow.ExpiresAt,
+	}).Error
+}
+
+func (s *credentialStore) Shadows(ctx context.Context) ([]client.Shadow, error) {
+	dbshadows := []BackendShadow{}
+	if err := s.db.WithContext(ctx).Where("cluster = ?", s.cluster).Order("id").Find(&dbshadows).Error; err != nil {
+		return nil, err
+	}
+	ret := make([]client.Shadow, 0, len(dbshadows))
+	for _, dbshadow := range dbshadows {
+		password, err := s.decrypt(dbshadow.Shadow, dbshadow.Password)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, client.Shadow{
+			ID:        dbshadow.ID,
+			User:      dbshadow.Username,
+			Account:   client.Account{Username: dbshadow.Shadow, Password: password},
+			Role:      dbshadow.Role,
+			ExpiresAt: dbshadow.ExpiresAt,
+		})
+	}
+	return ret, nil
+}
+
+func (s *credentialStore) RemoveShadow(ctx context.Context, shadow client.Shadow) error {
+	return s.db.WithContext(ctx).Where("cluster = ? and id = ?", s.cluster, shadow.ID).Delete(&BackendShadow{}).Error
+}
+
+// credentialsOf returns the credential store of the cluster, passwords are derived from the usernames if there is no CredentialKey
+func (cs *ConfigService) credentialsOf(clusterName string) (client.CredentialStore, error) {
+	if len(cs.CredentialKey) == 0 {
+		return client.DerivedCredentials, nil
+	}
+	cs.credentialLock.Lock()
+	defer cs.credentialLock.Unlock()
+	if store, ok := cs.credentials[clusterName]; ok {
+		return store, nil
+	}
+	store, err := newCredentialStore(cs.db, clusterName, cs.CredentialKey)
+	if err != nil {
+		return nil, err
+	}
+	cs.credentials[clusterName] = store
+	return store, nil
+}
+
+// RotateAllAccounts rotates the accounts of every environment having configs in database, and of every application
+// if the project has application accounts, the old passwords keep valid for grace.
+// it migrates the passwords derived from the usernames to random ones after the CredentialKey is configured,
+// the environments failed are skipped and reported by the error
+func (cs *ConfigService) RotateAllAccounts(ctx context.Context, grace time.Duration) error {
+	if len(cs.CredentialKey) == 0 {
+		return client.InvalidArgumentError("passwords derived from usernames can not be rotated, a credential key is required")
+	}
+	rows := []ConfigItem{}
+	if err := cs.db.WithContext(ctx).Model(&ConfigItem{}).
+		Distinct("tenant", "project", "environment", "application").
+		Find(&rows).Error; err != nil {
+		return err
+	}
+	items := []*client.ConfigItem{}
+	seen := map[[4]string]bool{}
+	add := func(tenant, project, environment, application string) {
+		if id := [4]string{tenant, project, environment, application}; !seen[id] {
+			seen[id] = true
+			items = append(items, &client.ConfigItem{Tenant: tenant, Project: project, Environment: environment, Application: application})
+		}
+	}
+	getter, _ := cs.InfoGetter.(ApplicationAccountsGetter)
+	for _, row := range rows {
+		add(row.Tenant, row.Project, row.Environment, "")
+		if getter != nil && row.Application != "" && getter.ApplicationAccountsOf(row.Tenant, row.Project) {
+			add(row.Tenant, row.Project, row.Environment, row.Application)
+		}
+	}
+	return cs.rotateAccountsOf(ctx, items, grace)
+}
+
+func (cs *ConfigService) rotateAccountsOf(ctx context.Context, items []*client.ConfigItem, grace time.Duration) error {
+	failed := []string{}
+	var firstErr error
+	for _, item := range items {
+		err := func() error {
+			_, cli, err := cs.ClientOf(item)
+			if err != nil {
+				return err
+			}
+			rotator, ok := cli.(client.AccountRotator)
+			if !ok {
+				return client.InvalidArgumentError("accounts of the backend can not be rotated")
+			}
+			_, err = rotator.RotateAccounts(ctx, item, grace)
+			return err
+		}()
+		if err != nil {
+			failed = append(failed, strings.TrimSuffix(strings.Join([]string{item.Tenant, item.Project, item.Environment, item.Application}, "/"), "/"))
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if firstErr != nil {
+		return fmt.Errorf("rotate accounts of %s failed, %w", strings.Join(failed, ", "), firstErr)
+	}
+	return nil
+}
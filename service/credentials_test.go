@@ -0,0 +1,146 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"kubegems.io/configer/client"
+)
+
+func TestCredentialStore_Encrypt(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	store, err := newCredentialStore(nil, "cluster1", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := store.encrypt("user1", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := newCredentialStore(nil, "cluster2", key)
+	wrongKey, _ := newCredentialStore(nil, "cluster1", bytes.Repeat([]byte{2}, 32))
+	tests := []struct {
+		name     string
+		store    *credentialStore
+		username string
+		want     string
+		wantErr  bool
+	}{
+		{name: "decrypted", store: store, username: "user1", want: "secret"},
+		{name: "another user", store: store, username: "user2", wantErr: true},
+		{name: "another cluster", store: other, username: "user1", wantErr: true},
+		{name: "another key", store: wrongKey, username: "user1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.store.decrypt(tt.username, encrypted)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decrypt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("decrypt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// keyInfoGetter returns the credential key
+type keyInfoGetter struct {
+	testInfoGetter
+	key []byte
+	err error
+}
+
+func (k keyInfoGetter) CredentialKey() ([]byte, error) { return k.key, k.err }
+
+func TestCredentialKeyOf(t *testing.T) {
+	tests := []struct {
+		name       string
+		infoGetter InfoGetter
+		wantLen    int
+		wantErr    bool
+	}{
+		{name: "not implemented", infoGetter: testInfoGetter{}},
+		{name: "derived explicitly", infoGetter: keyInfoGetter{}},
+		{name: "valid", infoGetter: keyInfoGetter{key: bytes.Repeat([]byte{1}, 32)}, wantLen: 32},
+		{name: "short", infoGetter: keyInfoGetter{key: []byte("short")}, wantErr: true},
+		{name: "failed", infoGetter: keyInfoGetter{err: errors.New("no key")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := credentialKeyOf(tt.infoGetter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("credentialKeyOf() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(key) != tt.wantLen {
+				t.Errorf("credentialKeyOf() = %d bytes, want %d", len(key), tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestCredentialKeyFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantLen int
+		wantErr bool
+	}{
+		{name: "unset", value: ""},
+		{name: "valid", value: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)), wantLen: 32},
+		{name: "not base64", value: "%%%", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(CredentialKeyEnv, tt.value)
+			key, err := CredentialKeyFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CredentialKeyFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(key) != tt.wantLen {
+				t.Errorf("CredentialKeyFromEnv() = %d bytes, want %d", len(key), tt.wantLen)
+			}
+		})
+	}
+}
+
+// rotatingClient records the environments whose accounts are rotated, the ones of prod fail
+type rotatingClient struct {
+	*memoryClient
+	rotated []string
+}
+
+func (r *rotatingClient) RotateAccounts(ctx context.Context, item *client.ConfigItem, grace time.Duration) ([]client.RotatedAccount, error) {
+	if item.Environment == "prod" {
+		return nil, client.BackendUnavailableError("backend of %s unavailable", item.Environment)
+	}
+	r.rotated = append(r.rotated, item.Environment+"/"+item.Application)
+	return nil, nil
+}
+
+func TestConfigService_RotateAccountsOf(t *testing.T) {
+	cli := &rotatingClient{memoryClient: &memoryClient{}}
+	cs := newTestConfigService(t, testInfoGetter{}, cli)
+	items := []*client.ConfigItem{
+		{Tenant: "t1", Project: "p1", Environment: "dev"},
+		{Tenant: "t1", Project: "p1", Environment: "prod"},
+		{Tenant: "t1", Project: "p1", Environment: "test", Application: "app1"},
+	}
+	err := cs.rotateAccountsOf(context.Background(), items, time.Minute)
+	if !errors.Is(err, client.ErrBackendUnavailable) || !strings.Contains(err.Error(), "t1/p1/prod") {
+		t.Errorf("rotateAccountsOf() error = %v, want the failed environment", err)
+	}
+	if want := []string{"dev/", "test/app1"}; fmt.Sprint(cli.rotated) != fmt.Sprint(want) {
+		t.Errorf("rotated = %v, want %v", cli.rotated, want)
+	}
+
+	if err := cs.RotateAllAccounts(context.Background(), time.Minute); !errors.Is(err, client.ErrInvalidArgument) {
+		t.Errorf("RotateAllAccounts() without credential key error = %v, want InvalidArgument", err)
+	}
+}
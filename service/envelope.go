@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"kubegems.io/configer/client"
+)
+
+// encryptingClient encrypts the values of the items flagged encrypted by the data key of the environment before publishing,
+// and decrypts them after reading, so the backend and the database only keep the ciphertext.
+// after Pub the value of the item is the ciphertext, which is what the database should store.
+type encryptingClient struct {
+	client.ConfigClientIface
+	cs *ConfigService
+}
+
+var _ client.AccountRotator = &encryptingClient{}
+
+func (e *encryptingClient) Get(ctx context.Context, item *client.ConfigItem) error {
+	if err := e.ConfigClientIface.Get(ctx, item); err != nil {
+		return err
+	}
+	return e.decrypt(ctx, item)
+}
+
+func (e *encryptingClient) List(ctx context.Context, opts *client.ListOptions) ([]*client.ConfigItem, error) {
+	items, err := e.ConfigClientIface.List(ctx, opts)
+	if err != nil {
+		return items, err
+	}
+	for _, item := range items {
+		if err := e.decrypt(ctx, item); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+func (e *encryptingClient) Pub(ctx context.Context, item *client.ConfigItem) error {
+	encrypted := item.Encrypted
+	if encrypted == nil {
+		// keep the value encrypted if it is
+		current := *item
+		err := e.ConfigClientIface.Get(ctx, &current)
+		if err != nil && !errors.Is(err, client.ErrNotFound) {
+			return err
+		}
+		wasEncrypted := err == nil && client.IsEncryptedValue(current.Value)
+		encrypted = &wasEncrypted
+	}
+	item.Encrypted = encrypted
+	if !*encrypted {
+		if client.IsEncryptedValue(item.Value) {
+			return client.InvalidArgumentError("the value of %s looks encrypted but the config is not flagged encrypted", item.Key)
+		}
+		return e.ConfigClientIface.Pub(ctx, item)
+	}
+	dataKey, err := e.cs.dataKeyOf(ctx, item.Tenant, item.Project, item.Environment, true)
+	if err != nil {
+		return err
+	}
+	if client.IsEncryptedValue(item.Value) {
+		// published as is, such as restored ones, but it must be encrypted by the data key of the environment for the key
+		if _, err := client.DecryptValue(dataKey, item); err != nil {
+			return err
+		}
+		return e.ConfigClientIface.Pub(ctx, item)
+	}
+	if item.Value, err = client.EncryptValue(dataKey, item); err != nil {
+		return err
+	}
+	return e.ConfigClientIface.Pub(ctx, item)
+}
+
+func (e *encryptingClient) RotateAccounts(ctx context.Context, item *client.ConfigItem, grace time.Duration) ([]client.RotatedAccount, error) {
+	rotator, ok := e.ConfigClientIface.(client.AccountRotator)
+	if !ok {
+		return nil, client.InvalidArgumentError("accounts of the backend can not be rotated")
+	}
+	return rotator.RotateAccounts(ctx, item, grace)
+}
+
+// Unwrap returns the client reading and writing the values as stored
+func (e *encryptingClient) Unwrap() client.ConfigClientIface {
+	return e.ConfigClientIface
+}
+
+func (e *encryptingClient) decrypt(ctx context.Context, item *client.ConfigItem) error {
+	encrypted := client.IsEncryptedValue(item.Value)
+	item.Encrypted = &encrypted
+	if !encrypted {
+		return nil
+	}
+	dataKey, err := e.cs.dataKeyOf(ctx, item.Tenant, item.Project, item.Environment, false)
+	if err != nil {
+		return err
+	}
+	item.Value, err = client.DecryptValue(dataKey, item)
+	return err
+}
+
+// rawClient returns the client without decryption, backup and restore copy the ciphertext between backend and database
+func rawClient(cli client.ConfigClientIface) client.ConfigClientIface {
+	if e, ok := cli.(*encryptingClient); ok {
+		return e.Unwrap()
+	}
+	return cli
+}
+
+// DataKey returns the data key of the environment to the applications, which decrypt the values with it.
+// the body is the account of the environment, the key only decrypts the values of that environment.
+func (cs *ConfigService) DataKey(c *gin.Context) {
+	// the body is read before buildConfigItemFromReq, which consumes it
+	account := client.Account{}
+	if err := c.ShouldBindJSON(&account); err != nil {
+		NotOK(c, client.InvalidArgumentError("invalid account, %v", err))
+		return
+	}
+	item := buildConfigItemFromReq(c)
+	cs.withItem(c, item, func(ctx *gin.Context, cli client.ConfigClientIface) error {
+		c.Set("audit_subject", map[string]string{
+			"action": "获取",
+			"module": "数据密钥",
+			"name":   account.Username,
+		})
+		accounts, err := cli.Accounts(item)
+		if err != nil {
+			NotOK(ctx, err)
+			return err
+		}
+		if !hasAccount(accounts, account) {
+			err := client.UnauthorizedError("invalid account %s of environment %s", account.Username, item.Environment)
+			NotOK(ctx, err)
+			return err
+		}
+		dataKey, err := cs.dataKeyOf(c, item.Tenant, item.Project, item.Environment, false)
+		if err != nil {
+			NotOK(ctx, err)
+			return err
+		}
+		OK(ctx, client.DataKey{Key: base64.StdEncoding.EncodeToString(dataKey)})
+		return nil
+	})
+}
+
+func hasAccount(accounts []client.Account, account client.Account) bool {
+	if account.Username == "" {
+		return false
+	}
+	for _, a := range accounts {
+		if a.Username == account.Username && subtle.ConstantTimeCompare([]byte(a.Password), []byte(account.Password)) == 1 {
+			return true
+		}
+	}
+	return false
+}
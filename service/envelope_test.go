@@ -0,0 +1,74 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"kubegems.io/configer/client"
+)
+
+// accountsClient has the account app-<environment> with the password pw-<environment> in each environment
+type accountsClient struct {
+	*memoryClient
+}
+
+func (a accountsClient) Accounts(item *client.ConfigItem) ([]client.Account, error) {
+	return []client.Account{{Username: "app-" + item.Environment, Password: "pw-" + item.Environment}}, nil
+}
+
+func TestConfigService_DataKey(t *testing.T) {
+	cs := newTestConfigService(t, testInfoGetter{}, accountsClient{&memoryClient{}})
+	cs.KeyProvider = &FileKeyProvider{Dir: t.TempDir(), CurrentKeyID: DefaultKeyID}
+	dataKeys := map[string][]byte{
+		"dev":  bytes.Repeat([]byte("d"), client.DataKeySize),
+		"prod": bytes.Repeat([]byte("p"), client.DataKeySize),
+	}
+	for env, key := range dataKeys {
+		cs.dataKeys["t1/p1/"+env] = key
+	}
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/configer/tenant/:tenant/project/:project/environment/:environment/datakey", cs.DataKey)
+
+	tests := []struct {
+		name        string
+		environment string
+		body        string
+		wantCode    int
+	}{
+		{name: "account of the environment", environment: "dev", body: `{"username":"app-dev","password":"pw-dev"}`, wantCode: http.StatusOK},
+		{name: "account of another environment", environment: "prod", body: `{"username":"app-dev","password":"pw-dev"}`, wantCode: http.StatusForbidden},
+		{name: "account of prod", environment: "prod", body: `{"username":"app-prod","password":"pw-prod"}`, wantCode: http.StatusOK},
+		{name: "wrong password", environment: "dev", body: `{"username":"app-dev","password":"pw-prod"}`, wantCode: http.StatusForbidden},
+		{name: "empty account", environment: "dev", body: `{}`, wantCode: http.StatusForbidden},
+		{name: "invalid body", environment: "dev", body: `account`, wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/configer/tenant/t1/project/p1/environment/"+tt.environment+"/datakey", strings.NewReader(tt.body))
+			engine.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("DataKey() code = %d, want %d, body = %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			ret := struct {
+				Data client.DataKey `json:"data"`
+			}{}
+			if err := json.Unmarshal(w.Body.Bytes(), &ret); err != nil {
+				t.Fatal(err)
+			}
+			if want := base64.StdEncoding.EncodeToString(dataKeys[tt.environment]); ret.Data.Key != want {
+				t.Errorf("DataKey() = %s, want the key of %s", ret.Data.Key, tt.environment)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"gorm.io/gorm"
+	"kubegems.io/configer/client"
+)
+
+// codeOf returns the code of the typed error, records not found in database are NotFound too
+func codeOf(err error) client.ErrorCode {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return client.ErrorCodeNotFound
+	}
+	return client.CodeOf(err)
+}
+
+// httpStatusOf maps the typed error to the http status code, def is used for untyped errors
+func httpStatusOf(err error, def int) int {
+	switch codeOf(err) {
+	case client.ErrorCodeNotFound:
+		return http.StatusNotFound
+	case client.ErrorCodeConflict:
+		return http.StatusConflict
+	case client.ErrorCodeUnauthorized:
+		return http.StatusForbidden
+	case client.ErrorCodeBackendUnavailable:
+		return http.StatusServiceUnavailable
+	case client.ErrorCodeTimeout:
+		return http.StatusGatewayTimeout
+	case client.ErrorCodeInvalidArgument:
+		return http.StatusBadRequest
+	default:
+		return def
+	}
+}
+
+// grpcCodeOf maps the typed error to the grpc code, untyped errors are InvalidArgument the same as the http api
+func grpcCodeOf(err error) codes.Code {
+	switch codeOf(err) {
+	case client.ErrorCodeNotFound:
+		return codes.NotFound
+	case client.ErrorCodeConflict:
+		return codes.Aborted
+	case client.ErrorCodeUnauthorized:
+		return codes.PermissionDenied
+	case client.ErrorCodeBackendUnavailable:
+		return codes.Unavailable
+	case client.ErrorCodeTimeout:
+		return codes.DeadlineExceeded
+	default:
+		return codes.InvalidArgument
+	}
+}
+
+// errorBody is the error field of the response, it contains the stable code of the error
+func errorBody(err error) *client.Error {
+	return &client.Error{Code: codeOf(err), Message: err.Error()}
+}
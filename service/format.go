@@ -0,0 +1,128 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+配置项的值可能是结构化的配置文件, 根据 key 的后缀识别格式
+*/
+
+type ValueFormat string
+
+const (
+	FormatText       ValueFormat = "text"
+	FormatYAML       ValueFormat = "yaml"
+	FormatJSON       ValueFormat = "json"
+	FormatProperties ValueFormat = "properties"
+)
+
+func formatOf(key string) ValueFormat {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	case ".properties":
+		return FormatProperties
+	default:
+		return FormatText
+	}
+}
+
+// parseValue parses structured value into a nested map, properties are parsed as a flat map
+func parseValue(format ValueFormat, value string) (map[string]interface{}, error) {
+	ret := map[string]interface{}{}
+	switch format {
+	case FormatYAML:
+		if err := yaml.Unmarshal([]byte(value), &ret); err != nil {
+			return nil, err
+		}
+	case FormatJSON:
+		if err := json.Unmarshal([]byte(value), &ret); err != nil {
+			return nil, err
+		}
+	case FormatProperties:
+		for k, v := range parseProperties(value) {
+			ret[k] = v
+		}
+	default:
+		return nil, fmt.Errorf("value of format %s is not structured", format)
+	}
+	return ret, nil
+}
+
+func parseProperties(value string) map[string]string {
+	ret := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(value))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		idx := strings.IndexAny(line, "=:")
+		if idx < 0 {
+			ret[line] = ""
+			continue
+		}
+		ret[strings.TrimSpace(line[:idx])] = strings.TrimSpace(line[idx+1:])
+	}
+	return ret
+}
+
+// flatten converts nested map into spring style properties, eg: a.b[0].c
+func flatten(prefix string, data interface{}, ret map[string]interface{}) {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if prefix == "" {
+				flatten(k, v[k], ret)
+			} else {
+				flatten(prefix+"."+k, v[k], ret)
+			}
+		}
+	case []interface{}:
+		for idx, item := range v {
+			flatten(fmt.Sprintf("%s[%d]", prefix, idx), item, ret)
+		}
+	default:
+		ret[prefix] = v
+	}
+}
+
+// formatValue is the reverse of parseValue, the original layout and comments are not kept
+func formatValue(format ValueFormat, data map[string]interface{}) (string, error) {
+	switch format {
+	case FormatYAML:
+		out, err := yaml.Marshal(data)
+		return string(out), err
+	case FormatJSON:
+		out, err := json.MarshalIndent(data, "", "  ")
+		return string(out), err
+	case FormatProperties:
+		keys := make([]string, 0, len(data))
+		for k := range data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		sb := strings.Builder{}
+		for _, k := range keys {
+			fmt.Fprintf(&sb, "%s=%v\n", k, data[k])
+		}
+		return sb.String(), nil
+	default:
+		return "", fmt.Errorf("value of format %s is not structured", format)
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFormatOf(t *testing.T) {
+	tests := map[string]ValueFormat{
+		"app.yaml":         FormatYAML,
+		"app.YML":          FormatYAML,
+		"app.json":         FormatJSON,
+		"app.properties":   FormatProperties,
+		"app.conf":         FormatText,
+		"no-extension-key": FormatText,
+	}
+	for key, want := range tests {
+		if got := formatOf(key); got != want {
+			t.Errorf("formatOf(%s) = %s, want %s", key, got, want)
+		}
+	}
+}
+
+func TestParseValueAndFlatten(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  ValueFormat
+		value   string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name:   "yaml",
+			format: FormatYAML,
+			value:  "db:\n  host: mysql\n  port: 3306\nreplicas:\n- a\n- name: b\n",
+			want:   map[string]interface{}{"db.host": "mysql", "db.port": 3306, "replicas[0]": "a", "replicas[1].name": "b"},
+		},
+		{
+			name:   "json",
+			format: FormatJSON,
+			value:  `{"db": {"host": "mysql"}, "debug": true}`,
+			want:   map[string]interface{}{"db.host": "mysql", "debug": true},
+		},
+		{
+			name:   "properties",
+			format: FormatProperties,
+			value:  "# comment\n! comment\ndb.host = mysql\ndb.port:3306\nflag\n",
+			want:   map[string]interface{}{"db.host": "mysql", "db.port": "3306", "flag": ""},
+		},
+		{name: "invalid yaml", format: FormatYAML, value: "a: [", wantErr: true},
+		{name: "invalid json", format: FormatJSON, value: "{", wantErr: true},
+		{name: "text is not structured", format: FormatText, value: "a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := parseValue(tt.format, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := map[string]interface{}{}
+			flatten("", data, got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("flatten() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	data := map[string]interface{}{"db": map[string]interface{}{"host": "mysql"}, "debug": true}
+	for _, format := range []ValueFormat{FormatYAML, FormatJSON} {
+		value, err := formatValue(format, data)
+		if err != nil {
+			t.Fatalf("formatValue(%s) error = %v", format, err)
+		}
+		parsed, err := parseValue(format, value)
+		if err != nil || !reflect.DeepEqual(parsed, data) {
+			t.Errorf("formatValue(%s) = %q does not parse back, %v", format, value, err)
+		}
+	}
+	value, err := formatValue(FormatProperties, map[string]interface{}{"b": 1, "a": "x"})
+	if err != nil || value != "a=x\nb=1\n" {
+		t.Errorf("formatValue(properties) = %q, error = %v", value, err)
+	}
+	if _, err := formatValue(FormatText, data); err == nil {
+		t.Errorf("formatValue(text) should failed")
+	}
+}
@@ -0,0 +1,462 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"kubegems.io/configer/client"
+	configerv1 "kubegems.io/configer/proto/configer/v1"
+)
+
+const grpcWatchInterval = time.Second
+
+// GRPCHooks are the auth and audit hooks of the grpc api.
+// the handlers set the same audit data as the http api, so kubegems can audit both transports in the same way.
+type GRPCHooks struct {
+	// Authenticate returns the username of the bearer token from the "authorization" metadata, required
+	Authenticate func(ctx context.Context, token string) (username string, err error)
+	// Authorize returns an error if the user can not call the method on the environment of item, required.
+	// item only contains the tenant, project, environment, application and key of the request
+	Authorize func(ctx context.Context, username, method string, item *client.ConfigItem) error
+	// Audit is called after a call which set "audit_subject", data contains "audit_subject" and "audit_extra_datas"
+	Audit func(ctx context.Context, username, method string, data map[string]interface{}, err error)
+}
+
+// NewGRPCServer returns a grpc server serving the configer api with the auth and audit interceptors
+func (p *Plugin) NewGRPCServer(hooks GRPCHooks, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(hooks.unaryInterceptor),
+		grpc.ChainStreamInterceptor(hooks.streamInterceptor),
+	)
+	s := grpc.NewServer(opts...)
+	configerv1.RegisterConfigerServer(s, &GRPCServer{cs: p.Handler.ConfigService})
+	return s
+}
+
+type grpcUsernameKey struct{}
+
+type grpcAuditKey struct{}
+
+// grpcAudit collects the audit data of a grpc call like gin.Context does
+type grpcAudit struct {
+	lock sync.Mutex
+	data map[string]interface{}
+}
+
+func (a *grpcAudit) Set(key string, value interface{}) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.data[key] = value
+}
+
+func auditOf(ctx context.Context) auditSetter {
+	if a, ok := ctx.Value(grpcAuditKey{}).(*grpcAudit); ok {
+		return a
+	}
+	return &grpcAudit{data: map[string]interface{}{}}
+}
+
+func grpcUsername(ctx context.Context) string {
+	username, _ := ctx.Value(grpcUsernameKey{}).(string)
+	return username
+}
+
+func (h GRPCHooks) authenticate(ctx context.Context) (context.Context, *grpcAudit, error) {
+	if h.Authenticate == nil {
+		return nil, nil, status.Error(codes.Unauthenticated, "no authenticator configured")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	token := ""
+	if values := md.Get("authorization"); len(values) > 0 {
+		token = strings.TrimPrefix(values[0], "Bearer ")
+	}
+	username, err := h.Authenticate(ctx, token)
+	if err != nil {
+		return nil, nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	audit := &grpcAudit{data: map[string]interface{}{}}
+	ctx = context.WithValue(ctx, grpcUsernameKey{}, username)
+	ctx = context.WithValue(ctx, grpcAuditKey{}, audit)
+	return ctx, audit, nil
+}
+
+// authorize checks the request of the method, the requests without an environment are refused
+func (h GRPCHooks) authorize(ctx context.Context, method string, req interface{}) error {
+	if h.Authorize == nil {
+		return status.Error(codes.PermissionDenied, "no authorizer configured")
+	}
+	var item *client.ConfigItem
+	switch req := req.(type) {
+	case *configerv1.ListRequest:
+		item = &client.ConfigItem{Tenant: req.Tenant, Project: req.Project, Environment: req.Environment, Application: req.Application}
+	case *configerv1.EnvironmentRequest:
+		item = itemOfEnvironment(req)
+	case *configerv1.KeyRequest:
+		item = itemOfKey(req)
+	case *configerv1.ConfigItem:
+		item = &client.ConfigItem{Tenant: req.Tenant, Project: req.Project, Environment: req.Environment, Application: req.Application, Key: req.Key}
+	default:
+		return status.Errorf(codes.PermissionDenied, "unknown request %T of %s", req, method)
+	}
+	if err := h.Authorize(ctx, grpcUsername(ctx), method, item); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
+
+func (h GRPCHooks) audit(ctx context.Context, method string, audit *grpcAudit, err error) {
+	if h.Audit == nil {
+		return
+	}
+	audit.lock.Lock()
+	defer audit.lock.Unlock()
+	if _, ok := audit.data["audit_subject"]; !ok {
+		return
+	}
+	h.Audit(ctx, grpcUsername(ctx), method, audit.data, err)
+}
+
+func (h GRPCHooks) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, audit, err := h.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.authorize(ctx, info.FullMethod, req); err != nil {
+		return nil, err
+	}
+	resp, err := handler(ctx, req)
+	h.audit(ctx, info.FullMethod, audit, err)
+	return resp, err
+}
+
+func (h GRPCHooks) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, audit, err := h.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	err = handler(srv, &contextStream{ServerStream: ss, ctx: ctx, authorize: func(req interface{}) error {
+		return h.authorize(ctx, info.FullMethod, req)
+	}})
+	h.audit(ctx, info.FullMethod, audit, err)
+	return err
+}
+
+// contextStream carries the context of the authenticated user, and authorizes the requests received
+type contextStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	authorize func(req interface{}) error
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *contextStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.authorize(m)
+}
+
+// GRPCServer implements configerv1.ConfigerServer on top of ConfigService
+type GRPCServer struct {
+	configerv1.UnimplementedConfigerServer
+	cs *ConfigService
+}
+
+func grpcError(err error) error {
+	// the same as NotOK of the http api
+	return status.Error(grpcCodeOf(err), err.Error())
+}
+
+// clientOf returns the client of the item and sets the audit data
+func (s *GRPCServer) clientOf(ctx context.Context, item *client.ConfigItem) (client.ConfigClientIface, error) {
+	clusterName, cli, err := s.cs.ClientOf(item)
+	s.cs.setAuditData(auditOf(ctx), clusterName, item.Tenant, item.Project, item.Environment, item.Application)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return cli, nil
+}
+
+func (s *GRPCServer) List(ctx context.Context, req *configerv1.ListRequest) (*configerv1.ListResponse, error) {
+	item := &client.ConfigItem{Tenant: req.Tenant, Project: req.Project, Environment: req.Environment, Application: req.Application}
+	cli, err := s.clientOf(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	page, size := int(req.Page), int(req.Size)
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 {
+		size = 10
+	}
+	items, err := cli.List(ctx, &client.ListOptions{ConfigItem: *item, Page: page, Size: size})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	FillDates(item, items, s.cs.db)
+	// sensitive values are revealed by the http api only
+	s.cs.mask(items...)
+	ret := &configerv1.ListResponse{}
+	for _, it := range items {
+		ret.Items = append(ret.Items, toProtoItem(it))
+	}
+	return ret, nil
+}
+
+func (s *GRPCServer) BaseInfo(ctx context.Context, req *configerv1.EnvironmentRequest) (*configerv1.BaseInfoResponse, error) {
+	item := itemOfEnvironment(req)
+	cli, err := s.clientOf(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	info, err := cli.BaseInfo(ctx, item)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &configerv1.BaseInfoResponse{Info: info}, nil
+}
+
+func (s *GRPCServer) Accounts(ctx context.Context, req *configerv1.EnvironmentRequest) (*configerv1.AccountsResponse, error) {
+	item := itemOfEnvironment(req)
+	cli, err := s.clientOf(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := cli.Accounts(item)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	ret := &configerv1.AccountsResponse{}
+	for _, account := range accounts {
+		ret.Accounts = append(ret.Accounts, &configerv1.Account{Username: account.Username, Password: account.Password})
+	}
+	return ret, nil
+}
+
+func (s *GRPCServer) Get(ctx context.Context, req *configerv1.KeyRequest) (*configerv1.ConfigItem, error) {
+	item := itemOfKey(req)
+	cli, err := s.clientOf(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	if err := cli.Get(ctx, item); err != nil {
+		return nil, grpcError(err)
+	}
+	if err := fillSensitive(item, s.cs.db); err != nil {
+		return nil, grpcError(err)
+	}
+	s.cs.mask(item)
+	return toProtoItem(item), nil
+}
+
+func (s *GRPCServer) Pub(ctx context.Context, req *configerv1.ConfigItem) (*configerv1.ConfigItem, error) {
+	item := &client.ConfigItem{
+		Tenant:      req.Tenant,
+		Project:     req.Project,
+		Environment: req.Environment,
+		Application: req.Application,
+		Key:         req.Key,
+		Value:       req.Value,
+		Sensitive:   req.Sensitive,
+		Encrypted:   req.Encrypted,
+	}
+	cli, err := s.clientOf(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	auditOf(ctx).Set("audit_subject", map[string]string{
+		"action": "发布",
+		"module": "配置项",
+		"name":   item.Key,
+	})
+	item.LastUpdateUser = grpcUsername(ctx)
+	if err := s.cs.checkNotMasked(item); err != nil {
+		return nil, grpcError(err)
+	}
+	value := item.Value
+	if err := cli.Pub(ctx, item); err != nil {
+		return nil, grpcError(err)
+	}
+	if err := UpsertConfigItem(item, s.cs.db, item.LastUpdateUser); err != nil {
+		return nil, grpcError(err)
+	}
+	item.Value = value
+	s.cs.mask(item)
+	return toProtoItem(item), nil
+}
+
+func (s *GRPCServer) Delete(ctx context.Context, req *configerv1.KeyRequest) (*configerv1.ConfigItem, error) {
+	item := itemOfKey(req)
+	cli, err := s.clientOf(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	auditOf(ctx).Set("audit_subject", map[string]string{
+		"action": "删除",
+		"module": "配置项",
+		"name":   item.Key,
+	})
+	item.LastUpdateUser = grpcUsername(ctx)
+	if err := cli.Delete(ctx, item); err != nil {
+		return nil, grpcError(err)
+	}
+	if err := DeleteConfigItem(item, s.cs.db); err != nil {
+		return nil, grpcError(err)
+	}
+	return toProtoItem(item), nil
+}
+
+func (s *GRPCServer) History(ctx context.Context, req *configerv1.KeyRequest) (*configerv1.HistoryResponse, error) {
+	item := itemOfKey(req)
+	cli, err := s.clientOf(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := cli.History(ctx, item)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	ret := &configerv1.HistoryResponse{}
+	for _, v := range versions {
+		ret.Versions = append(ret.Versions, &configerv1.HistoryVersion{Rev: v.Rev, Version: v.Version, LastUpdateTime: v.LastUpdateTime})
+	}
+	return ret, nil
+}
+
+func (s *GRPCServer) Listener(ctx context.Context, req *configerv1.KeyRequest) (*configerv1.ListenerResponse, error) {
+	item := itemOfKey(req)
+	cli, err := s.clientOf(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	listeners, err := cli.Listener(ctx, item)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &configerv1.ListenerResponse{Listeners: listeners}, nil
+}
+
+func (s *GRPCServer) Backup(ctx context.Context, req *configerv1.EnvironmentRequest) (*configerv1.EnvironmentRequest, error) {
+	item := itemOfEnvironment(req)
+	cli, err := s.clientOf(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	auditOf(ctx).Set("audit_subject", map[string]string{
+		"action": "备份",
+		"module": "环境下的配置项",
+		"name":   item.Environment,
+	})
+	items, err := rawClient(cli).List(ctx, &client.ListOptions{ConfigItem: *item, Page: 1, Size: 1000})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if err := SyncBackend2Database(item, items, s.cs.db); err != nil {
+		return nil, grpcError(err)
+	}
+	return req, nil
+}
+
+func (s *GRPCServer) Restore(ctx context.Context, req *configerv1.EnvironmentRequest) (*configerv1.EnvironmentRequest, error) {
+	item := itemOfEnvironment(req)
+	cli, err := s.clientOf(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	auditOf(ctx).Set("audit_subject", map[string]string{
+		"action": "恢复",
+		"module": "环境下的配置项",
+		"name":   item.Environment,
+	})
+	if err := SyncDatabase2Backend(item, s.cs.db, rawClient(cli)); err != nil {
+		return nil, grpcError(err)
+	}
+	return req, nil
+}
+
+// Watch polls the backend, since not every backend supports watching
+func (s *GRPCServer) Watch(req *configerv1.KeyRequest, stream configerv1.Configer_WatchServer) error {
+	ctx := stream.Context()
+	item := itemOfKey(req)
+	cli, err := s.clientOf(ctx, item)
+	if err != nil {
+		return err
+	}
+	if err := cli.Get(ctx, item); err != nil {
+		return grpcError(err)
+	}
+	last := item.Value
+	if err := s.sendMasked(stream, item); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(grpcWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			latest := itemOfKey(req)
+			// ignore errors while polling, the backend may be restarting
+			if err := cli.Get(ctx, latest); err != nil || latest.Value == last {
+				continue
+			}
+			// the changes are compared by the values, the masked value does not change
+			last = latest.Value
+			if err := s.sendMasked(stream, latest); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sendMasked sends the item with the sensitive value masked, sensitive values are revealed by the http api only
+func (s *GRPCServer) sendMasked(stream configerv1.Configer_WatchServer, item *client.ConfigItem) error {
+	if err := fillSensitive(item, s.cs.db); err != nil {
+		return grpcError(err)
+	}
+	s.cs.mask(item)
+	return stream.Send(toProtoItem(item))
+}
+
+func itemOfEnvironment(req *configerv1.EnvironmentRequest) *client.ConfigItem {
+	return &client.ConfigItem{Tenant: req.Tenant, Project: req.Project, Environment: req.Environment, Application: req.Application}
+}
+
+func itemOfKey(req *configerv1.KeyRequest) *client.ConfigItem {
+	return &client.ConfigItem{
+		Tenant:      req.Tenant,
+		Project:     req.Project,
+		Environment: req.Environment,
+		Application: req.Application,
+		Key:         req.Key,
+		Rev:         req.Rev,
+	}
+}
+
+func toProtoItem(item *client.ConfigItem) *configerv1.ConfigItem {
+	return &configerv1.ConfigItem{
+		Tenant:           item.Tenant,
+		Project:          item.Project,
+		Application:      item.Application,
+		Environment:      item.Environment,
+		Key:              item.Key,
+		Value:            item.Value,
+		Rev:              item.Rev,
+		CreatedTime:      item.CreatedTime,
+		LastModifiedTime: item.LastModifiedTime,
+		LastUpdateUser:   item.LastUpdateUser,
+		Sensitive:        item.Sensitive,
+		Encrypted:        item.Encrypted,
+	}
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"kubegems.io/configer/client"
+	configerv1 "kubegems.io/configer/proto/configer/v1"
+)
+
+// testGRPCHooks accepts the token "token" of admin, and refuses the environment prod
+func testGRPCHooks(audits *[]string) GRPCHooks {
+	return GRPCHooks{
+		Authenticate: func(ctx context.Context, token string) (string, error) {
+			if token != "token" {
+				return "", fmt.Errorf("invalid token")
+			}
+			return "admin", nil
+		},
+		Authorize: func(ctx context.Context, username, method string, item *client.ConfigItem) error {
+			if item.Environment == "prod" {
+				return client.UnauthorizedError("%s can not access environment %s", username, item.Environment)
+			}
+			return nil
+		},
+		Audit: func(ctx context.Context, username, method string, data map[string]interface{}, err error) {
+			*audits = append(*audits, fmt.Sprintf("%s %s %v", username, method, data["audit_subject"]))
+		},
+	}
+}
+
+func newTestGRPCClient(t *testing.T, cs *ConfigService, hooks GRPCHooks) configerv1.ConfigerClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s := (&Plugin{Handler: ConfigerHandler{ConfigService: cs}}).NewGRPCServer(hooks)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return configerv1.NewConfigerClient(conn)
+}
+
+func TestGRPCHooks_Interceptors(t *testing.T) {
+	tests := []struct {
+		name        string
+		token       string
+		environment string
+		noAuthorize bool
+		wantCode    codes.Code
+	}{
+		{name: "test authorized", token: "token", environment: "dev", wantCode: codes.OK},
+		{name: "test invalid token", token: "invalid", environment: "dev", wantCode: codes.Unauthenticated},
+		{name: "test environment not authorized", token: "token", environment: "prod", wantCode: codes.PermissionDenied},
+		{name: "test no authorizer", token: "token", environment: "dev", noAuthorize: true, wantCode: codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audits := []string{}
+			hooks := testGRPCHooks(&audits)
+			if tt.noAuthorize {
+				hooks.Authorize = nil
+			}
+			cs := newTestConfigService(t, testInfoGetter{}, &memoryClient{values: map[string]string{"a": "1"}})
+			cli := newTestGRPCClient(t, cs, hooks)
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+tt.token)
+			req := &configerv1.KeyRequest{Tenant: "t1", Project: "p1", Environment: tt.environment, Key: "a"}
+
+			_, err := cli.Get(ctx, req)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Errorf("Get() code = %v, want %v, error = %v", code, tt.wantCode, err)
+			}
+			stream, err := cli.Watch(ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = stream.Recv()
+			if code := status.Code(err); code != tt.wantCode {
+				t.Errorf("Watch() code = %v, want %v, error = %v", code, tt.wantCode, err)
+			}
+			_, err = cli.Delete(ctx, req)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Errorf("Delete() code = %v, want %v, error = %v", code, tt.wantCode, err)
+			}
+			if wantAudits := map[bool]int{true: 1, false: 0}[tt.wantCode == codes.OK]; len(audits) != wantAudits {
+				t.Errorf("audits = %v, want %d", audits, wantAudits)
+			}
+		})
+	}
+}
+
+func TestGRPCServer_Handlers(t *testing.T) {
+	audits := []string{}
+	backend := &memoryClient{values: map[string]string{"a": "1", "db.password": "secret"}}
+	cs := newTestConfigService(t, testInfoGetter{}, backend)
+	cs.SensitivePatterns = []string{"*password*"}
+	cli := newTestGRPCClient(t, cs, testGRPCHooks(&audits))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer token")
+	keyRequest := func(key string) *configerv1.KeyRequest {
+		return &configerv1.KeyRequest{Tenant: "t1", Project: "p1", Environment: "dev", Key: key}
+	}
+
+	got, err := cli.Get(ctx, keyRequest("db.password"))
+	if err != nil || got.Value != MaskedValue || !got.GetSensitive() {
+		t.Errorf("Get() sensitive = %v, error = %v, want masked", got, err)
+	}
+	list, err := cli.List(ctx, &configerv1.ListRequest{Tenant: "t1", Project: "p1", Environment: "dev"})
+	if err != nil || len(list.Items) != 2 {
+		t.Fatalf("List() = %v, error = %v", list, err)
+	}
+	for _, it := range list.Items {
+		if it.GetSensitive() != (it.Value == MaskedValue) {
+			t.Errorf("List() item %s = %s, sensitive %v", it.Key, it.Value, it.GetSensitive())
+		}
+	}
+
+	if _, err := cli.Pub(ctx, &configerv1.ConfigItem{Tenant: "t1", Project: "p1", Environment: "dev", Key: "db.password", Value: MaskedValue}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Pub() masked value error = %v, want InvalidArgument", err)
+	}
+	pub, err := cli.Pub(ctx, &configerv1.ConfigItem{Tenant: "t1", Project: "p1", Environment: "dev", Key: "b", Value: "2"})
+	if err != nil || pub.Value != "2" || pub.LastUpdateUser != "admin" {
+		t.Errorf("Pub() = %v, error = %v", pub, err)
+	}
+	if backend.values["b"] != "2" {
+		t.Errorf("Pub() backend value = %s", backend.values["b"])
+	}
+
+	stream, err := cli.Watch(ctx, keyRequest("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first, err := stream.Recv(); err != nil || first.Value != "1" {
+		t.Errorf("Watch() first = %v, error = %v", first, err)
+	}
+	sensitive, err := cli.Watch(ctx, keyRequest("db.password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first, err := sensitive.Recv(); err != nil || first.Value != MaskedValue {
+		t.Errorf("Watch() sensitive = %v, error = %v, want masked", first, err)
+	}
+
+	if _, err := cli.Delete(ctx, keyRequest("b")); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if _, ok := backend.values["b"]; ok {
+		t.Errorf("Delete() should delete the key from the backend")
+	}
+	want := []string{
+		"admin /configer.v1.Configer/Pub map[action:发布 module:配置项 name:db.password]",
+		"admin /configer.v1.Configer/Pub map[action:发布 module:配置项 name:b]",
+		"admin /configer.v1.Configer/Delete map[action:删除 module:配置项 name:b]",
+	}
+	if fmt.Sprint(audits) != fmt.Sprint(want) {
+		t.Errorf("audits = %v, want %v", audits, want)
+	}
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gorm.io/gorm"
+	"kubegems.io/configer/client"
+)
+
+const (
+	// KeyDirEnv is the env of the directory of the master keys of FileKeyProvider, encryption is disabled if not set
+	KeyDirEnv = "CONFIGER_KEY_DIR"
+	// KeyIDEnv is the env of the master key to wrap new data keys, DefaultKeyID if not set
+	KeyIDEnv     = "CONFIGER_KEY_ID"
+	DefaultKeyID = "default"
+)
+
+// KeyProvider wraps the data keys of the environments by master keys, such as a KMS
+type KeyProvider interface {
+	// WrapKey encrypts the data key by the current master key, keyID identifies the master key
+	WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+	// UnwrapKey decrypts the data key wrapped by the master key keyID
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// FileKeyProvider keeps the master keys in files of Dir, the file name is the key id
+// and the content is a base64 encoded 32 bytes key. old keys are kept to unwrap the data keys they wrapped.
+type FileKeyProvider struct {
+	Dir string
+	// CurrentKeyID is the master key to wrap new data keys
+	CurrentKeyID string
+}
+
+func (p *FileKeyProvider) aead(keyID string) (cipher.AEAD, error) {
+	if keyID == "" || strings.ContainsAny(keyID, `/\`) || keyID == "." || keyID == ".." {
+		return nil, fmt.Errorf("invalid master key id %q", keyID)
+	}
+	content, err := os.ReadFile(filepath.Join(p.Dir, keyID))
+	if err != nil {
+		return nil, fmt.Errorf("read master key %s failed, %w", keyID, err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("master key %s must be a base64 encoded 32 bytes key", keyID)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (p *FileKeyProvider) WrapKey(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	aead, err := p.aead(p.CurrentKeyID)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return p.CurrentKeyID, aead.Seal(nonce, nonce, dataKey, []byte(p.CurrentKeyID)), nil
+}
+
+func (p *FileKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, err := p.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid wrapped data key")
+	}
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(keyID))
+}
+
+// keyProviderFromEnv returns nil if KeyDirEnv is not set
+func keyProviderFromEnv() KeyProvider {
+	dir := os.Getenv(KeyDirEnv)
+	if dir == "" {
+		return nil
+	}
+	keyID := os.Getenv(KeyIDEnv)
+	if keyID == "" {
+		keyID = DefaultKeyID
+	}
+	return &FileKeyProvider{Dir: dir, CurrentKeyID: keyID}
+}
+
+// dataKeyOf returns the data key of the environment, it is generated if create is true and the environment has none
+func (cs *ConfigService) dataKeyOf(ctx context.Context, tenant, project, environment string, create bool) ([]byte, error) {
+	if cs.KeyProvider == nil {
+		return nil, client.InvalidArgumentError("encryption is not enabled, %s is not set", KeyDirEnv)
+	}
+	cacheKey := tenant + "/" + project + "/" + environment
+	cs.dataKeyLock.Lock()
+	key, ok := cs.dataKeys[cacheKey]
+	cs.dataKeyLock.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	key, err := cs.loadDataKey(ctx, tenant, project, environment)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if !create {
+			return nil, client.NotFoundError("environment %s/%s/%s has no data key", tenant, project, environment)
+		}
+		key, err = cs.createDataKey(ctx, tenant, project, environment)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cs.dataKeyLock.Lock()
+	cs.dataKeys[cacheKey] = key
+	cs.dataKeyLock.Unlock()
+	return key, nil
+}
+
+func (cs *ConfigService) loadDataKey(ctx context.Context, tenant, project, environment string) ([]byte, error) {
+	dbkey := ProjectDataKey{}
+	if err := cs.db.WithContext(ctx).Where("tenant = ? and project = ? and environment = ?", tenant, project, environment).First(&dbkey).Error; err != nil {
+		return nil, err
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(dbkey.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key of environment %s/%s/%s", tenant, project, environment)
+	}
+	key, err := cs.KeyProvider.UnwrapKey(ctx, dbkey.KeyID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key of environment %s/%s/%s failed, %w", tenant, project, environment, err)
+	}
+	return key, nil
+}
+
+// createDataKey generates the data key of the environment, the one created by a concurrent request wins
+func (cs *ConfigService) createDataKey(ctx context.Context, tenant, project, environment string) ([]byte, error) {
+	key := make([]byte, client.DataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	keyID, wrapped, err := cs.KeyProvider.WrapKey(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("wrap data key of environment %s/%s/%s failed, %w", tenant, project, environment, err)
+	}
+	dbkey := &ProjectDataKey{
+		Tenant:      tenant,
+		Project:     project,
+		Environment: environment,
+		KeyID:       keyID,
+		WrappedKey:  base64.StdEncoding.EncodeToString(wrapped),
+	}
+	if err := cs.db.WithContext(ctx).Create(dbkey).Error; err != nil {
+		if existing, loadErr := cs.loadDataKey(ctx, tenant, project, environment); loadErr == nil {
+			return existing, nil
+		}
+		return nil, fmt.Errorf("save data key of environment %s/%s/%s failed, %w", tenant, project, environment, err)
+	}
+	return key, nil
+}
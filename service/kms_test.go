@@ -0,0 +1,53 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileKeyProvider(t *testing.T) {
+	dir := t.TempDir()
+	for id, key := range map[string]string{"k1": "0123456789abcdef0123456789abcdef", "k2": "abcdef0123456789abcdef0123456789", "short": "short"} {
+		if err := os.WriteFile(filepath.Join(dir, id), []byte(base64.StdEncoding.EncodeToString([]byte(key))+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dataKey := []byte("data key of the project 32 bytes")
+	wrapped := map[string][]byte{}
+	for _, id := range []string{"k1", "k2"} {
+		keyID, w, err := (&FileKeyProvider{Dir: dir, CurrentKeyID: id}).WrapKey(context.Background(), dataKey)
+		if err != nil || keyID != id {
+			t.Fatalf("WrapKey() = %s, error = %v", keyID, err)
+		}
+		wrapped[id] = w
+	}
+	tests := []struct {
+		name    string
+		keyID   string
+		wrapped []byte
+		wantErr bool
+	}{
+		{name: "current key", keyID: "k2", wrapped: wrapped["k2"]},
+		{name: "old key", keyID: "k1", wrapped: wrapped["k1"]},
+		{name: "wrong key", keyID: "k2", wrapped: wrapped["k1"], wantErr: true},
+		{name: "missing key", keyID: "k3", wrapped: wrapped["k1"], wantErr: true},
+		{name: "invalid key", keyID: "short", wrapped: wrapped["k1"], wantErr: true},
+		{name: "path key id", keyID: "../k1", wrapped: wrapped["k1"], wantErr: true},
+	}
+	provider := &FileKeyProvider{Dir: dir, CurrentKeyID: "k2"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := provider.UnwrapKey(context.Background(), tt.keyID, tt.wrapped)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnwrapKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, dataKey) {
+				t.Errorf("UnwrapKey() = %s, want %s", got, dataKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"kubegems.io/configer/client"
+)
+
+/*
+项目下有一个 base 层, 保存在数据库中, 其中的配置项被所有环境继承:
+	环境中不存在的 key 继承 base 中的值
+	环境和 base 中都存在的 key, yaml/json/properties 按字段深度合并, 环境中的字段优先, 列表整体覆盖; 其他格式环境中的值整体覆盖
+Get 和 List 默认返回环境中的原始值, view=effective 时返回合并后的值, 以及每个字段来自哪一层
+*/
+
+const (
+	ViewRaw       = "raw"
+	ViewEffective = "effective"
+
+	LayerBase        = "base"
+	LayerEnvironment = "environment"
+)
+
+// effectiveView reports whether the effective view is requested by the view query
+func effectiveView(c *gin.Context) (bool, error) {
+	switch view := c.Query("view"); view {
+	case "", ViewRaw:
+		return false, nil
+	case ViewEffective:
+		return true, nil
+	default:
+		return false, client.InvalidArgumentError("invalid view %q, should be %s or %s", view, ViewRaw, ViewEffective)
+	}
+}
+
+// mergeLayers returns the effective value of the key and the layer of each field,
+// the field is empty if the value is not structured or either layer can not be parsed
+func mergeLayers(key string, base, env *string) (string, map[string]string) {
+	if base == nil || env == nil {
+		value, layer := "", LayerEnvironment
+		if env != nil {
+			value = *env
+		} else if base != nil {
+			value, layer = *base, LayerBase
+		}
+		return value, provenanceOf(key, value, layer)
+	}
+	format := formatOf(key)
+	baseData, berr := parseValue(format, *base)
+	envData, eerr := parseValue(format, *env)
+	if berr != nil || eerr != nil {
+		return *env, map[string]string{"": LayerEnvironment}
+	}
+	merged, err := formatValue(format, deepMerge(baseData, envData))
+	if err != nil {
+		return *env, map[string]string{"": LayerEnvironment}
+	}
+	envFields := map[string]interface{}{}
+	flatten("", envData, envFields)
+	provenance := provenanceOf(key, merged, LayerBase)
+	for field := range provenance {
+		if _, ok := envFields[field]; ok {
+			provenance[field] = LayerEnvironment
+		}
+	}
+	return merged, provenance
+}
+
+func provenanceOf(key, value, layer string) map[string]string {
+	data, err := parseValue(formatOf(key), value)
+	if err != nil {
+		return map[string]string{"": layer}
+	}
+	fields := map[string]interface{}{}
+	flatten("", data, fields)
+	ret := map[string]string{}
+	for field := range fields {
+		ret[field] = layer
+	}
+	return ret
+}
+
+// deepMerge merges the maps recursively, the values of override win and lists are replaced
+func deepMerge(base, override map[string]interface{}) map[string]interface{} {
+	ret := map[string]interface{}{}
+	for k, v := range base {
+		ret[k] = v
+	}
+	for k, v := range override {
+		bv, bok := ret[k].(map[string]interface{})
+		ov, ook := v.(map[string]interface{})
+		if bok && ook {
+			ret[k] = deepMerge(bv, ov)
+		} else {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// getEffective gets the effective value of item, the key may only exist in the base layer
+func (cs *ConfigService) getEffective(ctx context.Context, cli client.ConfigClientIface, item *client.ConfigItem) error {
+	base := BaseConfigItem{}
+	baseResult := cs.db.WithContext(ctx).Limit(1).Find(&base, BaseConfigItem{Tenant: item.Tenant, Project: item.Project, Key: item.Key})
+	if baseResult.Error != nil {
+		return baseResult.Error
+	}
+	var baseValue, envValue *string
+	if baseResult.RowsAffected > 0 && baseOfApplication(&base, item.Application) {
+		baseValue = &base.Value
+	}
+	err := cli.Get(ctx, item)
+	switch {
+	case err == nil:
+		if err := fillSensitive(item, cs.db); err != nil {
+			return err
+		}
+		envValue = &item.Value
+	case errors.Is(err, client.ErrNotFound) && baseValue != nil:
+		inherited := base.ToClientConfigItem()
+		inherited.Environment = item.Environment
+		*item = *inherited
+	default:
+		return err
+	}
+	item.Value, item.Provenance = mergeLayers(item.Key, baseValue, envValue)
+	if baseValue != nil && base.Sensitive {
+		item.Sensitive = &base.Sensitive
+	}
+	return nil
+}
+
+// baseOfApplication reports whether the base item is inherited by the items of the application,
+// all the base items are inherited if the application is empty
+func baseOfApplication(base *BaseConfigItem, application string) bool {
+	return application == "" || base.Application == "" || base.Application == application
+}
+
+// listEffective lists the effective items of the environment, including the ones only in the base layer, sorted by key
+func (cs *ConfigService) listEffective(ctx context.Context, cli client.ConfigClientIface, item *client.ConfigItem, page, size int) ([]*client.ConfigItem, error) {
+	items, err := client.ListAll(ctx, cli, item)
+	if err != nil {
+		return nil, err
+	}
+	FillDates(item, items, cs.db)
+	bases := []BaseConfigItem{}
+	if err := cs.db.WithContext(ctx).Find(&bases, BaseConfigItem{Tenant: item.Tenant, Project: item.Project}).Error; err != nil {
+		return nil, err
+	}
+	baseOf := map[string]*BaseConfigItem{}
+	for i := range bases {
+		if baseOfApplication(&bases[i], item.Application) {
+			baseOf[bases[i].Key] = &bases[i]
+		}
+	}
+	for _, it := range items {
+		var baseValue *string
+		if base, ok := baseOf[it.Key]; ok {
+			baseValue = &base.Value
+			if base.Sensitive {
+				it.Sensitive = &base.Sensitive
+			}
+			delete(baseOf, it.Key)
+		}
+		it.Value, it.Provenance = mergeLayers(it.Key, baseValue, &it.Value)
+	}
+	for _, base := range baseOf {
+		inherited := base.ToClientConfigItem()
+		inherited.Environment = item.Environment
+		inherited.Provenance = provenanceOf(inherited.Key, inherited.Value, LayerBase)
+		items = append(items, inherited)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+
+	start, end := (page-1)*size, page*size
+	if start > len(items) || start < 0 {
+		start = len(items)
+	}
+	if end > len(items) || end < 0 {
+		end = len(items)
+	}
+	return items[start:end], nil
+}
+
+// ListBase lists the config items of the base layer of the project
+func (cs *ConfigService) ListBase(c *gin.Context) {
+	bases := []BaseConfigItem{}
+	if err := cs.db.Order("`key`").Find(&bases, BaseConfigItem{Tenant: c.Param("tenant"), Project: c.Param("project")}).Error; err != nil {
+		NotOK(c, err)
+		return
+	}
+	ret := make([]*client.ConfigItem, 0, len(bases))
+	for i := range bases {
+		ret = append(ret, bases[i].ToClientConfigItem())
+	}
+	cs.mask(ret...)
+	OK(c, ret)
+}
+
+// GetBase gets a config item of the base layer
+func (cs *ConfigService) GetBase(c *gin.Context) {
+	base := BaseConfigItem{}
+	if err := cs.db.First(&base, BaseConfigItem{Tenant: c.Param("tenant"), Project: c.Param("project"), Key: c.Param("key")}).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = client.NotFoundError("base config %s not found", c.Param("key"))
+		}
+		NotOK(c, err)
+		return
+	}
+	item := base.ToClientConfigItem()
+	cs.mask(item)
+	OK(c, item)
+}
+
+// PubBase publishes a config item of the base layer, the sensitive flag is kept unchanged if not set.
+// base items can not be encrypted as the data keys are per environment.
+func (cs *ConfigService) PubBase(c *gin.Context) {
+	item := buildConfigItemFromReq(c)
+	item.Environment = ""
+	cs.setAuditData(c, "", item.Tenant, item.Project, "", item.Application)
+	c.Set("audit_subject", map[string]string{
+		"action": "发布",
+		"module": "基础配置项",
+		"name":   item.Key,
+	})
+	if item.Encrypted != nil && *item.Encrypted {
+		// the base layer is shared by the environments, but data keys are per environment
+		NotOK(c, client.InvalidArgumentError("base config item %s can not be encrypted, mark it sensitive instead", item.Key))
+		return
+	}
+	cond := BaseConfigItem{Tenant: item.Tenant, Project: item.Project, Key: item.Key}
+	base := BaseConfigItem{}
+	result := cs.db.Limit(1).Find(&base, cond)
+	if result.Error != nil {
+		NotOK(c, result.Error)
+		return
+	}
+	exists := result.RowsAffected > 0
+	if item.Value == MaskedValue {
+		probe := *item
+		if probe.Sensitive == nil {
+			probe.Sensitive = &base.Sensitive
+		}
+		if cs.isSensitive(&probe) {
+			NotOK(c, client.InvalidArgumentError("the masked value of %s can not be published", item.Key))
+			return
+		}
+	}
+	if !exists {
+		base = cond
+	}
+	base.Application, base.Value, base.LastUpdateUser = item.Application, item.Value, cs.Username(c)
+	if item.Sensitive != nil {
+		base.Sensitive = *item.Sensitive
+	}
+	var err error
+	if exists {
+		// a map is used as the false sensitive flag is a zero value
+		err = cs.db.Model(&BaseConfigItem{}).
+			Where("tenant = ? and project = ? and `key` = ?", base.Tenant, base.Project, base.Key).
+			Updates(map[string]interface{}{
+				"application":      base.Application,
+				"value":            base.Value,
+				"last_update_user": base.LastUpdateUser,
+				"sensitive":        base.Sensitive,
+			}).Error
+	} else {
+		err = cs.db.Create(&base).Error
+	}
+	if err != nil {
+		NotOK(c, err)
+		return
+	}
+	ret := base.ToClientConfigItem()
+	cs.mask(ret)
+	OK(c, ret)
+}
+
+// DeleteBase deletes a config item of the base layer
+func (cs *ConfigService) DeleteBase(c *gin.Context) {
+	item := buildConfigItemFromReq(c)
+	cs.setAuditData(c, "", item.Tenant, item.Project, "", "")
+	c.Set("audit_subject", map[string]string{
+		"action": "删除",
+		"module": "基础配置项",
+		"name":   item.Key,
+	})
+	result := cs.db.Where("tenant = ? and project = ? and `key` = ?", item.Tenant, item.Project, item.Key).Delete(&BaseConfigItem{})
+	if result.Error != nil {
+		NotOK(c, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		NotOK(c, client.NotFoundError("base config item %s of project %s/%s not found", item.Key, item.Tenant, item.Project))
+		return
+	}
+	OK(c, item)
+}
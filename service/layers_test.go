@@ -0,0 +1,262 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"kubegems.io/configer/client"
+)
+
+func TestMergeLayers(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name           string
+		key            string
+		base, env      *string
+		want           string
+		wantProvenance map[string]string
+	}{
+		{
+			name: "yaml deep merge",
+			key:  "app.yaml",
+			base: str("db:\n  host: mysql\n  port: 3306\nhosts: [a, b]\n"),
+			env:  str("db:\n  host: mysql.prod\nhosts: [c]\n"),
+			want: "db:\n    host: mysql.prod\n    port: 3306\nhosts:\n    - c\n",
+			wantProvenance: map[string]string{
+				"db.host": LayerEnvironment, "db.port": LayerBase, "hosts[0]": LayerEnvironment,
+			},
+		},
+		{
+			name:           "properties",
+			key:            "app.properties",
+			base:           str("a=1\nb=2\n"),
+			env:            str("b=3\n"),
+			want:           "a=1\nb=3\n",
+			wantProvenance: map[string]string{"a": LayerBase, "b": LayerEnvironment},
+		},
+		{
+			name:           "text is overridden",
+			key:            "app.txt",
+			base:           str("base"),
+			env:            str("env"),
+			want:           "env",
+			wantProvenance: map[string]string{"": LayerEnvironment},
+		},
+		{
+			name:           "invalid structured value is overridden",
+			key:            "app.json",
+			base:           str(`{"a": 1}`),
+			env:            str(`{"a": `),
+			want:           `{"a": `,
+			wantProvenance: map[string]string{"": LayerEnvironment},
+		},
+		{
+			name:           "inherited",
+			key:            "app.json",
+			base:           str(`{"a": {"b": 1}}`),
+			want:           `{"a": {"b": 1}}`,
+			wantProvenance: map[string]string{"a.b": LayerBase},
+		},
+		{
+			name:           "environment only",
+			key:            "app.txt",
+			env:            str("env"),
+			want:           "env",
+			wantProvenance: map[string]string{"": LayerEnvironment},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, provenance := mergeLayers(tt.key, tt.base, tt.env)
+			if got != tt.want {
+				t.Errorf("mergeLayers() value = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(provenance, tt.wantProvenance) {
+				t.Errorf("mergeLayers() provenance = %v, want %v", provenance, tt.wantProvenance)
+			}
+		})
+	}
+}
+
+// withBaseItems makes the queries of the base layer return the bases matching the conditions
+func withBaseItems(t *testing.T, cs *ConfigService, bases []BaseConfigItem) {
+	t.Helper()
+	matches := func(base BaseConfigItem, where clause.Where) bool {
+		fields := map[string]string{"tenant": base.Tenant, "project": base.Project, "key": base.Key, "application": base.Application}
+		for _, expr := range where.Exprs {
+			eq, ok := expr.(clause.Eq)
+			if !ok {
+				continue
+			}
+			if column, ok := eq.Column.(clause.Column); ok && fields[column.Name] != fmt.Sprint(eq.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	err := cs.db.Callback().Query().Register("test:base_items", func(db *gorm.DB) {
+		where, _ := db.Statement.Clauses["WHERE"].Expression.(clause.Where)
+		found := []BaseConfigItem{}
+		for _, base := range bases {
+			if matches(base, where) {
+				found = append(found, base)
+			}
+		}
+		switch dest := db.Statement.Dest.(type) {
+		case *[]BaseConfigItem:
+			*dest = found
+		case *BaseConfigItem:
+			if len(found) > 0 {
+				*dest = found[0]
+			} else {
+				found = nil
+			}
+		default:
+			return
+		}
+		db.RowsAffected = int64(len(found))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigService_EffectiveView(t *testing.T) {
+	cli := &memoryClient{values: map[string]string{"app.yaml": "db:\n  port: 3307\n"}}
+	for i := 0; i < client.ListAllPageSize*2+1; i++ {
+		cli.values[fmt.Sprintf("key-%04d", i)] = "v"
+	}
+	cs := newTestConfigService(t, testInfoGetter{}, cli)
+	withBaseItems(t, cs, []BaseConfigItem{
+		{Tenant: "t1", Project: "p1", Key: "app.yaml", Value: "db:\n  host: mysql\n  port: 3306\n"},
+		{Tenant: "t1", Project: "p1", Key: "zz-app2.yaml", Application: "app2", Value: "v: 2"},
+		{Tenant: "t1", Project: "p1", Key: "zz-base.yaml", Value: "v: 1"},
+		{Tenant: "t1", Project: "p1", Key: "zz-secret.yaml", Value: "token: abc", Sensitive: true},
+	})
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/configer/tenant/:tenant/project/:project/environment/:environment", cs.List)
+	engine.GET("/configer/tenant/:tenant/project/:project/environment/:environment/key/:key", cs.Get)
+	request := func(path string, data interface{}) int {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/configer/tenant/t1/project/p1/environment/dev"+path, nil))
+		if w.Code == http.StatusOK {
+			ret := struct {
+				Data interface{} `json:"data"`
+			}{Data: data}
+			if err := json.Unmarshal(w.Body.Bytes(), &ret); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code
+	}
+	valuesOf := func(items []*client.ConfigItem) map[string]string {
+		ret := map[string]string{}
+		for _, it := range items {
+			ret[it.Key] = it.Value
+		}
+		return ret
+	}
+
+	t.Run("list the last page", func(t *testing.T) {
+		items := []*client.ConfigItem{}
+		if code := request("?view=effective&page=11&size=100", &items); code != http.StatusOK {
+			t.Fatalf("List() code = %d", code)
+		}
+		want := map[string]string{"key-0999": "v", "key-1000": "v", "zz-app2.yaml": "v: 2", "zz-base.yaml": "v: 1", "zz-secret.yaml": MaskedValue}
+		if got := valuesOf(items); !reflect.DeepEqual(got, want) {
+			t.Errorf("List() = %v, want %v", got, want)
+		}
+	})
+	t.Run("list of an application", func(t *testing.T) {
+		items := []*client.ConfigItem{}
+		if code := request("?view=effective&application=app1&size=100", &items); code != http.StatusOK {
+			t.Fatalf("List() code = %d", code)
+		}
+		if got := valuesOf(items); len(got) != 3 || got["zz-base.yaml"] != "v: 1" || got["zz-secret.yaml"] != MaskedValue {
+			t.Errorf("List() = %v, want the shared base items only", got)
+		}
+	})
+
+	tests := []struct {
+		name           string
+		path           string
+		wantCode       int
+		wantValue      string
+		wantProvenance map[string]string
+	}{
+		{name: "merged", path: "/key/app.yaml?view=effective", wantCode: http.StatusOK, wantProvenance: map[string]string{"db.host": LayerBase, "db.port": LayerEnvironment}},
+		{name: "inherited only", path: "/key/zz-base.yaml?view=effective", wantCode: http.StatusOK, wantValue: "v: 1", wantProvenance: map[string]string{"v": LayerBase}},
+		{name: "sensitive base", path: "/key/zz-secret.yaml?view=effective", wantCode: http.StatusOK, wantValue: MaskedValue},
+		{name: "base of the application", path: "/key/zz-app2.yaml?view=effective&application=app2", wantCode: http.StatusOK, wantValue: "v: 2"},
+		{name: "base of another application", path: "/key/zz-app2.yaml?view=effective&application=app1", wantCode: http.StatusNotFound},
+		{name: "raw view", path: "/key/zz-base.yaml", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := &client.ConfigItem{}
+			if code := request(tt.path, item); code != tt.wantCode {
+				t.Fatalf("Get() code = %d, want %d", code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			if tt.wantValue != "" && item.Value != tt.wantValue {
+				t.Errorf("Get() value = %q, want %q", item.Value, tt.wantValue)
+			}
+			if tt.wantProvenance != nil && !reflect.DeepEqual(item.Provenance, tt.wantProvenance) {
+				t.Errorf("Get() provenance = %v, want %v", item.Provenance, tt.wantProvenance)
+			}
+		})
+	}
+}
+
+func TestConfigService_PubDeleteBase(t *testing.T) {
+	cs := newTestConfigService(t, testInfoGetter{}, &memoryClient{})
+	withBaseItems(t, cs, []BaseConfigItem{{Tenant: "t1", Project: "p1", Key: "app.yaml", Value: "v: 1"}})
+	// the dummy database deletes nothing, app.yaml is deleted as if it exists
+	err := cs.db.Callback().Delete().Register("test:delete_base", func(db *gorm.DB) {
+		where, _ := db.Statement.Clauses["WHERE"].Expression.(clause.Where)
+		if strings.Contains(fmt.Sprint(where.Exprs), "app.yaml") {
+			db.RowsAffected = 1
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/configer/tenant/:tenant/project/:project/base/key/:key", cs.PubBase)
+	engine.DELETE("/configer/tenant/:tenant/project/:project/base/key/:key", cs.DeleteBase)
+
+	tests := []struct {
+		name     string
+		method   string
+		key      string
+		body     string
+		wantCode int
+	}{
+		{name: "pub", method: http.MethodPost, key: "app.yaml", body: `{"value":"v: 2"}`, wantCode: http.StatusOK},
+		{name: "pub encrypted", method: http.MethodPost, key: "app.yaml", body: `{"value":"v: 2","encrypted":true}`, wantCode: http.StatusBadRequest},
+		{name: "pub not encrypted", method: http.MethodPost, key: "new.yaml", body: `{"value":"v: 2","encrypted":false}`, wantCode: http.StatusOK},
+		{name: "delete", method: http.MethodDelete, key: "app.yaml", wantCode: http.StatusOK},
+		{name: "delete missing", method: http.MethodDelete, key: "missing.yaml", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(tt.method, "/configer/tenant/t1/project/p1/base/key/"+tt.key, strings.NewReader(tt.body)))
+			if w.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d, body = %s", w.Code, tt.wantCode, w.Body.String())
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ type ConfigItem struct {
 	LastUpdateTime time.Time `gorm:"autoUpdateTime"`
 	CreatedTime    time.Time `gorm:"autoCreateTime"`
 	LastUpdateUser string    `gorm:"type:varchar(255)"`
+	Sensitive      bool      `gorm:"default:false"`
 }
 
 func (item *ConfigItem) ToClientConfigItem() *client.ConfigItem {
@@ -31,11 +32,115 @@ func (item *ConfigItem) ToClientConfigItem() *client.ConfigItem {
 		LastModifiedTime: item.LastUpdateTime.Format(time.RFC3339),
 		CreatedTime:      item.CreatedTime.Format(time.RFC3339),
 		LastUpdateUser:   item.LastUpdateUser,
+		Sensitive:        &item.Sensitive,
 	}
 }
 
+// BackendCredential is the password of a backend account, Password is encrypted
+type BackendCredential struct {
+	ID        uint      `gorm:"primarykey"`
+	Cluster   string    `gorm:"type:varchar(192);uniqueIndex:idx_backend_credential_cluster_username"`
+	Username  string    `gorm:"type:varchar(255);uniqueIndex:idx_backend_credential_cluster_username"`
+	Password  string    `gorm:"type:text"`
+	Applied   bool      `gorm:"default:false"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+// BackendShadow is a shadow account keeping the old password of a backend account until ExpiresAt, Password is encrypted
+type BackendShadow struct {
+	ID        uint      `gorm:"primarykey"`
+	Cluster   string    `gorm:"type:varchar(192);index"`
+	Username  string    `gorm:"type:varchar(255)"`
+	Shadow    string    `gorm:"type:varchar(255)"`
+	Password  string    `gorm:"type:text"`
+	Role      string    `gorm:"type:varchar(255)"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// ProjectDataKey is the data key of an environment of a project, wrapped by the master key KeyID of the KeyProvider.
+// each environment has its own key, so an account of one environment can not decrypt the values of another.
+type ProjectDataKey struct {
+	ID          uint      `gorm:"primarykey"`
+	Tenant      string    `gorm:"type:varchar(192);uniqueIndex:idx_project_data_key_tenant_project_environment"`
+	Project     string    `gorm:"type:varchar(192);uniqueIndex:idx_project_data_key_tenant_project_environment"`
+	Environment string    `gorm:"type:varchar(192);uniqueIndex:idx_project_data_key_tenant_project_environment"`
+	KeyID       string    `gorm:"type:varchar(255)"`
+	WrappedKey  string    `gorm:"type:text"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
+
+// ProjectVariable is a variable of a project, the values of the project refer it by ${var:name}
+type ProjectVariable struct {
+	ID             uint      `gorm:"primarykey"`
+	Tenant         string    `gorm:"type:varchar(192);uniqueIndex:idx_project_variable_tenant_project_name"`
+	Project        string    `gorm:"type:varchar(192);uniqueIndex:idx_project_variable_tenant_project_name"`
+	Name           string    `gorm:"type:varchar(192);uniqueIndex:idx_project_variable_tenant_project_name"`
+	Value          string    `gorm:"type:text"`
+	LastUpdateUser string    `gorm:"type:varchar(255)"`
+	LastUpdateTime time.Time `gorm:"autoUpdateTime"`
+}
+
+// BaseConfigItem is a config item of the base layer of a project, which is inherited by every environment
+type BaseConfigItem struct {
+	Tenant         string    `gorm:"type:varchar(192);uniqueIndex:idx_base_config_item_tenant_project_key"`
+	Project        string    `gorm:"type:varchar(192);uniqueIndex:idx_base_config_item_tenant_project_key"`
+	Key            string    `gorm:"type:varchar(192);uniqueIndex:idx_base_config_item_tenant_project_key"`
+	Application    string    `gorm:"type:varchar(255)"`
+	Value          string    `gorm:"type:longtext"`
+	LastUpdateTime time.Time `gorm:"autoUpdateTime"`
+	CreatedTime    time.Time `gorm:"autoCreateTime"`
+	LastUpdateUser string    `gorm:"type:varchar(255)"`
+	Sensitive      bool      `gorm:"default:false"`
+}
+
+func (item *BaseConfigItem) ToClientConfigItem() *client.ConfigItem {
+	return &client.ConfigItem{
+		Tenant:           item.Tenant,
+		Project:          item.Project,
+		Key:              item.Key,
+		Application:      item.Application,
+		Value:            item.Value,
+		LastModifiedTime: item.LastUpdateTime.Format(time.RFC3339),
+		CreatedTime:      item.CreatedTime.Format(time.RFC3339),
+		LastUpdateUser:   item.LastUpdateUser,
+		Sensitive:        &item.Sensitive,
+	}
+}
+
+// ConfigTemplate is a named set of config items, which are published into environments with the parameters
+type ConfigTemplate struct {
+	ID             uint                      `gorm:"primarykey"`
+	Tenant         string                    `gorm:"type:varchar(192);uniqueIndex:idx_config_template_tenant_name"`
+	Name           string                    `gorm:"type:varchar(192);uniqueIndex:idx_config_template_tenant_name"`
+	Description    string                    `gorm:"type:text"`
+	LastUpdateUser string                    `gorm:"type:varchar(255)"`
+	LastUpdateTime time.Time                 `gorm:"autoUpdateTime"`
+	Parameters     []ConfigTemplateParameter `gorm:"foreignKey:TemplateID"`
+	Items          []ConfigTemplateItem      `gorm:"foreignKey:TemplateID"`
+}
+
+type ConfigTemplateParameter struct {
+	ID          uint   `gorm:"primarykey"`
+	TemplateID  uint   `gorm:"uniqueIndex:idx_config_template_parameter_template_name"`
+	Name        string `gorm:"type:varchar(192);uniqueIndex:idx_config_template_parameter_template_name"`
+	Description string `gorm:"type:text"`
+	Default     string `gorm:"type:text"`
+	Required    bool   `gorm:"default:false"`
+}
+
+type ConfigTemplateItem struct {
+	ID          uint   `gorm:"primarykey"`
+	TemplateID  uint   `gorm:"uniqueIndex:idx_config_template_item_template_key"`
+	Key         string `gorm:"type:varchar(192);uniqueIndex:idx_config_template_item_template_key"`
+	Application string `gorm:"type:varchar(255)"`
+	Value       string `gorm:"type:longtext"`
+}
+
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(&ConfigItem{})
+	return db.AutoMigrate(&ConfigItem{}, &BackendCredential{}, &BackendShadow{}, &ProjectDataKey{}, &ProjectVariable{}, &BaseConfigItem{},
+		&ConfigTemplate{}, &ConfigTemplateParameter{}, &ConfigTemplateItem{})
 }
 
 func UpsertConfigItem(item *client.ConfigItem, db *gorm.DB, username string) error {
@@ -55,32 +160,45 @@ func UpsertConfigItem(item *client.ConfigItem, db *gorm.DB, username string) err
 	if username != "" {
 		dbitem.LastUpdateUser = username
 	}
+	if item.Sensitive != nil {
+		dbitem.Sensitive = *item.Sensitive
+	}
 	cond := ConfigItem{
 		Tenant:      item.Tenant,
 		Project:     item.Project,
 		Environment: item.Environment,
 		Key:         item.Key,
 	}
-	err = db.Find(&existOne, cond).Error
-	if err != nil {
-		if !errors.Is(err, gorm.ErrRecordNotFound) {
-			return err
+	result := db.Find(&existOne, cond)
+	if result.Error != nil {
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return result.Error
 		}
 	} else {
-		exist = true
+		// Find does not return ErrRecordNotFound
+		exist = result.RowsAffected > 0
 	}
 	if exist {
-		if existOne.Application != item.Application || existOne.Value != item.Value {
+		if item.Sensitive == nil {
+			dbitem.Sensitive = existOne.Sensitive
+		}
+		if existOne.Application != item.Application || existOne.Value != item.Value || existOne.Sensitive != dbitem.Sensitive {
 			existOne.Application = item.Application
 			existOne.Value = item.Value
 			existOne.LastUpdateUser = dbitem.LastUpdateUser
+			existOne.Sensitive = dbitem.Sensitive
+			// a map is used as the false sensitive flag is a zero value
+			updates := map[string]interface{}{
+				"application": item.Application,
+				"value":       item.Value,
+				"sensitive":   existOne.Sensitive,
+			}
+			if dbitem.LastUpdateUser != "" {
+				updates["last_update_user"] = dbitem.LastUpdateUser
+			}
 			err = db.Model(&ConfigItem{}).
 				Where("tenant = ? and project = ? and environment = ? and `key` = ?", item.Tenant, item.Project, item.Environment, item.Key).
-				Updates(ConfigItem{
-					Application:    item.Application,
-					Value:          item.Value,
-					LastUpdateUser: dbitem.LastUpdateUser,
-				}).Error
+				Updates(updates).Error
 			dbitem = &existOne
 		}
 	} else {
@@ -90,6 +208,7 @@ func UpsertConfigItem(item *client.ConfigItem, db *gorm.DB, username string) err
 		return err
 	}
 	item.LastUpdateUser = username
+	item.Sensitive = &dbitem.Sensitive
 	item.LastModifiedTime = dbitem.LastUpdateTime.Format(time.RFC3339)
 	item.CreatedTime = dbitem.CreatedTime.Format(time.RFC3339)
 	return nil
@@ -104,6 +223,7 @@ func DeleteConfigItem(item *client.ConfigItem, db *gorm.DB) error {
 	}).Error
 }
 
+// FillDates fills the dates, the last update user and the sensitive flags of items from database
 func FillDates(conditem *client.ConfigItem, items []*client.ConfigItem, db *gorm.DB) error {
 	dbitems := []ConfigItem{}
 	db.Find(&dbitems, ConfigItem{
@@ -123,6 +243,7 @@ func FillDates(conditem *client.ConfigItem, items []*client.ConfigItem, db *gorm
 		item.LastModifiedTime = dbitem.LastUpdateTime.Format(time.RFC3339)
 		item.CreatedTime = dbitem.CreatedTime.Format(time.RFC3339)
 		item.LastUpdateUser = dbitem.LastUpdateUser
+		item.Sensitive = &dbitem.Sensitive
 	}
 	return nil
 }
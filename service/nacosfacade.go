@@ -0,0 +1,307 @@
+package service
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"kubegems.io/configer/client"
+)
+
+/*
+兼容 nacos open api 的配置接口, 后端可以是任意配置中心, nacos 客户端需要设置 contextPath 为 {configer}/configer/nacos
+映射关系:
+	tenant = client.NacosTenantID(tenant, project) 或者 kubegems/{tenant}/{project}
+	group  = environment
+	dataId = key
+	appName = application
+*/
+
+const (
+	nacosListenerSeparator  = "\x01"
+	nacosListenerFieldSep   = "\x02"
+	nacosDefaultPollingTime = 30 * time.Second
+	// the listener polls the configs every nacosListenerPollInterval at first, and backs off to nacosListenerMaxPollInterval
+	nacosListenerPollInterval    = time.Second
+	nacosListenerMaxPollInterval = 8 * time.Second
+)
+
+type nacosTenantCache struct {
+	tenants map[string][2]string
+	lock    sync.RWMutex
+}
+
+// resolve is the inverse of client.NacosDataMapper.TenantID, the hashed id is looked up in known tenants and projects,
+// which are the ones having config items in database and the ones listed by projects if not nil
+func (cache *nacosTenantCache) resolve(db *gorm.DB, projects ProjectsGetter, tenantID string) (tenant, project string, err error) {
+	if strings.HasPrefix(tenantID, "kubegems/") {
+		seps := strings.Split(tenantID, "/")
+		if len(seps) == 3 && seps[1] != "" && seps[2] != "" {
+			return seps[1], seps[2], nil
+		}
+		return "", "", client.InvalidArgumentError("invalid tenant %s", tenantID)
+	}
+	cache.lock.RLock()
+	tp, ok := cache.tenants[tenantID]
+	cache.lock.RUnlock()
+	if ok {
+		return tp[0], tp[1], nil
+	}
+
+	rows := []ConfigItem{}
+	if err := db.Model(&ConfigItem{}).Distinct("tenant", "project").Find(&rows).Error; err != nil {
+		return "", "", err
+	}
+	pairs := make([][2]string, 0, len(rows))
+	for _, row := range rows {
+		pairs = append(pairs, [2]string{row.Tenant, row.Project})
+	}
+	if projects != nil {
+		listed, err := projects.Projects()
+		if err != nil {
+			return "", "", err
+		}
+		pairs = append(pairs, listed...)
+	}
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	for _, pair := range pairs {
+		cache.tenants[client.NacosTenantID(pair[0], pair[1])] = pair
+	}
+	if tp, ok := cache.tenants[tenantID]; ok {
+		return tp[0], tp[1], nil
+	}
+	return "", "", client.NotFoundError("tenant %s not found", tenantID)
+}
+
+func (cs *ConfigService) nacosItemOf(c *gin.Context, tenantID, group, dataID string) (*client.ConfigItem, error) {
+	if tenantID == "" || group == "" || dataID == "" {
+		return nil, client.InvalidArgumentError("tenant, group and dataId must be specified")
+	}
+	projects, _ := cs.InfoGetter.(ProjectsGetter)
+	tenant, project, err := cs.nacosTenants.resolve(cs.db, projects, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return &client.ConfigItem{
+		Tenant:      tenant,
+		Project:     project,
+		Environment: group,
+		Key:         dataID,
+		Application: c.Request.FormValue("appName"),
+	}, nil
+}
+
+func nacosText(c *gin.Context, code int, msg string) {
+	c.String(code, msg)
+}
+
+func (cs *ConfigService) NacosGetConfig(c *gin.Context) {
+	item, err := cs.nacosItemOf(c, c.Query("tenant"), c.Query("group"), c.Query("dataId"))
+	if err != nil {
+		nacosText(c, httpStatusOf(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	_, cli, err := cs.ClientOf(item)
+	if err != nil {
+		nacosText(c, httpStatusOf(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	if err := cli.Get(c, item); err != nil {
+		if codeOf(err) == client.ErrorCodeNotFound {
+			nacosText(c, http.StatusNotFound, "config data not exist")
+		} else {
+			nacosText(c, httpStatusOf(err, http.StatusInternalServerError), err.Error())
+		}
+		return
+	}
+	if err := cs.renderOrMask(c, cli, item, true); err != nil {
+		nacosText(c, httpStatusOf(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	c.Header("Config-Type", string(formatOf(item.Key)))
+	c.Header("Content-MD5", md5Of(item.Value))
+	nacosText(c, http.StatusOK, item.Value)
+}
+
+func (cs *ConfigService) NacosPubConfig(c *gin.Context) {
+	item, err := cs.nacosItemOf(c, c.PostForm("tenant"), c.PostForm("group"), c.PostForm("dataId"))
+	if err != nil {
+		nacosText(c, httpStatusOf(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	item.Value = c.PostForm("content")
+	clusterName, cli, err := cs.ClientOf(item)
+	cs.setAuditData(c, clusterName, item.Tenant, item.Project, item.Environment, item.Application)
+	if err != nil {
+		nacosText(c, httpStatusOf(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	c.Set("audit_subject", map[string]string{
+		"action": "发布",
+		"module": "配置项",
+		"name":   item.Key,
+	})
+	if err := cs.checkNotMaskedRendering(c, cli, item); err != nil {
+		nacosText(c, httpStatusOf(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	item.LastUpdateUser = cs.Username(c)
+	if err := cli.Pub(c, item); err != nil {
+		nacosText(c, httpStatusOf(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	if err := UpsertConfigItem(item, cs.db, cs.Username(c)); err != nil {
+		nacosText(c, httpStatusOf(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	nacosText(c, http.StatusOK, "true")
+}
+
+func (cs *ConfigService) NacosDeleteConfig(c *gin.Context) {
+	item, err := cs.nacosItemOf(c, c.Query("tenant"), c.Query("group"), c.Query("dataId"))
+	if err != nil {
+		nacosText(c, httpStatusOf(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	clusterName, cli, err := cs.ClientOf(item)
+	cs.setAuditData(c, clusterName, item.Tenant, item.Project, item.Environment, item.Application)
+	if err != nil {
+		nacosText(c, httpStatusOf(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	c.Set("audit_subject", map[string]string{
+		"action": "删除",
+		"module": "配置项",
+		"name":   item.Key,
+	})
+	item.LastUpdateUser = cs.Username(c)
+	if err := cli.Delete(c, item); err != nil {
+		nacosText(c, httpStatusOf(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	if err := DeleteConfigItem(item, cs.db); err != nil {
+		nacosText(c, httpStatusOf(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	nacosText(c, http.StatusOK, "true")
+}
+
+type nacosListeningConfig struct {
+	dataID string
+	group  string
+	md5    string
+	tenant string
+}
+
+// NacosListener is the long polling listener, it returns the changed configs once any md5 differs or until timeout
+func (cs *ConfigService) NacosListener(c *gin.Context) {
+	listenings := []nacosListeningConfig{}
+	for _, line := range strings.Split(c.PostForm("Listening-Configs"), nacosListenerSeparator) {
+		fields := strings.Split(line, nacosListenerFieldSep)
+		if len(fields) < 3 {
+			continue
+		}
+		l := nacosListeningConfig{dataID: fields[0], group: fields[1], md5: fields[2]}
+		if len(fields) > 3 {
+			l.tenant = fields[3]
+		}
+		listenings = append(listenings, l)
+	}
+	if len(listenings) == 0 {
+		nacosText(c, http.StatusBadRequest, "invalid probeModify")
+		return
+	}
+	timeout := nacosDefaultPollingTime
+	if ms, err := strconv.Atoi(c.GetHeader("Long-Pulling-Timeout")); err == nil && ms > 0 && time.Duration(ms)*time.Millisecond < timeout {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	interval := nacosListenerPollInterval
+	for {
+		if changed := cs.nacosChangedConfigs(c, listenings); changed != "" {
+			nacosText(c, http.StatusOK, url.QueryEscape(changed))
+			return
+		}
+		poll := time.NewTimer(interval)
+		select {
+		case <-c.Request.Context().Done():
+			poll.Stop()
+			return
+		case <-deadline.C:
+			poll.Stop()
+			nacosText(c, http.StatusOK, "")
+			return
+		case <-poll.C:
+		}
+		if interval *= 2; interval > nacosListenerMaxPollInterval {
+			interval = nacosListenerMaxPollInterval
+		}
+	}
+}
+
+// nacosChangedConfigs returns the listening configs whose md5 differs, the configs of an environment are listed by one request
+func (cs *ConfigService) nacosChangedConfigs(c *gin.Context, listenings []nacosListeningConfig) string {
+	environments := map[string]map[string]*client.ConfigItem{}
+	sb := strings.Builder{}
+	for _, l := range listenings {
+		var current string
+		if item, err := cs.nacosItemOf(c, l.tenant, l.group, l.dataID); err == nil {
+			env := item.Tenant + "/" + item.Project + "/" + item.Environment
+			items, ok := environments[env]
+			if !ok {
+				items = cs.nacosItemsOf(c, item)
+				environments[env] = items
+			}
+			if listed, ok := items[item.Key]; ok {
+				// the same as what NacosGetConfig returns, so the changes of the secrets referred are notified too
+				rendered := *listed
+				if _, cli, err := cs.ClientOf(&rendered); err == nil && cs.renderOrMask(c, cli, &rendered, false) == nil {
+					current = md5Of(rendered.Value)
+				}
+			}
+		}
+		if current == l.md5 {
+			continue
+		}
+		sb.WriteString(l.dataID + nacosListenerFieldSep + l.group)
+		if l.tenant != "" {
+			sb.WriteString(nacosListenerFieldSep + l.tenant)
+		}
+		sb.WriteString(nacosListenerSeparator)
+	}
+	return sb.String()
+}
+
+// nacosItemsOf returns the config items of the environment of item by key, nil if failed
+func (cs *ConfigService) nacosItemsOf(c *gin.Context, item *client.ConfigItem) map[string]*client.ConfigItem {
+	_, cli, err := cs.ClientOf(item)
+	if err != nil {
+		return nil
+	}
+	items, err := client.ListAll(c, cli, &client.ConfigItem{Tenant: item.Tenant, Project: item.Project, Environment: item.Environment})
+	if err != nil {
+		return nil
+	}
+	ret := make(map[string]*client.ConfigItem, len(items))
+	for _, it := range items {
+		ret[it.Key] = it
+	}
+	return ret
+}
+
+func md5Of(value string) string {
+	if value == "" {
+		return ""
+	}
+	sum := md5.Sum([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"kubegems.io/configer/client"
+)
+
+// projectsInfoGetter lists the projects for the nacos facade
+type projectsInfoGetter struct {
+	testInfoGetter
+	projects [][2]string
+}
+
+func (p projectsInfoGetter) Projects() ([][2]string, error) {
+	return p.projects, nil
+}
+
+// CanReveal allows the requests with the header X-Reveal
+func (p projectsInfoGetter) CanReveal(c *gin.Context, tenant, project, environment string) bool {
+	return c.GetHeader("X-Reveal") == "true"
+}
+
+// newTestNacosFacade returns the engine serving the facade, audited is set to the audit subject of the requests
+func newTestNacosFacade(t *testing.T, cli *memoryClient, audited *map[string]string) *gin.Engine {
+	t.Helper()
+	cs := newTestConfigService(t, projectsInfoGetter{projects: [][2]string{{"t1", "p1"}}}, cli)
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(func(c *gin.Context) {
+		c.Next()
+		subject, _ := c.Get("audit_subject")
+		*audited, _ = subject.(map[string]string)
+	})
+	engine.GET("/configer"+client.CONFIG_PATH, cs.NacosGetConfig)
+	engine.POST("/configer"+client.CONFIG_PATH, cs.NacosPubConfig)
+	engine.DELETE("/configer"+client.CONFIG_PATH, cs.NacosDeleteConfig)
+	engine.POST("/configer"+client.LISTENER_PATH, cs.NacosListener)
+	return engine
+}
+
+func TestConfigService_NacosConfig(t *testing.T) {
+	cli := &memoryClient{values: map[string]string{"app.yaml": "a: 1", "db.password": "secret", "ref.yaml": "p: ${key:db.password}"}}
+	audited := map[string]string{}
+	engine := newTestNacosFacade(t, cli, &audited)
+	hashed := client.NacosTenantID("t1", "p1")
+	query := func(tenant, dataID string) string {
+		return "/configer" + client.CONFIG_PATH + "?" + url.Values{"tenant": {tenant}, "group": {"dev"}, "dataId": {dataID}}.Encode()
+	}
+	form := func(values url.Values) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/configer"+client.CONFIG_PATH, strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+	revealed := httptest.NewRequest(http.MethodGet, query(hashed, "db.password"), nil)
+	revealed.Header.Set("X-Reveal", "true")
+	revealed2 := httptest.NewRequest(http.MethodGet, query(hashed, "db.password"), nil)
+	revealed2.Header.Set("X-Reveal", "true")
+	tests := []struct {
+		name      string
+		req       *http.Request
+		wantCode  int
+		wantBody  string
+		wantAudit bool
+	}{
+		{name: "get sensitive masked", req: httptest.NewRequest(http.MethodGet, query(hashed, "db.password"), nil), wantCode: http.StatusOK, wantBody: MaskedValue},
+		{name: "get sensitive revealed", req: revealed, wantCode: http.StatusOK, wantBody: "secret", wantAudit: true},
+		{name: "get", req: httptest.NewRequest(http.MethodGet, query("kubegems/t1/p1", "app.yaml"), nil), wantCode: http.StatusOK, wantBody: "a: 1"},
+		{name: "get by hashed tenant", req: httptest.NewRequest(http.MethodGet, query(hashed, "app.yaml"), nil), wantCode: http.StatusOK, wantBody: "a: 1"},
+		{name: "get unknown tenant", req: httptest.NewRequest(http.MethodGet, query(client.NacosTenantID("t1", "p2"), "app.yaml"), nil), wantCode: http.StatusNotFound},
+		{name: "get missing", req: httptest.NewRequest(http.MethodGet, query(hashed, "missing.yaml"), nil), wantCode: http.StatusNotFound, wantBody: "config data not exist"},
+		{name: "get without data id", req: httptest.NewRequest(http.MethodGet, query(hashed, ""), nil), wantCode: http.StatusBadRequest},
+		{
+			name:     "pub",
+			req:      form(url.Values{"tenant": {hashed}, "group": {"dev"}, "dataId": {"new.yaml"}, "content": {"b: 2"}}),
+			wantCode: http.StatusOK,
+			wantBody: "true",
+		},
+		{
+			name:     "pub masked value",
+			req:      form(url.Values{"tenant": {hashed}, "group": {"dev"}, "dataId": {"db.password"}, "content": {MaskedValue}}),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "pub masked value of a config referring sensitive keys",
+			req:      form(url.Values{"tenant": {hashed}, "group": {"dev"}, "dataId": {"ref.yaml"}, "content": {MaskedValue}}),
+			wantCode: http.StatusBadRequest,
+		},
+		{name: "get sensitive unchanged", req: revealed2, wantCode: http.StatusOK, wantBody: "secret", wantAudit: true},
+		{name: "get published", req: httptest.NewRequest(http.MethodGet, query(hashed, "new.yaml"), nil), wantCode: http.StatusOK, wantBody: "b: 2"},
+		{name: "delete", req: httptest.NewRequest(http.MethodDelete, query(hashed, "new.yaml"), nil), wantCode: http.StatusOK, wantBody: "true"},
+		{name: "delete missing", req: httptest.NewRequest(http.MethodDelete, query(hashed, "new.yaml"), nil), wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audited = nil
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, tt.req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d, body %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+			if tt.wantAudit != (audited != nil && audited["module"] == "敏感配置项") {
+				t.Errorf("audit subject = %v, wantAudit %v", audited, tt.wantAudit)
+			}
+		})
+	}
+}
+
+func TestConfigService_NacosListener(t *testing.T) {
+	cli := &memoryClient{values: map[string]string{"app.yaml": "a: 1", "db.yaml": "b: 2", "db.password": "secret"}}
+	engine := newTestNacosFacade(t, cli, &map[string]string{})
+	listen := func(configs ...[3]string) (string, time.Duration) {
+		lines := []string{}
+		for _, c := range configs {
+			lines = append(lines, strings.Join([]string{c[0], "dev", c[1], c[2]}, nacosListenerFieldSep))
+		}
+		req := httptest.NewRequest(http.MethodPost, "/configer"+client.LISTENER_PATH,
+			strings.NewReader(url.Values{"Listening-Configs": {strings.Join(lines, nacosListenerSeparator) + nacosListenerSeparator}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Long-Pulling-Timeout", "200")
+		w := httptest.NewRecorder()
+		start := time.Now()
+		engine.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("code = %d, body %s", w.Code, w.Body.String())
+		}
+		changed, _ := url.QueryUnescape(w.Body.String())
+		return changed, time.Since(start)
+	}
+
+	changed, elapsed := listen([3]string{"app.yaml", md5Of("a: 1"), "kubegems/t1/p1"}, [3]string{"db.yaml", md5Of("b: 2"), "kubegems/t1/p1"})
+	if changed != "" || elapsed < 200*time.Millisecond {
+		t.Errorf("unchanged configs got %q after %s", changed, elapsed)
+	}
+	changed, _ = listen([3]string{"app.yaml", md5Of("a: 1"), "kubegems/t1/p1"}, [3]string{"db.yaml", md5Of("b: 1"), "kubegems/t1/p1"})
+	if want := "db.yaml" + nacosListenerFieldSep + "dev" + nacosListenerFieldSep + "kubegems/t1/p1" + nacosListenerSeparator; changed != want {
+		t.Errorf("changed configs = %q, want %q", changed, want)
+	}
+	// the same as the masked value NacosGetConfig returns
+	changed, _ = listen([3]string{"db.password", md5Of(MaskedValue), "kubegems/t1/p1"})
+	if changed != "" {
+		t.Errorf("unchanged masked config got %q", changed)
+	}
+	changed, _ = listen([3]string{"missing.yaml", "", "kubegems/t1/p1"})
+	if changed != "" {
+		t.Errorf("missing config listened with empty md5 got %q", changed)
+	}
+}
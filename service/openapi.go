@@ -0,0 +1,27 @@
+package service
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// openapiDocument describes every route registered by RegistRouter, openapi_test.go checks it against the routes
+//
+//go:embed openapi.yaml
+var openapiDocument []byte
+
+func (h *ConfigerHandler) OpenAPIYAML(c *gin.Context) {
+	c.Data(http.StatusOK, "application/yaml", openapiDocument)
+}
+
+func (h *ConfigerHandler) OpenAPIJSON(c *gin.Context) {
+	doc := map[string]interface{}{}
+	if err := yaml.Unmarshal(openapiDocument, &doc); err != nil {
+		NotOK(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, doc)
+}
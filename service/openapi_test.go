@@ -0,0 +1,147 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+	"kubegems.io/configer/client"
+)
+
+type openapiDoc struct {
+	Paths      map[string]map[string]interface{} `yaml:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]interface{} `yaml:"properties"`
+		} `yaml:"schemas"`
+	} `yaml:"components"`
+}
+
+func loadOpenAPI(t *testing.T) *openapiDoc {
+	doc := &openapiDoc{}
+	if err := yaml.Unmarshal(openapiDocument, doc); err != nil {
+		t.Fatalf("invalid openapi document, %v", err)
+	}
+	return doc
+}
+
+func TestOpenAPI_Routes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	h := &ConfigerHandler{}
+	h.RegistRouter(engine.Group(""))
+
+	param := regexp.MustCompile(`:([^/]+)`)
+	registered := map[string]bool{}
+	for _, route := range engine.Routes() {
+		path := param.ReplaceAllString(route.Path, "{$1}")
+		registered[strings.ToLower(route.Method)+" "+path] = true
+	}
+	documented := map[string]bool{}
+	for path, item := range loadOpenAPI(t).Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			documented[method+" "+path] = true
+		}
+	}
+	diff := func(a, b map[string]bool) []string {
+		ret := []string{}
+		for k := range a {
+			if !b[k] {
+				ret = append(ret, k)
+			}
+		}
+		sort.Strings(ret)
+		return ret
+	}
+	if missing := diff(registered, documented); len(missing) > 0 {
+		t.Errorf("routes not documented: %v", missing)
+	}
+	if extra := diff(documented, registered); len(extra) > 0 {
+		t.Errorf("documented routes not registered: %v", extra)
+	}
+	// the templates belong to tenants
+	for _, route := range []string{
+		"get /configer/tenant/{tenant}/templates",
+		"get /configer/tenant/{tenant}/templates/{name}",
+		"put /configer/tenant/{tenant}/templates/{name}",
+		"delete /configer/tenant/{tenant}/templates/{name}",
+	} {
+		if !registered[route] || !documented[route] {
+			t.Errorf("route %s registered %v, documented %v", route, registered[route], documented[route])
+		}
+	}
+}
+
+func TestOpenAPI_Schemas(t *testing.T) {
+	doc := loadOpenAPI(t)
+	tests := []struct {
+		schema string
+		typ    interface{}
+	}{
+		{schema: "ConfigItem", typ: client.ConfigItem{}},
+		{schema: "HistoryVersion", typ: client.HistoryVersion{}},
+		{schema: "Account", typ: client.Account{}},
+		{schema: "RotatedAccount", typ: client.RotatedAccount{}},
+		{schema: "DataKey", typ: client.DataKey{}},
+		{schema: "RenderedConfig", typ: RenderedConfig{}},
+		{schema: "Variable", typ: Variable{}},
+		{schema: "Template", typ: Template{}},
+		{schema: "InstantiateRequest", typ: InstantiateRequest{}},
+		{schema: "InstantiateResult", typ: InstantiateResult{}},
+		{schema: "SpringEnvironment", typ: SpringEnvironment{}},
+		{schema: "ClientInfo", typ: ClientInfo{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			want := []string{}
+			rt := reflect.TypeOf(tt.typ)
+			for i := 0; i < rt.NumField(); i++ {
+				want = append(want, strings.Split(rt.Field(i).Tag.Get("json"), ",")[0])
+			}
+			got := []string{}
+			for name := range doc.Components.Schemas[tt.schema].Properties {
+				got = append(got, name)
+			}
+			sort.Strings(want)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("schema %s properties = %v, want %v", tt.schema, got, want)
+			}
+		})
+	}
+}
+
+func TestOpenAPI_Serve(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	h := &ConfigerHandler{}
+	h.RegistRouter(engine.Group(""))
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/configer/openapi.json", nil))
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("serve openapi json failed, code %d, %v", w.Code, err)
+	}
+	if doc["openapi"] != "3.0.3" {
+		t.Errorf("openapi version = %v", doc["openapi"])
+	}
+	// every reference must be defined
+	refs := regexp.MustCompile(`"\$ref":"#/components/(\w+)/(\w+)"`).FindAllStringSubmatch(w.Body.String(), -1)
+	components := doc["components"].(map[string]interface{})
+	for _, ref := range refs {
+		if group, ok := components[ref[1]].(map[string]interface{}); !ok || group[ref[2]] == nil {
+			t.Errorf("undefined reference %s/%s", ref[1], ref[2])
+		}
+	}
+}
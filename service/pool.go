@@ -0,0 +1,260 @@
+package service
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"kubegems.io/configer/client"
+)
+
+const (
+	DefaultClientTTL        = 30 * time.Minute
+	DefaultClientPoolSize   = 64
+	DefaultClientRevalidate = time.Minute
+	// evicted clients are closed after the delay, so the requests using them can finish
+	DefaultClientCloseDelay = 30 * time.Second
+)
+
+// ConnectionInfo is how to connect to the backend of a cluster
+type ConnectionInfo struct {
+	// Address is comma separated for backends of more than one node
+	Address  string
+	Username string
+	Password string
+	TLS      *client.TLSConfig
+}
+
+func (info ConnectionInfo) fingerprint() string {
+	h := sha256.New()
+	for _, s := range []string{info.Address, info.Username, info.Password} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	if info.TLS != nil {
+		json.NewEncoder(h).Encode(info.TLS)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// ClientInfo is the information of a cached client, it never contains credentials
+type ClientInfo struct {
+	ClusterName string    `json:"clusterName"`
+	Address     string    `json:"address"`
+	CreatedAt   time.Time `json:"createdAt"`
+	LastUsedAt  time.Time `json:"lastUsedAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+type pooledClient struct {
+	ClientInfo
+	client      client.ConfigClientIface
+	fingerprint string
+	checkedAt   time.Time
+}
+
+// ClientPool caches a backend client for each cluster, it is safe for concurrent use.
+// clients are evicted when expired, least recently used or the connection info of the cluster changed.
+type ClientPool struct {
+	TTL time.Duration
+	// Revalidate is the interval to read the connection info again to find changes
+	Revalidate time.Duration
+	MaxSize    int
+	CloseDelay time.Duration
+
+	lock  sync.Mutex
+	items map[string]*list.Element
+	// lru holds *pooledClient, the front is the most recently used
+	lru *list.List
+	now func() time.Time
+}
+
+func NewClientPool() *ClientPool {
+	return &ClientPool{
+		TTL:        DefaultClientTTL,
+		Revalidate: DefaultClientRevalidate,
+		MaxSize:    DefaultClientPoolSize,
+		CloseDelay: DefaultClientCloseDelay,
+		items:      map[string]*list.Element{},
+		lru:        list.New(),
+		now:        time.Now,
+	}
+}
+
+// Get returns the cached client of the cluster.
+// info is called at most every Revalidate to read the connection info, create is called when there is no valid client.
+func (p *ClientPool) Get(
+	clusterName string,
+	info func() (ConnectionInfo, error),
+	create func(ConnectionInfo) (client.ConfigClientIface, error),
+) (client.ConfigClientIface, error) {
+	now := p.now()
+	if cli := p.lookup(clusterName, now, func(pc *pooledClient) bool {
+		return now.Sub(pc.checkedAt) < p.Revalidate
+	}); cli != nil {
+		return cli, nil
+	}
+
+	connInfo, err := info()
+	if err != nil {
+		return nil, err
+	}
+	fingerprint := connInfo.fingerprint()
+	if cli := p.lookup(clusterName, now, func(pc *pooledClient) bool {
+		if pc.fingerprint != fingerprint {
+			return false
+		}
+		pc.checkedAt = now
+		return true
+	}); cli != nil {
+		return cli, nil
+	}
+
+	// create without lock, connecting may be slow
+	cli, err := create(connInfo)
+	if err != nil {
+		return nil, err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if elem, ok := p.items[clusterName]; ok {
+		pc := elem.Value.(*pooledClient)
+		if pc.fingerprint == fingerprint && now.Before(pc.ExpiresAt) {
+			// created by a concurrent request
+			p.closeLater(cli)
+			return pc.client, nil
+		}
+		p.removeLocked(elem)
+	}
+	pc := &pooledClient{
+		ClientInfo: ClientInfo{
+			ClusterName: clusterName,
+			Address:     connInfo.Address,
+			CreatedAt:   now,
+			LastUsedAt:  now,
+			ExpiresAt:   now.Add(p.TTL),
+		},
+		client:      cli,
+		fingerprint: fingerprint,
+		checkedAt:   now,
+	}
+	p.items[clusterName] = p.lru.PushFront(pc)
+	for p.MaxSize > 0 && p.lru.Len() > p.MaxSize {
+		p.removeLocked(p.lru.Back())
+	}
+	return cli, nil
+}
+
+// lookup returns the cached client if it is not expired and valid returns true
+func (p *ClientPool) lookup(clusterName string, now time.Time, valid func(pc *pooledClient) bool) client.ConfigClientIface {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	elem, ok := p.items[clusterName]
+	if !ok {
+		return nil
+	}
+	pc := elem.Value.(*pooledClient)
+	if !now.Before(pc.ExpiresAt) {
+		p.removeLocked(elem)
+		return nil
+	}
+	if !valid(pc) {
+		return nil
+	}
+	pc.LastUsedAt = now
+	p.lru.MoveToFront(elem)
+	return pc.client
+}
+
+// List returns the cached clients, the most recently used first
+func (p *ClientPool) List() []ClientInfo {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := p.now()
+	ret := []ClientInfo{}
+	for elem := p.lru.Front(); elem != nil; {
+		next := elem.Next()
+		pc := elem.Value.(*pooledClient)
+		if now.Before(pc.ExpiresAt) {
+			ret = append(ret, pc.ClientInfo)
+		} else {
+			p.removeLocked(elem)
+		}
+		elem = next
+	}
+	return ret
+}
+
+// Evict removes the client of the cluster, it returns false if not cached
+func (p *ClientPool) Evict(clusterName string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	elem, ok := p.items[clusterName]
+	if ok {
+		p.removeLocked(elem)
+	}
+	return ok
+}
+
+func (p *ClientPool) removeLocked(elem *list.Element) {
+	pc := p.lru.Remove(elem).(*pooledClient)
+	delete(p.items, pc.ClusterName)
+	p.closeLater(pc.client)
+}
+
+func (p *ClientPool) closeLater(cli client.ConfigClientIface) {
+	closer, ok := cli.(io.Closer)
+	if !ok {
+		return
+	}
+	if p.CloseDelay <= 0 {
+		closer.Close()
+		return
+	}
+	time.AfterFunc(p.CloseDelay, func() { closer.Close() })
+}
+
+// AdminAuthorizer is optionally implemented by the InfoGetter to check who can administrate the configer,
+// such as the cached backend clients, otherwise no one can
+type AdminAuthorizer interface {
+	IsAdmin(c *gin.Context) bool
+}
+
+// checkAdmin returns an error if the caller is not an administrator
+func (cs *ConfigService) checkAdmin(c *gin.Context) error {
+	if authorizer, ok := cs.InfoGetter.(AdminAuthorizer); ok && authorizer.IsAdmin(c) {
+		return nil
+	}
+	return client.UnauthorizedError("%s is not an administrator", cs.Username(c))
+}
+
+func (cs *ConfigService) ListClients(c *gin.Context) {
+	if err := cs.checkAdmin(c); err != nil {
+		NotOK(c, err)
+		return
+	}
+	OK(c, cs.clients.List())
+}
+
+func (cs *ConfigService) EvictClient(c *gin.Context) {
+	clusterName := c.Param("cluster")
+	c.Set("audit_subject", map[string]string{
+		"action": "清除",
+		"module": "配置中心客户端",
+		"name":   clusterName,
+	})
+	if err := cs.checkAdmin(c); err != nil {
+		NotOK(c, err)
+		return
+	}
+	if !cs.clients.Evict(clusterName) {
+		NotOK(c, client.NotFoundError("client of cluster %s not found", clusterName))
+		return
+	}
+	OK(c, clusterName)
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"kubegems.io/configer/client"
+)
+
+type fakeClient struct {
+	client.ConfigClientIface
+	info   ConnectionInfo
+	closed bool
+}
+
+func (f *fakeClient) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestClientPool(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	pool := NewClientPool()
+	pool.MaxSize = 2
+	pool.CloseDelay = 0
+	pool.now = func() time.Time { return now }
+
+	infos := map[string]ConnectionInfo{
+		"a": {Address: "a:8848", Username: "nacos", Password: "1"},
+		"b": {Address: "b:8848"},
+		"c": {Address: "c:8848"},
+	}
+	infoCalls, creates := 0, 0
+	get := func(cluster string) *fakeClient {
+		t.Helper()
+		cli, err := pool.Get(cluster, func() (ConnectionInfo, error) {
+			infoCalls++
+			return infos[cluster], nil
+		}, func(info ConnectionInfo) (client.ConfigClientIface, error) {
+			creates++
+			return &fakeClient{info: info}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cli.(*fakeClient)
+	}
+
+	a := get("a")
+	if get("a") != a || infoCalls != 1 || creates != 1 {
+		t.Fatalf("cached client not reused, info calls %d, creates %d", infoCalls, creates)
+	}
+
+	// unchanged info after revalidate keeps the client
+	now = now.Add(pool.Revalidate)
+	if get("a") != a || infoCalls != 2 || creates != 1 {
+		t.Fatalf("unchanged client recreated, info calls %d, creates %d", infoCalls, creates)
+	}
+
+	// changed password is found on the next revalidation
+	infos["a"] = ConnectionInfo{Address: "a:8848", Username: "nacos", Password: "2"}
+	if get("a") != a {
+		t.Fatal("client recreated before revalidate")
+	}
+	now = now.Add(pool.Revalidate)
+	a2 := get("a")
+	if a2 == a || !a.closed || a2.info.Password != "2" {
+		t.Fatal("changed client not recreated")
+	}
+
+	// the least recently used is evicted
+	b := get("b")
+	get("a")
+	get("c")
+	if !b.closed || a2.closed {
+		t.Fatal("least recently used client not evicted")
+	}
+	if list := pool.List(); len(list) != 2 || list[0].ClusterName != "c" || list[1].ClusterName != "a" {
+		t.Fatalf("List() = %v", list)
+	}
+
+	// expired clients are dropped
+	now = now.Add(pool.TTL)
+	if list := pool.List(); len(list) != 0 || !a2.closed {
+		t.Fatalf("expired clients not dropped, List() = %v", list)
+	}
+
+	get("a")
+	if !pool.Evict("a") || pool.Evict("a") {
+		t.Fatal("Evict() of cached client should succeed once")
+	}
+}
+
+// adminInfoGetter allows the requests with the header X-Admin
+type adminInfoGetter struct {
+	testInfoGetter
+}
+
+func (adminInfoGetter) IsAdmin(c *gin.Context) bool {
+	return c.GetHeader("X-Admin") == "true"
+}
+
+func TestConfigService_AdminClients(t *testing.T) {
+	tests := []struct {
+		name       string
+		infoGetter InfoGetter
+		admin      bool
+		wantCode   int
+	}{
+		{name: "admin", infoGetter: adminInfoGetter{}, admin: true, wantCode: http.StatusOK},
+		{name: "not admin", infoGetter: adminInfoGetter{}, wantCode: http.StatusForbidden},
+		{name: "no authorizer", infoGetter: testInfoGetter{}, admin: true, wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := newTestConfigService(t, tt.infoGetter, &memoryClient{})
+			gin.SetMode(gin.TestMode)
+			engine := gin.New()
+			engine.GET("/configer/admin/clients", cs.ListClients)
+			engine.DELETE("/configer/admin/clients/:cluster", cs.EvictClient)
+			for _, req := range []*http.Request{
+				httptest.NewRequest(http.MethodGet, "/configer/admin/clients", nil),
+				httptest.NewRequest(http.MethodDelete, "/configer/admin/clients/test", nil),
+			} {
+				if tt.admin {
+					req.Header.Set("X-Admin", "true")
+				}
+				w := httptest.NewRecorder()
+				engine.ServeHTTP(w, req)
+				if w.Code != tt.wantCode {
+					t.Errorf("%s %s code = %d, want %d", req.Method, req.URL.Path, w.Code, tt.wantCode)
+				}
+			}
+			if evicted := len(cs.clients.List()) == 0; evicted != (tt.wantCode == http.StatusOK) {
+				t.Errorf("client evicted = %v", evicted)
+			}
+		})
+	}
+}
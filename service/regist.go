@@ -1,10 +1,14 @@
 package service
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"kubegems.io/configer/client"
+	"kubegems.io/configer/controller"
+	ctrl "sigs.k8s.io/controller-runtime"
 )
 
 type InfoGetter interface {
@@ -14,6 +18,25 @@ type InfoGetter interface {
 	Username(c *gin.Context) string
 }
 
+// TLSInfoGetter is optionally implemented by the InfoGetter if the backends of clusters require tls
+type TLSInfoGetter interface {
+	// TLSConfigOf returns nil if the backend of the cluster does not use tls
+	TLSConfigOf(clusterName string) (*client.TLSConfig, error)
+}
+
+// ApplicationAccountsGetter is optionally implemented by the InfoGetter if some projects use per-application accounts
+type ApplicationAccountsGetter interface {
+	// ApplicationAccountsOf reports whether the applications of the project have their own accounts
+	ApplicationAccountsOf(tenant, project string) bool
+}
+
+// ProjectsGetter is optionally implemented by the InfoGetter to list the projects, the nacos facade
+// resolves the tenant ids of the projects without config items in database by it
+type ProjectsGetter interface {
+	// Projects returns the pairs of tenant and project
+	Projects() ([][2]string, error)
+}
+
 type ConfigerHandler struct {
 	*ConfigService
 	db *gorm.DB
@@ -27,11 +50,51 @@ func (p *Plugin) InitDatabase() error {
 	return Migrate(p.Handler.db)
 }
 
+// BindingAuthorizer is optionally implemented by the InfoGetter to allow the ConfigBindings in the namespace
+// to read the configs of the environment of item, otherwise no ConfigBinding is synced
+type BindingAuthorizer interface {
+	AuthorizeBinding(ctx context.Context, namespace string, item *client.ConfigItem) error
+}
+
+// SetupController registers the ConfigBinding controller, which syncs config items into ConfigMaps and Secrets,
+// and resolves the references to kubernetes secrets by the manager
+func (p *Plugin) SetupController(mgr ctrl.Manager) error {
+	if err := controller.AddToScheme(mgr.GetScheme()); err != nil {
+		return err
+	}
+	k8sSecrets := &K8sSecretResolver{Reader: mgr.GetAPIReader()}
+	if getter, ok := p.Handler.InfoGetter.(SecretNamespacesGetter); ok {
+		k8sSecrets.Namespaces = getter.SecretNamespacesOf
+	}
+	p.Handler.Resolvers[SchemeK8sSecret] = client.CachedResolver(k8sSecrets, DefaultReferenceCacheTTL)
+	reconciler := &controller.ConfigBindingReconciler{
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Clients: p.Handler.ConfigService,
+	}
+	if authorizer, ok := p.Handler.InfoGetter.(BindingAuthorizer); ok {
+		reconciler.Authorize = authorizer.AuthorizeBinding
+	}
+	return reconciler.SetupWithManager(mgr)
+}
+
 func NewPlugin(infoGetter InfoGetter, db *gorm.DB) (*Plugin, error) {
 	handler := &ConfigerHandler{
 		ConfigService: NewConfigService(infoGetter, db),
 		db:            db,
 	}
+	key, err := credentialKeyOf(infoGetter)
+	if err != nil {
+		return nil, err
+	}
+	handler.CredentialKey = key
+	handler.KeyProvider = keyProviderFromEnv()
+	if vault := vaultResolverFromEnv(); vault != nil {
+		if getter, ok := infoGetter.(SecretPathsGetter); ok {
+			vault.Paths = getter.SecretPathsOf
+		}
+		handler.Resolvers[SchemeSecret] = client.CachedResolver(vault, DefaultReferenceCacheTTL)
+	}
 	return &Plugin{
 		Handler: *handler,
 	}, nil
@@ -44,6 +107,10 @@ func (h *ConfigerHandler) RegistRouter(rg *gin.RouterGroup) {
 	rg.GET("/configer/tenant/:tenant/project/:project/environment/:environment/baseinfo", h.BaseInfo)
 	// get accounts
 	rg.GET("/configer/tenant/:tenant/project/:project/environment/:environment/accounts", h.AccountInfo)
+	// rotate accounts
+	rg.POST("/configer/tenant/:tenant/project/:project/environment/:environment/accounts/action/rotate", h.RotateAccounts)
+	// get the data key of the project by the account of the environment
+	rg.POST("/configer/tenant/:tenant/project/:project/environment/:environment/datakey", h.DataKey)
 	// get config item detail
 	rg.GET("/configer/tenant/:tenant/project/:project/environment/:environment/key/:key", h.Get)
 	// publish config item
@@ -54,9 +121,51 @@ func (h *ConfigerHandler) RegistRouter(rg *gin.RouterGroup) {
 	rg.GET("/configer/tenant/:tenant/project/:project/environment/:environment/key/:key/history", h.History)
 	// show config item listener
 	rg.GET("/configer/tenant/:tenant/project/:project/environment/:environment/key/:key/listener", h.Listener)
+	// reveal the value of a sensitive config item
+	rg.POST("/configer/tenant/:tenant/project/:project/environment/:environment/key/:key/action/reveal", h.Reveal)
+	// get config item value with the references expanded
+	rg.GET("/configer/tenant/:tenant/project/:project/environment/:environment/key/:key/rendered", h.Rendered)
+
+	// config items of the base layer, inherited by every environment of the project
+	rg.GET("/configer/tenant/:tenant/project/:project/base", h.ListBase)
+	rg.GET("/configer/tenant/:tenant/project/:project/base/key/:key", h.GetBase)
+	rg.POST("/configer/tenant/:tenant/project/:project/base/key/:key", h.PubBase)
+	rg.DELETE("/configer/tenant/:tenant/project/:project/base/key/:key", h.DeleteBase)
+
+	// project variables referred by ${var:name}
+	rg.GET("/configer/tenant/:tenant/project/:project/variables", h.ListVariables)
+	rg.PUT("/configer/tenant/:tenant/project/:project/variables/:name", h.SetVariable)
+	rg.DELETE("/configer/tenant/:tenant/project/:project/variables/:name", h.DeleteVariable)
+
+	// publish the config items of a template which do not exist in the environment
+	rg.POST("/configer/tenant/:tenant/project/:project/environment/:environment/action/instantiate", h.Instantiate)
 
 	// sync backend data to database
 	rg.POST("/configer/tenant/:tenant/project/:project/environment/:environment/action/backup", h.SyncBackend2Database)
 	rg.POST("/configer/tenant/:tenant/project/:project/environment/:environment/action/restore", h.SyncDatabase2Backend)
 
+	// spring cloud config server compatible api, readonly
+	rg.GET("/configer/springcloud/tenant/:tenant/project/:project/:application/:profile", h.SpringCloudEnvironment)
+	rg.GET("/configer/springcloud/tenant/:tenant/project/:project/:application/:profile/:label", h.SpringCloudEnvironment)
+
+	// nacos open api compatible config api, nacos client's contextPath should be {configer}/configer/nacos
+	rg.GET("/configer"+client.CONFIG_PATH, h.NacosGetConfig)
+	rg.POST("/configer"+client.CONFIG_PATH, h.NacosPubConfig)
+	rg.DELETE("/configer"+client.CONFIG_PATH, h.NacosDeleteConfig)
+	rg.POST("/configer"+client.LISTENER_PATH, h.NacosListener)
+
+	// config templates of the tenant
+	rg.GET("/configer/tenant/:tenant/templates", h.ListTemplates)
+	rg.GET("/configer/tenant/:tenant/templates/:name", h.GetTemplate)
+	rg.PUT("/configer/tenant/:tenant/templates/:name", h.SetTemplate)
+	rg.DELETE("/configer/tenant/:tenant/templates/:name", h.DeleteTemplate)
+
+	// cached backend clients
+	rg.GET("/configer/admin/clients", h.ListClients)
+	rg.DELETE("/configer/admin/clients/:cluster", h.EvictClient)
+
+	// openapi document of the routes above
+	rg.GET("/configer/openapi.json", h.OpenAPIJSON)
+	rg.GET("/configer/openapi.yaml", h.OpenAPIYAML)
+
 }
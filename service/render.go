@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"kubegems.io/configer/client"
+)
+
+/*
+配置值中可以引用同一环境下的其他配置项和项目变量, 在读取时展开:
+	${key:common.yaml#db.host}    common.yaml 中的 db.host, 字段按 spring 的格式展开, 如 a.b[0].c
+	${key:common.yaml}            common.yaml 的整个值
+	${var:name}                   项目变量 name
+被引用的配置项中的引用也会展开, 循环引用返回错误
+项目使用应用账号时, 应用的配置项只能引用本应用的配置项和共享的配置项
+*/
+
+const (
+	SchemeKey = "key"
+	SchemeVar = "var"
+)
+
+// RenderedConfig is the value with all the references expanded
+type RenderedConfig struct {
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	Sensitive bool   `json:"sensitive"`
+	// Dependencies are the references used, including the ones in the keys referred
+	Dependencies []RenderDependency `json:"dependencies"`
+}
+
+// RenderDependency is a reference in the value of Key
+type RenderDependency struct {
+	Key       string `json:"key"`
+	Reference string `json:"reference"`
+}
+
+// renderer expands the references of the values in an environment, the keys being expanded are kept to detect cycles
+type renderer struct {
+	cs           *ConfigService
+	cli          client.ConfigClientIface
+	stack        []string
+	dependencies []RenderDependency
+}
+
+// Render replaces the references in the value of item by the values they refer, for applications
+func (cs *ConfigService) Render(ctx context.Context, item *client.ConfigItem) error {
+	_, cli, err := cs.ClientOf(item)
+	if err != nil {
+		return err
+	}
+	_, err = cs.render(ctx, cli, item)
+	return err
+}
+
+// render expands the value of item and returns the dependencies
+func (cs *ConfigService) render(ctx context.Context, cli client.ConfigClientIface, item *client.ConfigItem) ([]RenderDependency, error) {
+	r := &renderer{cs: cs, cli: cli}
+	value, err := r.render(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	item.Value = value
+	return r.dependencies, nil
+}
+
+func (r *renderer) render(ctx context.Context, item *client.ConfigItem) (string, error) {
+	for i, key := range r.stack {
+		if key == item.Key {
+			return "", client.InvalidArgumentError("reference cycle %s", strings.Join(append(r.stack[i:], key), " -> "))
+		}
+	}
+	r.stack = append(r.stack, item.Key)
+	defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+
+	resolvers := client.ReferenceResolvers{}
+	for scheme, resolver := range r.cs.Resolvers {
+		resolvers[scheme] = r.track(resolver)
+	}
+	resolvers[SchemeKey] = r.track(client.ReferenceResolverFunc(r.resolveKey))
+	resolvers[SchemeVar] = r.track(client.ReferenceResolverFunc(r.resolveVar))
+	return resolvers.Render(ctx, item)
+}
+
+// track records the references resolved
+func (r *renderer) track(resolver client.ReferenceResolver) client.ReferenceResolver {
+	return client.ReferenceResolverFunc(func(ctx context.Context, item *client.ConfigItem, ref client.Reference) (string, error) {
+		dep := RenderDependency{Key: item.Key, Reference: ref.String()}
+		exists := false
+		for _, d := range r.dependencies {
+			exists = exists || d == dep
+		}
+		if !exists {
+			r.dependencies = append(r.dependencies, dep)
+		}
+		return resolver.Resolve(ctx, item, ref)
+	})
+}
+
+func (r *renderer) resolveKey(ctx context.Context, item *client.ConfigItem, ref client.Reference) (string, error) {
+	if err := r.cs.checkKeyReference(ctx, item, ref.Path); err != nil {
+		return "", err
+	}
+	target := &client.ConfigItem{
+		Tenant:      item.Tenant,
+		Project:     item.Project,
+		Environment: item.Environment,
+		Application: item.Application,
+		Key:         ref.Path,
+	}
+	if err := r.cli.Get(ctx, target); err != nil {
+		return "", fmt.Errorf("get %s referred by %s failed, %w", ref.Path, item.Key, err)
+	}
+	value, err := r.render(ctx, target)
+	if err != nil {
+		return "", err
+	}
+	if ref.Field == "" {
+		return value, nil
+	}
+	data, err := parseValue(formatOf(target.Key), value)
+	if err != nil {
+		return "", client.InvalidArgumentError("%s referred by %s is not structured, %v", ref.Path, item.Key, err)
+	}
+	fields := map[string]interface{}{}
+	flatten("", data, fields)
+	field, ok := fields[ref.Field]
+	if !ok {
+		return "", client.NotFoundError("field %s not found in %s", ref.Field, ref.Path)
+	}
+	if field == nil {
+		return "", nil
+	}
+	return fmt.Sprint(field), nil
+}
+
+func (r *renderer) resolveVar(ctx context.Context, item *client.ConfigItem, ref client.Reference) (string, error) {
+	variable := ProjectVariable{}
+	result := r.cs.db.WithContext(ctx).Limit(1).Find(&variable, ProjectVariable{Tenant: item.Tenant, Project: item.Project, Name: ref.Path})
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", client.NotFoundError("variable %s of project %s/%s not found", ref.Path, item.Tenant, item.Project)
+	}
+	return variable.Value, nil
+}
+
+// IsSensitive reports whether the rendered value of item is sensitive, that is the item is sensitive
+// or it refers secrets or sensitive keys, the references are checked without being resolved
+func (cs *ConfigService) IsSensitive(ctx context.Context, item *client.ConfigItem) (bool, error) {
+	_, cli, err := cs.ClientOf(item)
+	if err != nil {
+		return false, err
+	}
+	return cs.isSensitiveRendering(ctx, cli, item, map[string]bool{})
+}
+
+func (cs *ConfigService) isSensitiveRendering(ctx context.Context, cli client.ConfigClientIface, item *client.ConfigItem, visited map[string]bool) (bool, error) {
+	// the cycles are reported when rendering
+	if visited[item.Key] {
+		return false, nil
+	}
+	visited[item.Key] = true
+	if err := fillSensitive(item, cs.db.WithContext(ctx)); err != nil {
+		return false, err
+	}
+	if cs.isSensitive(item) {
+		return true, nil
+	}
+	for _, ref := range client.ParseReferences(item.Value) {
+		switch ref.Scheme {
+		case SchemeVar:
+		case SchemeKey:
+			if err := cs.checkKeyReference(ctx, item, ref.Path); err != nil {
+				return false, err
+			}
+			target := &client.ConfigItem{
+				Tenant:      item.Tenant,
+				Project:     item.Project,
+				Environment: item.Environment,
+				Application: item.Application,
+				Key:         ref.Path,
+			}
+			if err := cli.Get(ctx, target); err != nil {
+				if errors.Is(err, client.ErrNotFound) {
+					// reported when rendering
+					continue
+				}
+				return false, err
+			}
+			sensitive, err := cs.isSensitiveRendering(ctx, cli, target, visited)
+			if err != nil || sensitive {
+				return sensitive, err
+			}
+		default:
+			// secrets, the unknown schemes are kept as is
+			if _, ok := cs.Resolvers[ref.Scheme]; ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Rendered returns the value of the config item with the references expanded and the dependencies,
+// the value is masked without being expanded if the item or any key it refers is sensitive, or it refers secrets
+func (cs *ConfigService) Rendered(c *gin.Context) {
+	item := buildConfigItemFromReq(c)
+	ret := &RenderedConfig{Key: item.Key, Dependencies: []RenderDependency{}}
+	if err := cs.withItem(c, item, func(ctx *gin.Context, cli client.ConfigClientIface) error {
+		if err := cli.Get(ctx, item); err != nil {
+			return err
+		}
+		// checked before rendering, so the secrets referred are not read and their errors not reported
+		sensitive, err := cs.isSensitiveRendering(ctx, cli, item, map[string]bool{})
+		if err != nil {
+			return err
+		}
+		if sensitive {
+			ret.Value, ret.Sensitive = MaskedValue, true
+			return nil
+		}
+		dependencies, err := cs.render(ctx, cli, item)
+		if err != nil {
+			return err
+		}
+		ret.Value, ret.Dependencies = item.Value, dependencies
+		return nil
+	}); err != nil {
+		NotOK(c, err)
+		return
+	}
+	OK(c, ret)
+}
+
+// checkKeyReference refuses the references of an application to the keys of other applications,
+// if the project uses per-application accounts only the keys of the application and the shared keys can be referred
+func (cs *ConfigService) checkKeyReference(ctx context.Context, item *client.ConfigItem, key string) error {
+	getter, ok := cs.InfoGetter.(ApplicationAccountsGetter)
+	if !ok || item.Application == "" || !getter.ApplicationAccountsOf(item.Tenant, item.Project) {
+		return nil
+	}
+	if strings.HasPrefix(key, item.Application+client.ApplicationKeyDelimiter) {
+		return nil
+	}
+	dbitems := []ConfigItem{}
+	if err := cs.db.WithContext(ctx).Limit(1).Find(&dbitems, ConfigItem{
+		Tenant:      item.Tenant,
+		Project:     item.Project,
+		Environment: item.Environment,
+		Key:         key,
+	}).Error; err != nil {
+		return err
+	}
+	if len(dbitems) > 0 && dbitems[0].Application == "" {
+		return nil
+	}
+	return client.UnauthorizedError("application %s can not refer %s in %s, which is neither its key nor a shared key", item.Application, key, item.Key)
+}
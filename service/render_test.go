@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"kubegems.io/configer/client"
+)
+
+func TestConfigService_Render(t *testing.T) {
+	cli := &memoryClient{values: map[string]string{
+		"common.yaml":      "db:\n  host: ${key:hosts.properties#db}\n  port: 3306\nreplicas: [a, b]\n",
+		"hosts.properties": "db = mysql.local\n",
+		"a.yaml":           "v: ${key:b.yaml#v}",
+		"b.yaml":           "v: ${key:a.yaml#v}",
+	}}
+	tests := []struct {
+		name     string
+		value    string
+		want     string
+		wantDeps []RenderDependency
+		wantErr  bool
+	}{
+		{
+			name:  "nested references",
+			value: "url: ${key:common.yaml#db.host}:${key:common.yaml#db.port}/${key:common.yaml#replicas[1]}",
+			want:  "url: mysql.local:3306/b",
+			wantDeps: []RenderDependency{
+				{Key: "app.yaml", Reference: "${key:common.yaml#db.host}"},
+				{Key: "common.yaml", Reference: "${key:hosts.properties#db}"},
+				{Key: "app.yaml", Reference: "${key:common.yaml#db.port}"},
+				{Key: "app.yaml", Reference: "${key:common.yaml#replicas[1]}"},
+			},
+		},
+		{name: "whole value", value: "${key:hosts.properties}", want: "db = mysql.local\n", wantDeps: []RenderDependency{{Key: "app.yaml", Reference: "${key:hosts.properties}"}}},
+		{name: "missing field", value: "${key:common.yaml#db.user}", wantErr: true},
+		{name: "missing key", value: "${key:other.yaml#db}", wantErr: true},
+		{name: "cycle", value: "${key:a.yaml#v}", wantErr: true},
+		{name: "self", value: "${key:app.yaml}", wantErr: true},
+	}
+	cs := &ConfigService{Resolvers: client.ReferenceResolvers{}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := &client.ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1", Key: "app.yaml", Value: tt.value}
+			deps, err := cs.render(context.Background(), cli, item)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if item.Value != tt.want {
+				t.Errorf("render() value = %q, want %q", item.Value, tt.want)
+			}
+			if !reflect.DeepEqual(deps, tt.wantDeps) {
+				t.Errorf("render() dependencies = %v, want %v", deps, tt.wantDeps)
+			}
+		})
+	}
+
+	item := &client.ConfigItem{Key: "x.yaml", Value: "${key:a.yaml#v}"}
+	if _, err := cs.render(context.Background(), cli, item); !errors.Is(err, client.ErrInvalidArgument) {
+		t.Errorf("render() cycle error = %v, want InvalidArgument", err)
+	}
+}
+
+// applicationAccountsInfoGetter enables per-application accounts in the project p1
+type applicationAccountsInfoGetter struct {
+	testInfoGetter
+}
+
+func (applicationAccountsInfoGetter) ApplicationAccountsOf(tenant, project string) bool {
+	return project == "p1"
+}
+
+func TestConfigService_RenderApplicationReferences(t *testing.T) {
+	cli := &memoryClient{values: map[string]string{
+		"app1.db.yaml": "host: db1",
+		"app2.db.yaml": "host: db2",
+	}}
+	cs := newTestConfigService(t, applicationAccountsInfoGetter{}, cli)
+	tests := []struct {
+		name        string
+		project     string
+		application string
+		value       string
+		want        string
+		wantCode    client.ErrorCode
+	}{
+		{name: "own key", project: "p1", application: "app1", value: "${key:app1.db.yaml#host}", want: "db1"},
+		{name: "key of another application", project: "p1", application: "app1", value: "${key:app2.db.yaml#host}", wantCode: client.ErrorCodeUnauthorized},
+		{name: "key of an application with the same prefix", project: "p1", application: "app", value: "${key:app1.db.yaml#host}", wantCode: client.ErrorCodeUnauthorized},
+		{name: "environment config", project: "p1", value: "${key:app2.db.yaml#host}", want: "db2"},
+		{name: "project without application accounts", project: "p2", application: "app1", value: "${key:app2.db.yaml#host}", want: "db2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := &client.ConfigItem{Tenant: "t1", Project: tt.project, Environment: "e1", Application: tt.application, Key: tt.application + ".app.yaml", Value: tt.value}
+			_, err := cs.render(context.Background(), cli, item)
+			if tt.wantCode != "" {
+				if e := (*client.Error)(nil); !errors.As(err, &e) || e.Code != tt.wantCode {
+					t.Fatalf("render() error = %v, want code %s", err, tt.wantCode)
+				}
+				sensitiveItem := &client.ConfigItem{Tenant: "t1", Project: tt.project, Environment: "e1", Application: tt.application, Key: item.Key, Value: tt.value}
+				if _, err := cs.isSensitiveRendering(context.Background(), cli, sensitiveItem, map[string]bool{}); !errors.Is(err, client.ErrUnauthorized) {
+					t.Errorf("isSensitiveRendering() error = %v, want Unauthorized", err)
+				}
+				return
+			}
+			if err != nil || item.Value != tt.want {
+				t.Errorf("render() value = %q, error = %v, want %q", item.Value, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigService_Rendered(t *testing.T) {
+	cli := &memoryClient{values: map[string]string{
+		"app.yaml":    "host: ${key:common.yaml#host}",
+		"common.yaml": "host: db",
+		"db.password": "secret",
+		"secret.yaml": "password: ${secret:kv/data/missing#password}",
+		"ref.yaml":    "password: ${key:db.password}",
+	}}
+	cs := newTestConfigService(t, testInfoGetter{}, cli)
+	resolved := 0
+	cs.Resolvers[SchemeSecret] = client.ReferenceResolverFunc(func(ctx context.Context, item *client.ConfigItem, ref client.Reference) (string, error) {
+		resolved++
+		return "", client.NotFoundError("vault secret %s not found", ref.Path)
+	})
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/configer/tenant/:tenant/project/:project/environment/:environment/key/:key/rendered", cs.Rendered)
+
+	tests := []struct {
+		key      string
+		want     RenderedConfig
+		wantCode int
+	}{
+		{
+			key: "app.yaml",
+			want: RenderedConfig{Key: "app.yaml", Value: "host: db", Dependencies: []RenderDependency{
+				{Key: "app.yaml", Reference: "${key:common.yaml#host}"},
+			}},
+			wantCode: http.StatusOK,
+		},
+		{key: "secret.yaml", want: RenderedConfig{Key: "secret.yaml", Value: MaskedValue, Sensitive: true, Dependencies: []RenderDependency{}}, wantCode: http.StatusOK},
+		{key: "ref.yaml", want: RenderedConfig{Key: "ref.yaml", Value: MaskedValue, Sensitive: true, Dependencies: []RenderDependency{}}, wantCode: http.StatusOK},
+		{key: "missing.yaml", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/configer/tenant/t1/project/p1/environment/e1/key/"+tt.key+"/rendered", nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("Rendered() code = %d, want %d, body = %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			ret := struct {
+				Data RenderedConfig `json:"data"`
+			}{}
+			if err := json.Unmarshal(w.Body.Bytes(), &ret); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ret.Data, tt.want) {
+				t.Errorf("Rendered() = %v, want %v", ret.Data, tt.want)
+			}
+		})
+	}
+	if resolved != 0 {
+		t.Errorf("Rendered() resolved %d secrets of sensitive configs, want none", resolved)
+	}
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"kubegems.io/configer/client"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+/*
+配置值中可以引用密钥, 而不是把密钥复制到配置中, 引用在为应用渲染配置时解析:
+	${secret:kv/data/app#password}    vault 中 kv/data/app 的 password 字段
+	${k8s-secret:ns/name#key}         kubernetes 中 ns 命名空间下 name secret 的 key
+项目只能引用 InfoGetter 允许的 vault 路径和命名空间, 未配置时拒绝引用
+界面和 History 中仍然显示未解析的引用
+*/
+
+const (
+	SchemeSecret    = "secret"
+	SchemeK8sSecret = "k8s-secret"
+	// DefaultReferenceCacheTTL is how long the resolved secrets are cached, the nacos listener reads the configs every second
+	DefaultReferenceCacheTTL = 30 * time.Second
+)
+
+// SecretNamespacesGetter is optionally implemented by the InfoGetter to list the namespaces
+// whose secrets the configs of the project can refer, otherwise no namespace can be referred
+type SecretNamespacesGetter interface {
+	SecretNamespacesOf(tenant, project string) []string
+}
+
+// SecretPathsGetter is optionally implemented by the InfoGetter to list the vault path prefixes
+// the configs of the project can refer, such as kv/data/tenant/project, otherwise no path can be referred
+type SecretPathsGetter interface {
+	SecretPathsOf(tenant, project string) []string
+}
+
+// VaultResolver resolves ${secret:path#field} by reading the secret path of vault, both kv v1 and v2 are supported
+type VaultResolver struct {
+	Address string
+	Token   string
+	Client  *http.Client
+	// Paths returns the path prefixes the configs of the project can refer, nil refuses all the paths
+	Paths func(tenant, project string) []string
+}
+
+// vaultResolverFromEnv returns nil if VAULT_ADDR is not set
+func vaultResolverFromEnv() *VaultResolver {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return nil
+	}
+	return &VaultResolver{
+		Address: strings.TrimSuffix(addr, "/"),
+		Token:   os.Getenv("VAULT_TOKEN"),
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (v *VaultResolver) Resolve(ctx context.Context, item *client.ConfigItem, ref client.Reference) (string, error) {
+	if v.Paths == nil || !hasPathPrefix(v.Paths(item.Tenant, item.Project), ref.Path) {
+		return "", client.UnauthorizedError("project %s/%s can not refer vault secret %s", item.Tenant, item.Project, ref.Path)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.Address+"/v1/"+strings.TrimPrefix(ref.Path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return "", client.BackendUnavailableError("read vault secret %s failed, %v", ref.Path, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", client.NotFoundError("vault secret %s not found", ref.Path)
+	case http.StatusForbidden:
+		return "", client.UnauthorizedError("read vault secret %s forbidden", ref.Path)
+	default:
+		return "", client.BackendUnavailableError("read vault secret %s failed, status %d", ref.Path, resp.StatusCode)
+	}
+	secret := struct {
+		Data map[string]interface{} `json:"data"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("decode vault secret %s failed, %w", ref.Path, err)
+	}
+	data := secret.Data
+	// kv v2 nests the fields with the metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+	value, ok := data[ref.Field]
+	if !ok {
+		return "", client.NotFoundError("field %s not found in vault secret %s", ref.Field, ref.Path)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	raw, err := json.Marshal(value)
+	return string(raw), err
+}
+
+// K8sSecretResolver resolves ${k8s-secret:namespace/name#key} by reading the secret from kubernetes
+type K8sSecretResolver struct {
+	Reader ctrlclient.Reader
+	// Namespaces returns the namespaces the configs of the project can refer, nil refuses all the namespaces
+	Namespaces func(tenant, project string) []string
+}
+
+func (k *K8sSecretResolver) Resolve(ctx context.Context, item *client.ConfigItem, ref client.Reference) (string, error) {
+	namespace, name, ok := strings.Cut(ref.Path, "/")
+	if !ok || namespace == "" || name == "" {
+		return "", client.InvalidArgumentError("invalid secret reference %s, should be ${k8s-secret:namespace/name#key}", ref)
+	}
+	if k.Namespaces == nil || !contains(k.Namespaces(item.Tenant, item.Project), namespace) {
+		return "", client.UnauthorizedError("project %s/%s can not refer secrets in namespace %s", item.Tenant, item.Project, namespace)
+	}
+	secret := &corev1.Secret{}
+	if err := k.Reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", client.NotFoundError("secret %s not found", ref.Path)
+		}
+		return "", client.BackendUnavailableError("read secret %s failed, %v", ref.Path, err)
+	}
+	value, ok := secret.Data[ref.Field]
+	if !ok {
+		return "", client.NotFoundError("key %s not found in secret %s", ref.Field, ref.Path)
+	}
+	return string(value), nil
+}
+
+// hasPathPrefix reports whether the path is one of the prefixes or under it, paths with . or .. segments are refused
+func hasPathPrefix(prefixes []string, path string) bool {
+	path = strings.Trim(path, "/")
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	for _, prefix := range prefixes {
+		prefix = strings.Trim(prefix, "/")
+		if prefix != "" && (path == prefix || strings.HasPrefix(path, prefix+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubegems.io/configer/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestVaultResolver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/kv/data/app":
+			w.Write([]byte(`{"data": {"data": {"password": "v2"}, "metadata": {"version": 1}}}`))
+		case "/v1/secret/app":
+			w.Write([]byte(`{"data": {"password": "v1", "port": 3306}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		token    string
+		ref      client.Reference
+		noPaths  bool
+		want     string
+		wantCode client.ErrorCode
+	}{
+		{name: "kv v2", token: "token", ref: client.Reference{Path: "kv/data/app", Field: "password"}, want: "v2"},
+		{name: "kv v1", token: "token", ref: client.Reference{Path: "secret/app", Field: "password"}, want: "v1"},
+		{name: "not a string", token: "token", ref: client.Reference{Path: "secret/app", Field: "port"}, want: "3306"},
+		{name: "missing field", token: "token", ref: client.Reference{Path: "secret/app", Field: "user"}, wantCode: client.ErrorCodeNotFound},
+		{name: "missing secret", token: "token", ref: client.Reference{Path: "secret/other", Field: "password"}, wantCode: client.ErrorCodeNotFound},
+		{name: "forbidden", token: "other", ref: client.Reference{Path: "secret/app", Field: "password"}, wantCode: client.ErrorCodeUnauthorized},
+		{name: "path not allowed", token: "token", ref: client.Reference{Path: "kv/data/other", Field: "password"}, wantCode: client.ErrorCodeUnauthorized},
+		{name: "path prefix of another segment", token: "token", ref: client.Reference{Path: "secret-other/app", Field: "password"}, wantCode: client.ErrorCodeUnauthorized},
+		{name: "path escaping the prefix", token: "token", ref: client.Reference{Path: "secret/../kv/data/other", Field: "password"}, wantCode: client.ErrorCodeUnauthorized},
+		{name: "no paths allowed", token: "token", ref: client.Reference{Path: "secret/app", Field: "password"}, noPaths: true, wantCode: client.ErrorCodeUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &VaultResolver{Address: server.URL, Token: tt.token, Client: server.Client()}
+			if !tt.noPaths {
+				v.Paths = func(tenant, project string) []string { return []string{"kv/data/app", "secret/"} }
+			}
+			got, err := v.Resolve(context.Background(), &client.ConfigItem{Tenant: "t1", Project: "p1"}, tt.ref)
+			if tt.wantCode != "" {
+				if e := (*client.Error)(nil); !errors.As(err, &e) || e.Code != tt.wantCode {
+					t.Fatalf("Resolve() error = %v, want code %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Resolve() = %s, error = %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestK8sSecretResolver(t *testing.T) {
+	reader := fake.NewClientBuilder().WithObjects(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "db"}, Data: map[string][]byte{"password": []byte("secret")}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "db"}, Data: map[string][]byte{"password": []byte("system")}},
+	).Build()
+	namespaces := func(tenant, project string) []string {
+		if tenant == "t1" && project == "p1" {
+			return []string{"ns1"}
+		}
+		return nil
+	}
+	tests := []struct {
+		name         string
+		project      string
+		noNamespaces bool
+		ref          client.Reference
+		want         string
+		wantCode     client.ErrorCode
+	}{
+		{name: "allowed namespace", project: "p1", ref: client.Reference{Path: "ns1/db", Field: "password"}, want: "secret"},
+		{name: "missing key", project: "p1", ref: client.Reference{Path: "ns1/db", Field: "user"}, wantCode: client.ErrorCodeNotFound},
+		{name: "missing secret", project: "p1", ref: client.Reference{Path: "ns1/other", Field: "password"}, wantCode: client.ErrorCodeNotFound},
+		{name: "namespace not allowed", project: "p1", ref: client.Reference{Path: "kube-system/db", Field: "password"}, wantCode: client.ErrorCodeUnauthorized},
+		{name: "project without namespaces", project: "p2", ref: client.Reference{Path: "ns1/db", Field: "password"}, wantCode: client.ErrorCodeUnauthorized},
+		{name: "no namespaces allowed", project: "p1", noNamespaces: true, ref: client.Reference{Path: "ns1/db", Field: "password"}, wantCode: client.ErrorCodeUnauthorized},
+		{name: "invalid reference", project: "p1", ref: client.Reference{Path: "db", Field: "password"}, wantCode: client.ErrorCodeInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &K8sSecretResolver{Reader: reader}
+			if !tt.noNamespaces {
+				k.Namespaces = namespaces
+			}
+			got, err := k.Resolve(context.Background(), &client.ConfigItem{Tenant: "t1", Project: tt.project}, tt.ref)
+			if tt.wantCode != "" {
+				if e := (*client.Error)(nil); !errors.As(err, &e) || e.Code != tt.wantCode {
+					t.Fatalf("Resolve() error = %v, want code %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Resolve() = %s, error = %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"kubegems.io/configer/client"
+)
+
+// MaskedValue replaces the values of sensitive keys in responses
+const MaskedValue = "******"
+
+// DefaultSensitivePatterns are the patterns of the keys which are sensitive without flagged
+var DefaultSensitivePatterns = []string{"*password*", "*passwd*", "*secret*", "*token*", "*credential*", "*.key", "*.pem"}
+
+// RevealAuthorizer is optionally implemented by the InfoGetter to check who can reveal sensitive values,
+// otherwise anyone allowed to call the reveal api can
+type RevealAuthorizer interface {
+	CanReveal(c *gin.Context, tenant, project, environment string) bool
+}
+
+// isSensitive reports whether the item is flagged sensitive or encrypted, or its key matches SensitivePatterns, case insensitive
+func (cs *ConfigService) isSensitive(item *client.ConfigItem) bool {
+	if item.Sensitive != nil && *item.Sensitive {
+		return true
+	}
+	// encrypted values are at least as sensitive as the flagged ones
+	if item.Encrypted != nil && *item.Encrypted {
+		return true
+	}
+	key := strings.ToLower(item.Key)
+	for _, pattern := range cs.SensitivePatterns {
+		if matched, _ := path.Match(strings.ToLower(pattern), key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// mask replaces the values of the sensitive items by MaskedValue
+func (cs *ConfigService) mask(items ...*client.ConfigItem) {
+	for _, item := range items {
+		if !cs.isSensitive(item) {
+			continue
+		}
+		sensitive := true
+		item.Value, item.Sensitive = MaskedValue, &sensitive
+	}
+}
+
+// checkNotMasked returns an error if the value to publish is the masked value of a sensitive item, such as an exported one
+func (cs *ConfigService) checkNotMasked(item *client.ConfigItem) error {
+	if item.Value != MaskedValue {
+		return nil
+	}
+	probe := *item
+	if probe.Sensitive == nil {
+		if err := fillSensitive(&probe, cs.db); err != nil {
+			return err
+		}
+	}
+	if cs.isSensitive(&probe) {
+		return client.InvalidArgumentError("the masked value of %s can not be published", item.Key)
+	}
+	return nil
+}
+
+// checkNotMaskedRendering is checkNotMasked for the values read rendered, such as by the nacos facade,
+// which are masked too if the current value refers secrets or sensitive keys
+func (cs *ConfigService) checkNotMaskedRendering(ctx context.Context, cli client.ConfigClientIface, item *client.ConfigItem) error {
+	if err := cs.checkNotMasked(item); err != nil || item.Value != MaskedValue {
+		return err
+	}
+	current := *item
+	if err := cli.Get(ctx, &current); err != nil {
+		if errors.Is(err, client.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	sensitive, err := cs.isSensitiveRendering(ctx, cli, &current, map[string]bool{})
+	if err != nil {
+		return err
+	}
+	if sensitive {
+		return client.InvalidArgumentError("the masked value of %s can not be published", item.Key)
+	}
+	return nil
+}
+
+// fillSensitive sets the sensitive flag of the item from database
+func fillSensitive(item *client.ConfigItem, db *gorm.DB) error {
+	dbitems := []ConfigItem{}
+	if err := db.Limit(1).Find(&dbitems, ConfigItem{
+		Tenant:      item.Tenant,
+		Project:     item.Project,
+		Environment: item.Environment,
+		Key:         item.Key,
+	}).Error; err != nil {
+		return err
+	}
+	sensitive := len(dbitems) > 0 && dbitems[0].Sensitive
+	item.Sensitive = &sensitive
+	return nil
+}
+
+// Reveal returns the config item with the value even if it is sensitive
+func (cs *ConfigService) Reveal(c *gin.Context) {
+	item := buildConfigItemFromReq(c)
+	if err := cs.withItem(c, item, func(ctx *gin.Context, cli client.ConfigClientIface) error {
+		c.Set("audit_subject", map[string]string{
+			"action": "查看",
+			"module": "敏感配置项",
+			"name":   item.Key,
+		})
+		if !cs.canReveal(c, item) {
+			return client.UnauthorizedError("%s can not reveal the config %s", cs.Username(c), item.Key)
+		}
+		if err := cli.Get(c, item); err != nil {
+			return err
+		}
+		return fillSensitive(item, cs.db)
+	}); err != nil {
+		NotOK(c, err)
+		return
+	}
+	OK(c, item)
+}
+
+// canReveal reports whether the user can read the sensitive values of the environment of item
+func (cs *ConfigService) canReveal(c *gin.Context, item *client.ConfigItem) bool {
+	authorizer, ok := cs.InfoGetter.(RevealAuthorizer)
+	return !ok || authorizer.CanReveal(c, item.Tenant, item.Project, item.Environment)
+}
+
+// renderOrMask renders the value of item for the applications. if the rendered value is sensitive, it is rendered only
+// if the user can reveal it, and audited as the reveal api if audit, otherwise it is masked without resolving the references
+func (cs *ConfigService) renderOrMask(c *gin.Context, cli client.ConfigClientIface, item *client.ConfigItem, audit bool) error {
+	sensitive, err := cs.isSensitiveRendering(c, cli, item, map[string]bool{})
+	if err != nil {
+		return err
+	}
+	if sensitive && !cs.canReveal(c, item) {
+		item.Value, item.Sensitive = MaskedValue, &sensitive
+		return nil
+	}
+	if sensitive && audit {
+		name := item.Key
+		// the keys revealed by the same request are audited together
+		if subject, ok := c.Get("audit_subject"); ok {
+			if m, ok := subject.(map[string]string); ok && m["module"] == "敏感配置项" {
+				name = m["name"] + "," + item.Key
+			}
+		}
+		cs.setAuditData(c, cs.ClusterNameOf(item.Tenant, item.Project, item.Environment), item.Tenant, item.Project, item.Environment, item.Application)
+		c.Set("audit_subject", map[string]string{
+			"action": "查看",
+			"module": "敏感配置项",
+			"name":   name,
+		})
+	}
+	_, err = cs.render(c, cli, item)
+	return err
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"testing"
+
+	"kubegems.io/configer/client"
+)
+
+func TestConfigService_Mask(t *testing.T) {
+	flag := func(b bool) *bool { return &b }
+	tests := []struct {
+		name       string
+		item       *client.ConfigItem
+		wantMasked bool
+	}{
+		{name: "plain", item: &client.ConfigItem{Key: "app.yaml", Value: "v"}},
+		{name: "flagged", item: &client.ConfigItem{Key: "app.yaml", Value: "v", Sensitive: flag(true)}, wantMasked: true},
+		{name: "password pattern", item: &client.ConfigItem{Key: "db.Password", Value: "v"}, wantMasked: true},
+		{name: "secret suffix", item: &client.ConfigItem{Key: "app.secret", Value: "v"}, wantMasked: true},
+		{name: "encrypted", item: &client.ConfigItem{Key: "app.yaml", Value: "v", Encrypted: flag(true)}, wantMasked: true},
+		{name: "pattern is not unflagged", item: &client.ConfigItem{Key: "token", Value: "v", Sensitive: flag(false)}, wantMasked: true},
+	}
+	cs := &ConfigService{SensitivePatterns: DefaultSensitivePatterns}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs.mask(tt.item)
+			if masked := tt.item.Value == MaskedValue; masked != tt.wantMasked {
+				t.Errorf("mask() value = %s, wantMasked %v", tt.item.Value, tt.wantMasked)
+			}
+			if tt.wantMasked && (tt.item.Sensitive == nil || !*tt.item.Sensitive) {
+				t.Errorf("masked item should be flagged sensitive")
+			}
+		})
+	}
+}
@@ -3,6 +3,9 @@ package service
 import (
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -11,16 +14,50 @@ import (
 )
 
 type ConfigService struct {
-	clients map[string]client.ConfigClientIface
+	clients *ClientPool
 	InfoGetter
 	db *gorm.DB
+
+	nacosTenants *nacosTenantCache
+	// NacosTimeouts are the timeouts of the nacos clients created after set
+	NacosTimeouts client.NacosTimeouts
+
+	// breakers are kept across clients of the same cluster, so recreating the client does not reset it
+	breakers    map[string]*client.CircuitBreaker
+	breakerLock sync.Mutex
+
+	// SensitivePatterns are the patterns of the keys whose values are masked, besides the keys flagged sensitive
+	SensitivePatterns []string
+
+	// CredentialKey encrypts the passwords of the backend accounts in database,
+	// the passwords are derived from the usernames as before if it is empty, RotateAllAccounts migrates them
+	CredentialKey  []byte
+	credentials    map[string]client.CredentialStore
+	credentialLock sync.Mutex
+
+	// KeyProvider wraps the data keys which encrypt the values of the configs flagged encrypted,
+	// such configs can not be published if it is nil
+	KeyProvider KeyProvider
+	dataKeys    map[string][]byte
+	dataKeyLock sync.Mutex
+
+	// Resolvers resolve the references in values when rendered for applications, by scheme
+	Resolvers client.ReferenceResolvers
 }
 
 func NewConfigService(infoGetter InfoGetter, db *gorm.DB) *ConfigService {
 	return &ConfigService{
-		clients:    make(map[string]client.ConfigClientIface),
-		InfoGetter: infoGetter,
-		db:         db,
+		clients:       NewClientPool(),
+		InfoGetter:    infoGetter,
+		db:            db,
+		nacosTenants:  &nacosTenantCache{tenants: map[string][2]string{}},
+		NacosTimeouts: client.DefaultNacosTimeouts,
+		breakers:      map[string]*client.CircuitBreaker{},
+		credentials:   map[string]client.CredentialStore{},
+		dataKeys:      map[string][]byte{},
+		Resolvers:     client.ReferenceResolvers{},
+
+		SensitivePatterns: DefaultSensitivePatterns,
 	}
 }
 
@@ -28,27 +65,59 @@ func OK(ctx *gin.Context, data interface{}) {
 	ctx.JSON(http.StatusOK, response.Response{Data: data})
 }
 
+// NotOK responds the error with the status code of its type, the error field contains the stable error code
 func NotOK(ctx *gin.Context, err error) {
-	ctx.JSON(http.StatusBadRequest, response.Response{Message: err.Error(), Error: err})
+	ctx.JSON(httpStatusOf(err, http.StatusBadRequest), response.Response{Message: err.Error(), Error: errorBody(err)})
 }
 
 func (cs *ConfigService) ClientOf(item *client.ConfigItem) (string, client.ConfigClientIface, error) {
 	clusterName := cs.InfoGetter.ClusterNameOf(item.Tenant, item.Project, item.Environment)
-	if client, ok := cs.clients[clusterName]; ok {
-		return clusterName, client, nil
-	}
-	addr, uname, password, err := cs.InfoGetter.NacosInfoOf(clusterName)
+	cli, err := cs.clients.Get(clusterName, func() (ConnectionInfo, error) {
+		addr, uname, password, err := cs.InfoGetter.NacosInfoOf(clusterName)
+		if err != nil {
+			return ConnectionInfo{}, err
+		}
+		info := ConnectionInfo{Address: addr, Username: uname, Password: password}
+		if getter, ok := cs.InfoGetter.(TLSInfoGetter); ok {
+			info.TLS, err = getter.TLSConfigOf(clusterName)
+		}
+		return info, err
+	}, func(info ConnectionInfo) (client.ConfigClientIface, error) {
+		rt := cs.InfoGetter.RoundTripperOf(clusterName)
+		credentials, err := cs.credentialsOf(clusterName)
+		if err != nil {
+			return nil, err
+		}
+		opts := []client.NacosOption{
+			client.WithNacosTimeouts(cs.NacosTimeouts),
+			client.WithNacosTLS(info.TLS),
+			client.WithNacosCredentials(credentials),
+		}
+		if getter, ok := cs.InfoGetter.(ApplicationAccountsGetter); ok {
+			opts = append(opts, client.WithNacosApplicationAccounts(getter.ApplicationAccountsOf))
+		}
+		// TODO: adapt for more service
+		nacos, err := client.NewNacosService(strings.Split(info.Address, ","), info.Username, info.Password, rt, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return client.NewResilientClient(nacos, cs.breakerOf(clusterName)), nil
+	})
 	if err != nil {
 		return clusterName, nil, err
 	}
-	rt := cs.InfoGetter.RoundTripperOf(clusterName)
-	// TODO: adapt for more service
-	client, err := client.NewNacosService(addr, uname, password, rt)
-	if err != nil {
-		return clusterName, nil, err
+	return clusterName, &encryptingClient{ConfigClientIface: cli, cs: cs}, nil
+}
+
+func (cs *ConfigService) breakerOf(clusterName string) *client.CircuitBreaker {
+	cs.breakerLock.Lock()
+	defer cs.breakerLock.Unlock()
+	breaker, ok := cs.breakers[clusterName]
+	if !ok {
+		breaker = client.NewCircuitBreaker()
+		cs.breakers[clusterName] = breaker
 	}
-	cs.clients[clusterName] = client
-	return clusterName, client, nil
+	return breaker
 }
 
 func paramOrQuery(c *gin.Context, key string) string {
@@ -99,12 +168,24 @@ func (cs *ConfigService) BaseInfo(c *gin.Context) {
 
 func (cs *ConfigService) Get(c *gin.Context) {
 	item := buildConfigItemFromReq(c)
+	effective, err := effectiveView(c)
+	if err != nil {
+		NotOK(c, err)
+		return
+	}
 	if err := cs.withItem(c, item, func(ctx *gin.Context, cli client.ConfigClientIface) error {
-		return cli.Get(ctx, item)
+		if effective {
+			return cs.getEffective(ctx, cli, item)
+		}
+		if err := cli.Get(ctx, item); err != nil {
+			return err
+		}
+		return fillSensitive(item, cs.db)
 	}); err != nil {
 		NotOK(c, err)
 		return
 	}
+	cs.mask(item)
 	OK(c, item)
 }
 
@@ -116,15 +197,23 @@ func (cs *ConfigService) Pub(c *gin.Context) {
 			"module": "配置项",
 			"name":   item.Key,
 		})
+		item.LastUpdateUser = cs.Username(c)
+		if err := cs.checkNotMasked(item); err != nil {
+			return err
+		}
+		value := item.Value
 		if e := cli.Pub(c, item); e != nil {
 			return e
-		} else {
-			return UpsertConfigItem(item, cs.db, cs.Username(c))
+		} else if e := UpsertConfigItem(item, cs.db, cs.Username(c)); e != nil {
+			return e
 		}
+		item.Value = value
+		return nil
 	}); err != nil {
 		NotOK(c, err)
 		return
 	}
+	cs.mask(item)
 	OK(c, item)
 }
 
@@ -136,6 +225,7 @@ func (cs *ConfigService) Delete(c *gin.Context) {
 			"module": "配置项",
 			"name":   item.Key,
 		})
+		item.LastUpdateUser = cs.Username(c)
 		if e := cli.Delete(c, item); e != nil {
 			return e
 		} else {
@@ -158,13 +248,27 @@ func (cs *ConfigService) List(c *gin.Context) {
 	if serr != nil {
 		size = 10
 	}
+	effective, err := effectiveView(c)
+	if err != nil {
+		NotOK(c, err)
+		return
+	}
 	cs.withItem(c, item, func(ctx *gin.Context, cli client.ConfigClientIface) error {
-		data, err := cli.List(c, &client.ListOptions{
-			ConfigItem: *item,
-			Page:       page,
-			Size:       size,
-		})
-		FillDates(item, data, cs.db)
+		var (
+			data []*client.ConfigItem
+			err  error
+		)
+		if effective {
+			data, err = cs.listEffective(ctx, cli, item, page, size)
+		} else {
+			data, err = cli.List(c, &client.ListOptions{
+				ConfigItem: *item,
+				Page:       page,
+				Size:       size,
+			})
+			FillDates(item, data, cs.db)
+		}
+		cs.mask(data...)
 		if err != nil {
 			NotOK(ctx, err)
 		} else {
@@ -213,7 +317,45 @@ func (cs *ConfigService) AccountInfo(c *gin.Context) {
 	})
 }
 
-func (cs *ConfigService) setAuditData(c *gin.Context, clusterName, tenant, project, environment, application string) {
+// RotateAccounts sets new passwords of the accounts, the old passwords keep valid for the grace period in query, such as 10m
+func (cs *ConfigService) RotateAccounts(c *gin.Context) {
+	item := buildConfigItemFromReq(c)
+	var grace time.Duration
+	if value := c.Query("grace"); value != "" {
+		var err error
+		if grace, err = time.ParseDuration(value); err != nil || grace < 0 {
+			NotOK(c, client.InvalidArgumentError("invalid grace period %q", value))
+			return
+		}
+	}
+	cs.withItem(c, item, func(ctx *gin.Context, cli client.ConfigClientIface) error {
+		c.Set("audit_subject", map[string]string{
+			"action": "轮换",
+			"module": "配置中心账号",
+			"name":   item.Environment,
+		})
+		rotator, ok := cli.(client.AccountRotator)
+		if !ok {
+			err := client.InvalidArgumentError("accounts of the backend can not be rotated")
+			NotOK(ctx, err)
+			return err
+		}
+		data, err := rotator.RotateAccounts(c, item, grace)
+		if err != nil {
+			NotOK(ctx, err)
+		} else {
+			OK(ctx, data)
+		}
+		return err
+	})
+}
+
+// auditSetter is where audit data is set, *gin.Context for http api and *grpcAudit for grpc api
+type auditSetter interface {
+	Set(key string, value interface{})
+}
+
+func (cs *ConfigService) setAuditData(c auditSetter, clusterName, tenant, project, environment, application string) {
 	auditExtraDatas := map[string]string{
 		"tenant":      tenant,
 		"project":     project,
@@ -235,7 +377,7 @@ func (cs *ConfigService) SyncBackend2Database(c *gin.Context) {
 			"name":   item.Environment,
 		})
 
-		datas, err := cli.List(c, &client.ListOptions{
+		datas, err := rawClient(cli).List(c, &client.ListOptions{
 			ConfigItem: *item,
 			Page:       1,
 			Size:       1000,
@@ -259,7 +401,7 @@ func (cs *ConfigService) SyncDatabase2Backend(c *gin.Context) {
 			"module": "环境下的配置项",
 			"name":   item.Environment,
 		})
-		return SyncDatabase2Backend(item, cs.db, cli)
+		return SyncDatabase2Backend(item, cs.db, rawClient(cli))
 	}); err != nil {
 		NotOK(c, err)
 		return
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+	"kubegems.io/configer/client"
+)
+
+// memoryClient is an in-memory backend of one environment, the values are by key
+type memoryClient struct {
+	client.ConfigClientIface
+	values map[string]string
+	// apps are the applications of the keys, revs are the values of the keys at the revisions
+	apps map[string]string
+	revs map[int64]map[string]string
+	// errs are returned by Get of the keys
+	errs map[string]error
+}
+
+func (m *memoryClient) Get(ctx context.Context, item *client.ConfigItem) error {
+	if err, ok := m.errs[item.Key]; ok {
+		return err
+	}
+	values := m.values
+	if item.Rev != 0 {
+		values = m.revs[item.Rev]
+	}
+	v, ok := values[item.Key]
+	if !ok {
+		return client.NotFoundError("key %s not found", item.Key)
+	}
+	item.Value, item.Application = v, m.apps[item.Key]
+	return nil
+}
+
+func (m *memoryClient) List(ctx context.Context, opts *client.ListOptions) ([]*client.ConfigItem, error) {
+	keys := []string{}
+	for key := range m.values {
+		if opts.Application == "" || m.apps[key] == opts.Application {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	start, end := (opts.Page-1)*opts.Size, opts.Page*opts.Size
+	if start > len(keys) {
+		start = len(keys)
+	}
+	if end > len(keys) {
+		end = len(keys)
+	}
+	ret := []*client.ConfigItem{}
+	for _, key := range keys[start:end] {
+		ret = append(ret, &client.ConfigItem{
+			Tenant:      opts.Tenant,
+			Project:     opts.Project,
+			Environment: opts.Environment,
+			Application: m.apps[key],
+			Key:         key,
+			Value:       m.values[key],
+		})
+	}
+	return ret, nil
+}
+
+func (m *memoryClient) Pub(ctx context.Context, item *client.ConfigItem) error {
+	if m.values == nil {
+		m.values = map[string]string{}
+	}
+	if m.apps == nil {
+		m.apps = map[string]string{}
+	}
+	m.values[item.Key], m.apps[item.Key] = item.Value, item.Application
+	return nil
+}
+
+func (m *memoryClient) Delete(ctx context.Context, item *client.ConfigItem) error {
+	if _, ok := m.values[item.Key]; !ok {
+		return client.NotFoundError("key %s not found", item.Key)
+	}
+	delete(m.values, item.Key)
+	delete(m.apps, item.Key)
+	return nil
+}
+
+// testInfoGetter serves every environment by the cluster test
+type testInfoGetter struct{}
+
+func (testInfoGetter) ClusterNameOf(tenant, project, environment string) string { return "test" }
+
+func (testInfoGetter) NacosInfoOf(clusterName string) (string, string, string, error) {
+	return "test:8848", "", "", nil
+}
+
+func (testInfoGetter) RoundTripperOf(clusterName string) http.RoundTripper { return nil }
+
+func (testInfoGetter) Username(c *gin.Context) string { return "admin" }
+
+// newTestConfigService returns a service whose backend is cli, the database accepts everything and stores nothing
+func newTestConfigService(t *testing.T, infoGetter InfoGetter, cli client.ConfigClientIface) *ConfigService {
+	t.Helper()
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := NewConfigService(infoGetter, db)
+	clusterName := infoGetter.ClusterNameOf("", "", "")
+	if _, err := cs.clients.Get(clusterName, func() (ConnectionInfo, error) {
+		addr, username, password, err := infoGetter.NacosInfoOf(clusterName)
+		return ConnectionInfo{Address: addr, Username: username, Password: password}, err
+	}, func(ConnectionInfo) (client.ConfigClientIface, error) {
+		return cli, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return cs
+}
+
+// unpagedClient returns all the items on every page
+type unpagedClient struct {
+	*memoryClient
+}
+
+func (u unpagedClient) List(ctx context.Context, opts *client.ListOptions) ([]*client.ConfigItem, error) {
+	all := *opts
+	all.Page, all.Size = 1, len(u.values)
+	return u.memoryClient.List(ctx, &all)
+}
+
+func TestListAll(t *testing.T) {
+	cli := &memoryClient{values: map[string]string{}}
+	for i := 0; i < client.ListAllPageSize*2+1; i++ {
+		cli.values[fmt.Sprintf("key-%04d", i)] = "v"
+	}
+	item := &client.ConfigItem{Tenant: "t1", Project: "p1", Environment: "e1"}
+	for name, cli := range map[string]client.ConfigClientIface{"paged": cli, "unpaged": unpagedClient{cli}} {
+		items, err := client.ListAll(context.Background(), cli, item)
+		if err != nil || len(items) != client.ListAllPageSize*2+1 {
+			t.Errorf("%s ListAll() got %d items, error = %v", name, len(items), err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"kubegems.io/configer/client"
+)
+
+/*
+兼容 Spring Cloud Config Server 的只读接口, spring 客户端配置:
+	spring.cloud.config.uri = {configer}/configer/springcloud/tenant/{tenant}/project/{project}
+映射关系:
+	application = ConfigItem.Application, 未设置 application 的配置项对所有应用生效
+	profile     = environment, 可以用逗号分隔多个
+	label       = rev
+*/
+
+type SpringEnvironment struct {
+	Name            string                 `json:"name"`
+	Profiles        []string               `json:"profiles"`
+	Label           string                 `json:"label"`
+	Version         string                 `json:"version"`
+	State           string                 `json:"state"`
+	PropertySources []SpringPropertySource `json:"propertySources"`
+}
+
+type SpringPropertySource struct {
+	Name   string                 `json:"name"`
+	Source map[string]interface{} `json:"source"`
+}
+
+func (cs *ConfigService) SpringCloudEnvironment(c *gin.Context) {
+	application, label := c.Param("application"), c.Param("label")
+	profiles := strings.Split(c.Param("profile"), ",")
+	rev, _ := strconv.ParseInt(label, 10, 64)
+	ret := &SpringEnvironment{
+		Name:            application,
+		Profiles:        profiles,
+		Label:           label,
+		Version:         label,
+		PropertySources: []SpringPropertySource{},
+	}
+	// the last profile has the highest priority
+	for i := len(profiles) - 1; i >= 0; i-- {
+		item := &client.ConfigItem{
+			Tenant:      c.Param("tenant"),
+			Project:     c.Param("project"),
+			Environment: profiles[i],
+		}
+		sources, err := cs.springPropertySources(c, item, application, rev)
+		if err != nil {
+			NotOK(c, err)
+			return
+		}
+		ret.PropertySources = append(ret.PropertySources, sources...)
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+func (cs *ConfigService) springPropertySources(c *gin.Context, item *client.ConfigItem, application string, rev int64) ([]SpringPropertySource, error) {
+	_, cli, err := cs.ClientOf(item)
+	if err != nil {
+		return nil, err
+	}
+	items, err := client.ListAll(c, cli, item)
+	if err != nil {
+		return nil, err
+	}
+	appSources, sharedSources := []SpringPropertySource{}, []SpringPropertySource{}
+	for _, cfg := range items {
+		if cfg.Application != "" && cfg.Application != application {
+			continue
+		}
+		if rev != 0 {
+			cfg.Rev = rev
+			if err := cli.Get(c, cfg); err != nil {
+				// the key did not exist at this rev
+				if errors.Is(err, client.ErrNotFound) {
+					continue
+				}
+				return nil, err
+			}
+		}
+		if err := cs.renderOrMask(c, cli, cfg, true); err != nil {
+			return nil, err
+		}
+		source := SpringPropertySource{
+			Name:   fmt.Sprintf("configer:%s/%s/%s/%s", cfg.Tenant, cfg.Project, cfg.Environment, cfg.Key),
+			Source: springSourceOf(cfg),
+		}
+		// application specific configs override shared configs
+		if cfg.Application != "" {
+			appSources = append(appSources, source)
+		} else {
+			sharedSources = append(sharedSources, source)
+		}
+	}
+	return append(appSources, sharedSources...), nil
+}
+
+func springSourceOf(cfg *client.ConfigItem) map[string]interface{} {
+	ret := map[string]interface{}{}
+	format := formatOf(cfg.Key)
+	// a masked value has no structure to expose
+	if format == FormatText || cfg.Value == MaskedValue {
+		ret[cfg.Key] = cfg.Value
+		return ret
+	}
+	data, err := parseValue(format, cfg.Value)
+	if err != nil {
+		// not a valid structured value, expose it as it is
+		ret[cfg.Key] = cfg.Value
+		return ret
+	}
+	flatten("", data, ret)
+	return ret
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"kubegems.io/configer/client"
+)
+
+func TestConfigService_SpringCloudEnvironment(t *testing.T) {
+	cli := &memoryClient{
+		values: map[string]string{
+			"shared.properties": "db.host = mysql\n",
+			"app.yaml":          "db:\n  host: app-mysql\n",
+			"other.yaml":        "db:\n  host: other-mysql\n",
+			"text":              "hello",
+		},
+		apps: map[string]string{"app.yaml": "app", "other.yaml": "other"},
+		revs: map[int64]map[string]string{
+			1: {"shared.properties": "db.host = old\n"},
+		},
+	}
+	cs := newTestConfigService(t, testInfoGetter{}, cli)
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/configer/springcloud/tenant/:tenant/project/:project/:application/:profile", cs.SpringCloudEnvironment)
+	engine.GET("/configer/springcloud/tenant/:tenant/project/:project/:application/:profile/:label", cs.SpringCloudEnvironment)
+
+	tests := []struct {
+		name     string
+		path     string
+		errs     map[string]error
+		wantCode int
+		want     []SpringPropertySource
+	}{
+		{
+			name:     "application configs override shared ones",
+			path:     "/configer/springcloud/tenant/t1/project/p1/app/dev",
+			wantCode: http.StatusOK,
+			want: []SpringPropertySource{
+				{Name: "configer:t1/p1/dev/app.yaml", Source: map[string]interface{}{"db.host": "app-mysql"}},
+				{Name: "configer:t1/p1/dev/shared.properties", Source: map[string]interface{}{"db.host": "mysql"}},
+				{Name: "configer:t1/p1/dev/text", Source: map[string]interface{}{"text": "hello"}},
+			},
+		},
+		{
+			name:     "keys not existing at the label are skipped",
+			path:     "/configer/springcloud/tenant/t1/project/p1/app/dev/1",
+			wantCode: http.StatusOK,
+			want: []SpringPropertySource{
+				{Name: "configer:t1/p1/dev/shared.properties", Source: map[string]interface{}{"db.host": "old"}},
+			},
+		},
+		{
+			name:     "errors at the label are returned",
+			path:     "/configer/springcloud/tenant/t1/project/p1/app/dev/1",
+			errs:     map[string]error{"text": client.BackendUnavailableError("nacos unavailable")},
+			wantCode: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli.errs = tt.errs
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d, body %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			got := SpringEnvironment{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.PropertySources, tt.want) {
+				t.Errorf("property sources = %v, want %v", got.PropertySources, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigService_SpringCloudEnvironmentSensitive(t *testing.T) {
+	cli := &memoryClient{values: map[string]string{"db.password": "secret", "app.properties": "db.password = ${key:db.password}\n"}}
+	cs := newTestConfigService(t, projectsInfoGetter{}, cli)
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/configer/springcloud/tenant/:tenant/project/:project/:application/:profile", cs.SpringCloudEnvironment)
+
+	tests := []struct {
+		name   string
+		reveal bool
+		want   []SpringPropertySource
+	}{
+		{
+			name: "masked without resolving",
+			want: []SpringPropertySource{
+				{Name: "configer:t1/p1/dev/app.properties", Source: map[string]interface{}{"app.properties": MaskedValue}},
+				{Name: "configer:t1/p1/dev/db.password", Source: map[string]interface{}{"db.password": MaskedValue}},
+			},
+		},
+		{
+			name:   "revealed",
+			reveal: true,
+			want: []SpringPropertySource{
+				{Name: "configer:t1/p1/dev/app.properties", Source: map[string]interface{}{"db.password": "secret"}},
+				{Name: "configer:t1/p1/dev/db.password", Source: map[string]interface{}{"db.password": "secret"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/configer/springcloud/tenant/t1/project/p1/app/dev", nil)
+			if tt.reveal {
+				req.Header.Set("X-Reveal", "true")
+			}
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			got := SpringEnvironment{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.PropertySources, tt.want) {
+				t.Errorf("property sources = %v, want %v", got.PropertySources, tt.want)
+			}
+		})
+	}
+}
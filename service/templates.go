@@ -0,0 +1,356 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"kubegems.io/configer/client"
+	"kubegems.io/kubegems/pkg/utils/httputil/response"
+)
+
+/*
+配置模板是一组可复用的配置项, 属于租户, 只能实例化到租户下的环境. 值中可以用 ${param:name} 引用参数, 实例化到环境时填入参数,
+环境中已存在的 key 会跳过. 其他引用如 ${key:...} ${var:...} ${secret:...} 原样保留, 在读取时展开
+*/
+
+const SchemeParam = "param"
+
+var templateNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// Template is a named set of config items with parameterized values
+type Template struct {
+	Name             string              `json:"name"`
+	Description      string              `json:"description"`
+	Parameters       []TemplateParameter `json:"parameters"`
+	Items            []TemplateItem      `json:"items"`
+	LastUpdateUser   string              `json:"lastUpdateUser"`
+	LastModifiedTime string              `json:"lastModifiedTime"`
+}
+
+// TemplateParameter is referred by ${param:name} in the values, Default is used if not specified when instantiating
+type TemplateParameter struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     string `json:"default"`
+	Required    bool   `json:"required"`
+}
+
+type TemplateItem struct {
+	Key         string `json:"key"`
+	Application string `json:"application"`
+	Value       string `json:"value"`
+}
+
+// InstantiateRequest instantiates the template into an environment with the parameters
+type InstantiateRequest struct {
+	Template   string            `json:"template"`
+	Parameters map[string]string `json:"parameters"`
+}
+
+// InstantiateResult is the keys published and the keys skipped as they already exist
+type InstantiateResult struct {
+	Published []string `json:"published"`
+	Skipped   []string `json:"skipped"`
+}
+
+func (t *ConfigTemplate) toTemplate() *Template {
+	ret := &Template{
+		Name:             t.Name,
+		Description:      t.Description,
+		Parameters:       make([]TemplateParameter, 0, len(t.Parameters)),
+		Items:            make([]TemplateItem, 0, len(t.Items)),
+		LastUpdateUser:   t.LastUpdateUser,
+		LastModifiedTime: t.LastUpdateTime.Format(time.RFC3339),
+	}
+	for _, p := range t.Parameters {
+		ret.Parameters = append(ret.Parameters, TemplateParameter{Name: p.Name, Description: p.Description, Default: p.Default, Required: p.Required})
+	}
+	for _, item := range t.Items {
+		ret.Items = append(ret.Items, TemplateItem{Key: item.Key, Application: item.Application, Value: item.Value})
+	}
+	return ret
+}
+
+func (cs *ConfigService) templateOf(ctx context.Context, tenant, name string) (*ConfigTemplate, error) {
+	template := &ConfigTemplate{}
+	if err := cs.db.WithContext(ctx).Preload("Parameters").Preload("Items").First(template, ConfigTemplate{Tenant: tenant, Name: name}).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, client.NotFoundError("template %s of tenant %s not found", name, tenant)
+		}
+		return nil, err
+	}
+	return template, nil
+}
+
+func (cs *ConfigService) ListTemplates(c *gin.Context) {
+	templates := []ConfigTemplate{}
+	if err := cs.db.Preload("Parameters").Preload("Items").Order("name").Find(&templates, ConfigTemplate{Tenant: c.Param("tenant")}).Error; err != nil {
+		NotOK(c, err)
+		return
+	}
+	ret := make([]*Template, 0, len(templates))
+	for i := range templates {
+		ret = append(ret, templates[i].toTemplate())
+	}
+	OK(c, ret)
+}
+
+func (cs *ConfigService) GetTemplate(c *gin.Context) {
+	template, err := cs.templateOf(c, c.Param("tenant"), c.Param("name"))
+	if err != nil {
+		NotOK(c, err)
+		return
+	}
+	OK(c, template.toTemplate())
+}
+
+// SetTemplate creates the template or replaces all of it
+func (cs *ConfigService) SetTemplate(c *gin.Context) {
+	tenant, name := c.Param("tenant"), c.Param("name")
+	cs.setAuditData(c, "", tenant, "", "", "")
+	c.Set("audit_subject", map[string]string{
+		"action": "设置",
+		"module": "配置模板",
+		"name":   name,
+	})
+	body := Template{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		NotOK(c, client.InvalidArgumentError("invalid template, %v", err))
+		return
+	}
+	body.Name = name
+	if err := validateTemplate(&body); err != nil {
+		NotOK(c, err)
+		return
+	}
+	template := &ConfigTemplate{}
+	if err := cs.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Limit(1).Find(template, ConfigTemplate{Tenant: tenant, Name: name})
+		if result.Error != nil {
+			return result.Error
+		}
+		template.Tenant, template.Name, template.Description, template.LastUpdateUser = tenant, name, body.Description, cs.Username(c)
+		template.Parameters, template.Items = nil, nil
+		if result.RowsAffected == 0 {
+			if err := tx.Omit("Parameters", "Items").Create(template).Error; err != nil {
+				return err
+			}
+		} else {
+			// a map is used as the empty description is a zero value
+			if err := tx.Model(template).Omit("Parameters", "Items").Updates(map[string]interface{}{
+				"description":      template.Description,
+				"last_update_user": template.LastUpdateUser,
+			}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("template_id = ?", template.ID).Delete(&ConfigTemplateParameter{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("template_id = ?", template.ID).Delete(&ConfigTemplateItem{}).Error; err != nil {
+				return err
+			}
+		}
+		for _, p := range body.Parameters {
+			template.Parameters = append(template.Parameters, ConfigTemplateParameter{
+				TemplateID: template.ID, Name: p.Name, Description: p.Description, Default: p.Default, Required: p.Required,
+			})
+		}
+		for _, item := range body.Items {
+			template.Items = append(template.Items, ConfigTemplateItem{
+				TemplateID: template.ID, Key: item.Key, Application: item.Application, Value: item.Value,
+			})
+		}
+		if len(template.Parameters) > 0 {
+			if err := tx.Create(&template.Parameters).Error; err != nil {
+				return err
+			}
+		}
+		if len(template.Items) > 0 {
+			if err := tx.Create(&template.Items).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		NotOK(c, err)
+		return
+	}
+	OK(c, template.toTemplate())
+}
+
+func (cs *ConfigService) DeleteTemplate(c *gin.Context) {
+	tenant, name := c.Param("tenant"), c.Param("name")
+	cs.setAuditData(c, "", tenant, "", "", "")
+	c.Set("audit_subject", map[string]string{
+		"action": "删除",
+		"module": "配置模板",
+		"name":   name,
+	})
+	if err := cs.db.Transaction(func(tx *gorm.DB) error {
+		template := &ConfigTemplate{}
+		result := tx.Limit(1).Find(template, ConfigTemplate{Tenant: tenant, Name: name})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if err := tx.Where("template_id = ?", template.ID).Delete(&ConfigTemplateParameter{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("template_id = ?", template.ID).Delete(&ConfigTemplateItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(template).Error
+	}); err != nil {
+		NotOK(c, err)
+		return
+	}
+	OK(c, name)
+}
+
+// validateTemplate checks the names and that the parameters referred are declared
+func validateTemplate(template *Template) error {
+	if !templateNamePattern.MatchString(template.Name) {
+		return client.InvalidArgumentError("invalid template name %q", template.Name)
+	}
+	declared := map[string]bool{}
+	for _, p := range template.Parameters {
+		if !variableNamePattern.MatchString(p.Name) {
+			return client.InvalidArgumentError("invalid parameter name %q", p.Name)
+		}
+		if declared[p.Name] {
+			return client.InvalidArgumentError("duplicated parameter %s", p.Name)
+		}
+		declared[p.Name] = true
+	}
+	keys := map[string]bool{}
+	for _, item := range template.Items {
+		if item.Key == "" || keys[item.Key] {
+			return client.InvalidArgumentError("empty or duplicated key %q", item.Key)
+		}
+		keys[item.Key] = true
+		for _, ref := range client.ParseReferences(item.Value) {
+			if ref.Scheme == SchemeParam && !declared[ref.Path] {
+				return client.InvalidArgumentError("parameter %s referred by %s is not declared", ref.Path, item.Key)
+			}
+		}
+	}
+	return nil
+}
+
+// templateParameters returns the values of the parameters, the defaults are used if not specified
+func templateParameters(template *ConfigTemplate, values map[string]string) (map[string]string, error) {
+	ret := map[string]string{}
+	for _, p := range template.Parameters {
+		value, ok := values[p.Name]
+		if !ok {
+			if p.Required {
+				return nil, client.InvalidArgumentError("parameter %s is required", p.Name)
+			}
+			value = p.Default
+		}
+		ret[p.Name] = value
+	}
+	for name := range values {
+		if _, ok := ret[name]; !ok {
+			return nil, client.InvalidArgumentError("unknown parameter %s of template %s", name, template.Name)
+		}
+	}
+	return ret, nil
+}
+
+// instantiate publishes the items of the template which do not exist in the environment of item,
+// the result has the keys published and skipped before the error if it fails
+func (cs *ConfigService) instantiate(ctx context.Context, cli client.ConfigClientIface, item *client.ConfigItem,
+	template *ConfigTemplate, values map[string]string, username string,
+) (*InstantiateResult, error) {
+	params, err := templateParameters(template, values)
+	if err != nil {
+		return nil, err
+	}
+	resolvers := client.ReferenceResolvers{
+		SchemeParam: client.ReferenceResolverFunc(func(ctx context.Context, _ *client.ConfigItem, ref client.Reference) (string, error) {
+			value, ok := params[ref.Path]
+			if !ok {
+				return "", client.InvalidArgumentError("parameter %s is not declared", ref.Path)
+			}
+			return value, nil
+		}),
+	}
+	items := make([]*client.ConfigItem, 0, len(template.Items))
+	for _, t := range template.Items {
+		it := &client.ConfigItem{
+			Tenant:         item.Tenant,
+			Project:        item.Project,
+			Environment:    item.Environment,
+			Application:    t.Application,
+			Key:            t.Key,
+			Value:          t.Value,
+			LastUpdateUser: username,
+		}
+		// render all the values first, so nothing is published if any parameter is invalid
+		if it.Value, err = resolvers.Render(ctx, it); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+
+	ret := &InstantiateResult{Published: []string{}, Skipped: []string{}}
+	for _, it := range items {
+		// checked right before publishing, so the keys published meanwhile are not overwritten
+		existing := *it
+		err := cli.Get(ctx, &existing)
+		if err == nil {
+			ret.Skipped = append(ret.Skipped, it.Key)
+			continue
+		}
+		if !errors.Is(err, client.ErrNotFound) {
+			return ret, err
+		}
+		if err := cli.Pub(ctx, it); err != nil {
+			return ret, err
+		}
+		if err := UpsertConfigItem(it, cs.db, username); err != nil {
+			return ret, err
+		}
+		ret.Published = append(ret.Published, it.Key)
+	}
+	return ret, nil
+}
+
+// Instantiate publishes the items of a template into the environment, the keys already exist are skipped
+func (cs *ConfigService) Instantiate(c *gin.Context) {
+	// the body is read before buildConfigItemFromReq, which consumes it
+	body := InstantiateRequest{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		NotOK(c, client.InvalidArgumentError("invalid instantiate request, %v", err))
+		return
+	}
+	item := buildConfigItemFromReq(c)
+	var ret *InstantiateResult
+	if err := cs.withItem(c, item, func(ctx *gin.Context, cli client.ConfigClientIface) error {
+		c.Set("audit_subject", map[string]string{
+			"action": "实例化",
+			"module": "配置模板",
+			"name":   body.Template,
+		})
+		template, err := cs.templateOf(ctx, item.Tenant, body.Template)
+		if err != nil {
+			return err
+		}
+		ret, err = cs.instantiate(ctx, cli, item, template, body.Parameters, cs.Username(c))
+		return err
+	}); err != nil {
+		if ret != nil {
+			// the keys published before the error are kept, the caller retries the rest
+			c.JSON(httpStatusOf(err, http.StatusBadRequest), response.Response{Message: err.Error(), Error: errorBody(err), Data: ret})
+			return
+		}
+		NotOK(c, err)
+		return
+	}
+	OK(c, ret)
+}
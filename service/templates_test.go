@@ -0,0 +1,136 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"kubegems.io/configer/client"
+)
+
+func TestTemplateParameters(t *testing.T) {
+	template := &Template{
+		Name: "standard",
+		Parameters: []TemplateParameter{
+			{Name: "db_host", Required: true},
+			{Name: "replicas", Default: "1"},
+		},
+		Items: []TemplateItem{
+			{Key: "app.yaml", Value: "db: ${param:db_host}\nreplicas: ${param:replicas}\nport: ${var:port}\n"},
+		},
+	}
+	if err := validateTemplate(template); err != nil {
+		t.Fatalf("validateTemplate() error = %v", err)
+	}
+	undeclared := &Template{Name: "t", Items: []TemplateItem{{Key: "a", Value: "${param:x}"}}}
+	if err := validateTemplate(undeclared); !errors.Is(err, client.ErrInvalidArgument) {
+		t.Errorf("validateTemplate() undeclared parameter error = %v", err)
+	}
+
+	dbtemplate := &ConfigTemplate{Name: template.Name}
+	for _, p := range template.Parameters {
+		dbtemplate.Parameters = append(dbtemplate.Parameters, ConfigTemplateParameter{Name: p.Name, Default: p.Default, Required: p.Required})
+	}
+	tests := []struct {
+		name    string
+		values  map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "default", values: map[string]string{"db_host": "mysql"}, want: map[string]string{"db_host": "mysql", "replicas": "1"}},
+		{name: "specified", values: map[string]string{"db_host": "mysql", "replicas": "3"}, want: map[string]string{"db_host": "mysql", "replicas": "3"}},
+		{name: "required", values: map[string]string{"replicas": "3"}, wantErr: true},
+		{name: "unknown", values: map[string]string{"db_host": "mysql", "port": "80"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := templateParameters(dbtemplate, tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("templateParameters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("templateParameters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigService_Instantiate(t *testing.T) {
+	cli := &memoryClient{
+		values: map[string]string{"a.yaml": "existing"},
+		errs:   map[string]error{"c.yaml": client.BackendUnavailableError("backend is down")},
+	}
+	cs := newTestConfigService(t, testInfoGetter{}, cli)
+	template := ConfigTemplate{
+		Tenant:     "t1",
+		Name:       "standard",
+		Parameters: []ConfigTemplateParameter{{Name: "host", Required: true}},
+		Items: []ConfigTemplateItem{
+			{Key: "a.yaml", Value: "host: ${param:host}"},
+			{Key: "b.yaml", Value: "host: ${param:host}"},
+		},
+	}
+	// the template of the tenant t1 is the only one in database
+	if err := cs.db.Callback().Query().Register("test:templates", func(db *gorm.DB) {
+		dest, ok := db.Statement.Dest.(*ConfigTemplate)
+		if !ok {
+			return
+		}
+		where, _ := db.Statement.Clauses["WHERE"].Expression.(clause.Where)
+		for _, expr := range where.Exprs {
+			if eq, ok := expr.(clause.Eq); ok && eq.Column.(clause.Column).Name == "tenant" && eq.Value != template.Tenant {
+				db.AddError(gorm.ErrRecordNotFound)
+				return
+			}
+		}
+		*dest = template
+		db.RowsAffected = 1
+	}); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/configer/tenant/:tenant/project/:project/environment/:environment/action/instantiate", cs.Instantiate)
+	instantiate := func(tenant string) (int, *InstantiateResult) {
+		w := httptest.NewRecorder()
+		body := strings.NewReader(`{"template": "standard", "parameters": {"host": "mysql"}}`)
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/configer/tenant/"+tenant+"/project/p1/environment/dev/action/instantiate", body))
+		ret := struct {
+			Data *InstantiateResult `json:"data"`
+		}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &ret); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, ret.Data
+	}
+
+	code, got := instantiate("t1")
+	if want := (&InstantiateResult{Published: []string{"b.yaml"}, Skipped: []string{"a.yaml"}}); code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Errorf("Instantiate() = %d %v, want %v", code, got, want)
+	}
+	if cli.values["a.yaml"] != "existing" || cli.values["b.yaml"] != "host: mysql" {
+		t.Errorf("Instantiate() values = %v", cli.values)
+	}
+
+	// the keys published before the failure are returned with the error
+	delete(cli.values, "b.yaml")
+	template.Items = append(template.Items, ConfigTemplateItem{Key: "c.yaml", Value: "c"}, ConfigTemplateItem{Key: "d.yaml", Value: "d"})
+	code, got = instantiate("t1")
+	if want := (&InstantiateResult{Published: []string{"b.yaml"}, Skipped: []string{"a.yaml"}}); code != http.StatusServiceUnavailable || !reflect.DeepEqual(got, want) {
+		t.Errorf("Instantiate() failed midway = %d %v, want %v", code, got, want)
+	}
+	if _, ok := cli.values["d.yaml"]; ok {
+		t.Errorf("Instantiate() should stop at the failure")
+	}
+
+	if code, got := instantiate("t2"); code != http.StatusNotFound || got != nil {
+		t.Errorf("Instantiate() template of another tenant = %d %v, want NotFound", code, got)
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"kubegems.io/configer/client"
+)
+
+var variableNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// Variable is a project variable, the values of the project refer it by ${var:name}
+type Variable struct {
+	Name             string `json:"name"`
+	Value            string `json:"value"`
+	LastUpdateUser   string `json:"lastUpdateUser"`
+	LastModifiedTime string `json:"lastModifiedTime"`
+}
+
+func (v *ProjectVariable) toVariable() Variable {
+	return Variable{
+		Name:             v.Name,
+		Value:            v.Value,
+		LastUpdateUser:   v.LastUpdateUser,
+		LastModifiedTime: v.LastUpdateTime.Format(time.RFC3339),
+	}
+}
+
+func (cs *ConfigService) ListVariables(c *gin.Context) {
+	variables := []ProjectVariable{}
+	if err := cs.db.Order("name").Find(&variables, ProjectVariable{Tenant: c.Param("tenant"), Project: c.Param("project")}).Error; err != nil {
+		NotOK(c, err)
+		return
+	}
+	ret := make([]Variable, 0, len(variables))
+	for i := range variables {
+		ret = append(ret, variables[i].toVariable())
+	}
+	OK(c, ret)
+}
+
+func (cs *ConfigService) SetVariable(c *gin.Context) {
+	tenant, project, name := c.Param("tenant"), c.Param("project"), c.Param("name")
+	cs.setAuditData(c, "", tenant, project, "", "")
+	c.Set("audit_subject", map[string]string{
+		"action": "设置",
+		"module": "项目变量",
+		"name":   name,
+	})
+	if !variableNamePattern.MatchString(name) {
+		NotOK(c, client.InvalidArgumentError("invalid variable name %q", name))
+		return
+	}
+	body := Variable{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		NotOK(c, client.InvalidArgumentError("invalid variable, %v", err))
+		return
+	}
+	variable := ProjectVariable{}
+	cond := ProjectVariable{Tenant: tenant, Project: project, Name: name}
+	result := cs.db.Limit(1).Find(&variable, cond)
+	if result.Error != nil {
+		NotOK(c, result.Error)
+		return
+	}
+	var err error
+	if result.RowsAffected == 0 {
+		variable = cond
+		variable.Value, variable.LastUpdateUser = body.Value, cs.Username(c)
+		err = cs.db.Create(&variable).Error
+	} else {
+		variable.Value, variable.LastUpdateUser = body.Value, cs.Username(c)
+		// a map is used as the empty value is a zero value
+		err = cs.db.Model(&variable).Updates(map[string]interface{}{"value": variable.Value, "last_update_user": variable.LastUpdateUser}).Error
+	}
+	if err != nil {
+		NotOK(c, err)
+		return
+	}
+	OK(c, variable.toVariable())
+}
+
+func (cs *ConfigService) DeleteVariable(c *gin.Context) {
+	tenant, project, name := c.Param("tenant"), c.Param("project"), c.Param("name")
+	cs.setAuditData(c, "", tenant, project, "", "")
+	c.Set("audit_subject", map[string]string{
+		"action": "删除",
+		"module": "项目变量",
+		"name":   name,
+	})
+	if err := cs.db.Where("tenant = ? and project = ? and name = ?", tenant, project, name).Delete(&ProjectVariable{}).Error; err != nil {
+		NotOK(c, err)
+		return
+	}
+	OK(c, name)
+}